@@ -0,0 +1,237 @@
+package main
+
+import (
+	"database/sql"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// Print at most this many of the media already in the archive, at the prompt
+const ArchiveExamples = 5
+
+// An index of everywhere badger has copied each content, across every destination, so media already
+// in the archive can be spotted before they're copied somewhere else
+type ArchiveIndex struct {
+	db *sql.DB
+}
+
+// An incoming media whose content was already copied somewhere in the archive
+type ArchiveMatch struct {
+	source   string
+	location string
+}
+
+/*
+ * Open the archive index, kept in the user's cache directory like remote destinations' databases
+ */
+func OpenArchiveIndex() (*ArchiveIndex, error) {
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Join(cache, "badger")
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	conn, err := sql.Open("sqlite3", filepath.Join(dir, "archive.sqlite")+"?_journal_mode=WAL&_synchronous=NORMAL&_busy_timeout=10000&_txlock=immediate")
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = conn.Exec(`CREATE TABLE IF NOT EXISTS archive (
+			hash            TEXT NOT NULL,
+			hashAlgorithm   TEXT NOT NULL,
+			size            INTEGER NOT NULL,
+			location        TEXT NOT NULL,
+			runId           TEXT NOT NULL,
+			PRIMARY KEY (hash, hashAlgorithm, location)
+	)`)
+
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// sizes are checked before hashing, as most incoming media won't match any
+	if _, err = conn.Exec(`CREATE INDEX IF NOT EXISTS archiveSize ON archive (size)`); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &ArchiveIndex{conn}, nil
+}
+
+func (index *ArchiveIndex) Close() error {
+	return index.db.Close()
+}
+
+/*
+ * Name where a copy is in the archive; its absolute path, or its URL on a remote destination
+ */
+func ArchiveLocation(to string, dst string) string {
+	if IsRemoteDestination(to) {
+		if target, err := url.Parse(to); err == nil {
+			target.User = nil
+			target.Path = filepath.ToSlash(dst)
+
+			return target.String()
+		}
+	}
+
+	if abs, err := filepath.Abs(dst); err == nil {
+		return abs
+	}
+
+	return dst
+}
+
+/*
+ * Record where a run copied each media, from the destination's database
+ */
+func (index *ArchiveIndex) RecordRun(db *BadgerDb, runId string, to string) error {
+	rows, err := db.ListArchiveRows(runId)
+	if err != nil {
+		return err
+	}
+
+	tx, err := index.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, row := range rows {
+		_, err := tx.Exec(`INSERT OR REPLACE INTO archive (hash, hashAlgorithm, size, location, runId) VALUES (?, ?, ?, ?, ?)`,
+			row.hash, row.hashAlgorithm, row.size, ArchiveLocation(to, row.dst), runId)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+/*
+ * Find incoming media whose content is already somewhere in the archive. Only media the same size
+ * as an archived copy are hashed. Local copies that have since been removed are forgotten
+ */
+func (index *ArchiveIndex) FindCopies(entries []Media) ([]ArchiveMatch, error) {
+	matches := []ArchiveMatch{}
+
+	for idx := range entries {
+		media := &entries[idx]
+
+		size, err := media.Size()
+		if err != nil {
+			return nil, err
+		}
+
+		var found int
+		err = index.db.QueryRow(`SELECT COUNT(*) FROM archive WHERE size = ? AND hashAlgorithm = ?`, size, media.hashAlgorithm).Scan(&found)
+		if err != nil {
+			return nil, err
+		}
+
+		if found == 0 {
+			continue
+		}
+
+		hash, err := media.GetHash()
+		if err != nil {
+			return nil, err
+		}
+
+		locations, err := index.Locations(hash, media.hashAlgorithm)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, location := range locations {
+			if !IsRemoteDestination(location) {
+				if _, err := os.Stat(location); os.IsNotExist(err) {
+					if err := index.Forget(location); err != nil {
+						return nil, err
+					}
+
+					continue
+				}
+			}
+
+			matches = append(matches, ArchiveMatch{media.source, location})
+			break
+		}
+	}
+
+	return matches, nil
+}
+
+/*
+ * List everywhere a content was copied
+ */
+func (index *ArchiveIndex) Locations(hash string, algorithm HashAlgorithm) ([]string, error) {
+	rows, err := index.db.Query(`SELECT location FROM archive WHERE hash = ? AND hashAlgorithm = ? ORDER BY location`, hash, algorithm)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	locations := []string{}
+
+	for rows.Next() {
+		var location string
+
+		if err := rows.Scan(&location); err != nil {
+			return nil, err
+		}
+
+		locations = append(locations, location)
+	}
+
+	return locations, rows.Err()
+}
+
+/*
+ * Forget a copy that's no longer in the archive
+ */
+func (index *ArchiveIndex) Forget(location string) error {
+	_, err := index.db.Exec(`DELETE FROM archive WHERE location = ?`, location)
+	return err
+}
+
+/*
+ * Note which media are already in the archive, to warn about before copying them again
+ */
+func CheckArchive(entries []Media, facts *Facts) error {
+	index, err := OpenArchiveIndex()
+	if err != nil {
+		return err
+	}
+	defer index.Close()
+
+	matches, err := index.FindCopies(entries)
+	if err != nil {
+		return err
+	}
+
+	facts.ArchivedCount = len(matches)
+	facts.archived = matches
+
+	return nil
+}
+
+/*
+ * Record where a run copied its media in the archive index
+ */
+func RecordArchive(db *BadgerDb, runId string, to string) error {
+	index, err := OpenArchiveIndex()
+	if err != nil {
+		return err
+	}
+	defer index.Close()
+
+	return index.RecordRun(db, runId, to)
+}
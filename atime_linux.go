@@ -0,0 +1,19 @@
+package main
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+/*
+ * Get a file's access-time, falling back to its mtime where unavailable
+ */
+func GetAtime(info os.FileInfo) time.Time {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return info.ModTime()
+	}
+
+	return time.Unix(stat.Atim.Unix())
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package main
+
+import (
+	"os"
+	"time"
+)
+
+/*
+ * Get a file's access-time; the stat layout differs between other platforms, so this is its mtime
+ */
+func GetAtime(info os.FileInfo) time.Time {
+	return info.ModTime()
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"sort"
+)
+
+/*
+ * Get each time's distance to its k-th nearest neighbour, sorted ascending; DBSCAN's k-distance
+ * curve. The times must be sorted
+ */
+func KDistances(times []float64, k int) []float64 {
+	dists := make([]float64, 0, len(times))
+
+	if k < 1 || len(times) <= k {
+		return dists
+	}
+
+	for idx, time := range times {
+		left := idx - 1
+		right := idx + 1
+		dist := 0.0
+
+		// walk outwards, taking whichever neighbour is closer, until k are taken
+		for taken := 0; taken < k; taken++ {
+			if right >= len(times) || (left >= 0 && time-times[left] <= times[right]-time) {
+				dist = time - times[left]
+				left--
+			} else {
+				dist = times[right] - time
+				right++
+			}
+		}
+
+		dists = append(dists, dist)
+	}
+
+	sort.Float64s(dists)
+
+	return dists
+}
+
+/*
+ * Find the knee of an ascending curve; the point furthest below the line joining its ends, once
+ * both axes are normalised. Returns -1 if the curve is flat
+ */
+func FindKnee(curve []float64) int {
+	if len(curve) < 3 {
+		return -1
+	}
+
+	low := curve[0]
+	high := curve[len(curve)-1]
+
+	if high == low {
+		return -1
+	}
+
+	knee := -1
+	best := 0.0
+
+	for idx, value := range curve {
+		x := float64(idx) / float64(len(curve)-1)
+		y := (value - low) / (high - low)
+
+		if x-y > best {
+			best = x - y
+			knee = idx
+		}
+	}
+
+	return knee
+}
+
+/*
+ * Pick an epsilon for clustering a library by capture time, from the knee of its k-distance
+ * curve. Returns zero if no epsilon could be picked, e.g because the library is too small
+ */
+func AutoEpsilon(minPoints int, library *MediaList) float64 {
+	times := make([]float64, 0, library.Size())
+
+	for _, media := range library.Values() {
+		times = append(times, float64(media.GetCreationTime()))
+	}
+
+	sort.Float64s(times)
+
+	curve := KDistances(times, minPoints)
+	knee := FindKnee(curve)
+
+	if knee < 0 {
+		return 0
+	}
+
+	return curve[knee]
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// A camera attached over USB, as listed by gphoto2
+type Camera struct {
+	model string
+	port  string
+}
+
+/*
+ * List the PTP/MTP cameras gphoto2 can see. Its --auto-detect output is a table of models and
+ * ports, under a dashed header line
+ */
+func ListCameras() ([]Camera, error) {
+	if _, err := exec.LookPath("gphoto2"); err != nil {
+		return nil, errors.New("badger: importing from a camera needs gphoto2 installed; see http://gphoto.org")
+	}
+
+	output, err := exec.Command("gphoto2", "--auto-detect").Output()
+	if err != nil {
+		return nil, fmt.Errorf("badger: failed to list cameras with gphoto2: %v", err)
+	}
+
+	cameras := []Camera{}
+	listed := false
+
+	scanner := bufio.NewScanner(strings.NewReader(string(output)))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if strings.HasPrefix(line, "---") {
+			listed = true
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if !listed || len(fields) < 2 {
+			continue
+		}
+
+		port := fields[len(fields)-1]
+		cameras = append(cameras, Camera{
+			model: strings.TrimSpace(strings.TrimSuffix(line, port)),
+			port:  port,
+		})
+	}
+
+	return cameras, nil
+}
+
+/*
+ * Choose the camera to import from; the one on --port, or the only camera attached
+ */
+func SelectCamera(cameras []Camera, port string) (Camera, error) {
+	if len(port) > 0 {
+		for _, camera := range cameras {
+			if camera.port == port {
+				return camera, nil
+			}
+		}
+
+		return Camera{}, fmt.Errorf("badger: no camera is attached on --port %v", port)
+	}
+
+	if len(cameras) == 0 {
+		return Camera{}, errors.New("badger: no cameras found; is the camera on, and in PTP or MTP mode? Cameras mounted as a filesystem can use --from-dir instead")
+	}
+
+	if len(cameras) > 1 {
+		listing := []string{}
+		for _, camera := range cameras {
+			listing = append(listing, fmt.Sprintf("%v (%v)", camera.model, camera.port))
+		}
+
+		return Camera{}, fmt.Errorf("badger: %v cameras are attached; choose one with --port: %v", len(cameras), strings.Join(listing, ", "))
+	}
+
+	return cameras[0], nil
+}
+
+/*
+ * Download every file on a camera into a staging folder. Cameras reuse file names across their
+ * folders, so names are prefixed with each file's capture time. Files already staged are skipped,
+ * so an interrupted download can be continued
+ */
+func DownloadCamera(camera Camera, staging string) error {
+	cmd := exec.Command("gphoto2",
+		"--port", camera.port,
+		"--get-all-files",
+		"--skip-existing",
+		"--filename", staging+"/%Y%m%d_%H%M%S_%:")
+
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("badger: failed to download media from %v (%v): %v", camera.model, camera.port, err)
+	}
+
+	return nil
+}
+
+/*
+ * Import media straight from an attached camera; download it into a staging folder, then cluster & copy
+ * it into the destination, using the config file's options. A temporary staging folder is removed once
+ * the import succeeds; one given with --staging is kept
+ */
+func ImportCamera(to string, port string, staging string, configPath string, profile string, yes bool) int {
+	cameras, err := ListCameras()
+	bail(err)
+
+	camera, err := SelectCamera(cameras, port)
+	bail(err)
+
+	temporary := len(staging) == 0
+	if temporary {
+		staging, err = os.MkdirTemp("", "badger-camera-")
+		bail(err)
+	} else {
+		err = os.MkdirAll(staging, os.ModePerm)
+		bail(err)
+	}
+
+	fmt.Printf("badger: downloading media from %v (%v) into %v\n", camera.model, camera.port, staging)
+
+	err = DownloadCamera(camera, staging)
+	bail(err)
+
+	args := []string{"cluster", "--from-dir=" + staging, "--to=" + to, "--incremental"}
+
+	if yes {
+		args = append(args, "--yes")
+	}
+
+	if len(configPath) > 0 {
+		args = append(args, "--config="+configPath)
+	}
+
+	if len(profile) > 0 {
+		args = append(args, "--profile="+profile)
+	}
+
+	if err := RunBadgerProcess(args); err != nil {
+		fmt.Printf("badger: failed to import media from %v; the downloaded media are kept in %v\n", camera.model, staging)
+		return 1
+	}
+
+	if temporary {
+		os.RemoveAll(staging)
+	}
+
+	return 0
+}
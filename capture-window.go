@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Layouts accepted for dates & times given on the command-line
+var DateLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02"}
+
+// Relative dates count back from now in hours, days or weeks, like 7d
+var RelativeDatePattern = regexp.MustCompile(`^(\d+)([hdw])$`)
+
+/*
+ * Parse a date like 2021-07-04, or a time like 2021-07-04T15:04:05Z, in local time. Reports whether
+ * only a date was given
+ */
+func ParseDate(text string) (time.Time, bool, error) {
+	for _, layout := range DateLayouts {
+		if date, err := time.ParseInLocation(layout, text, time.Local); err == nil {
+			return date, layout == "2006-01-02", nil
+		}
+	}
+
+	return time.Time{}, false, fmt.Errorf("badger: could not parse '%v' as a date like 2021-07-04, or a time like 2021-07-04T15:04:05Z", text)
+}
+
+/*
+ * Parse an --after or --before value; either a relative date like 7d, or a date or time accepted by ParseDate.
+ * Reports whether only a date was given
+ */
+func ParseRelativeDate(text string, now time.Time) (time.Time, bool, error) {
+	match := RelativeDatePattern.FindStringSubmatch(text)
+	if match == nil {
+		date, dateOnly, err := ParseDate(text)
+		if err != nil {
+			return date, dateOnly, fmt.Errorf("badger: could not parse '%v' as a relative date like 7d, a date like 2021-07-04, or a time like 2021-07-04T15:04:05Z", text)
+		}
+
+		return date, dateOnly, nil
+	}
+
+	count, err := strconv.Atoi(match[1])
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	switch match[2] {
+	case "h":
+		return now.Add(-time.Duration(count) * time.Hour), false, nil
+	case "w":
+		return now.AddDate(0, 0, -7*count), false, nil
+	}
+
+	return now.AddDate(0, 0, -count), false, nil
+}
+
+/*
+ * Parse a --before value into a unix time. Media captured on a given date are not before it
+ */
+func ParseBefore(text string, now time.Time) (int, error) {
+	before, _, err := ParseRelativeDate(text, now)
+	if err != nil {
+		return 0, err
+	}
+
+	// the capture window is inclusive, so stop a second short of the bound
+	return int(before.Unix()) - 1, nil
+}
+
+/*
+ * Parse an --until value into a unix time. A date includes the whole of that day
+ */
+func ParseUntil(text string) (int, error) {
+	until, dateOnly, err := ParseDate(text)
+	if err != nil {
+		return 0, err
+	}
+
+	if dateOnly {
+		until = until.AddDate(0, 0, 1).Add(-time.Second)
+	}
+
+	return int(until.Unix()), nil
+}
+
+/*
+ * Keep only media captured between `since` and `until`, inclusive, as unix times. A zero bound
+ * is left open. Media outside the window are logged as skipped
+ */
+func (library *MediaList) FilterByCaptureTime(since int, until int, log *EventLog) (*MediaList, error) {
+	kept := []*Media{}
+
+	for _, media := range library.Values() {
+		ctime := media.GetCreationTime()
+
+		if (since > 0 && ctime < since) || (until > 0 && ctime > until) {
+			log.Skipped("list", media, OUTSIDE_TIME_WINDOW)
+			continue
+		}
+
+		kept = append(kept, media)
+	}
+
+	filtered := NewMediaList(kept)
+	filtered.pairing = library.pairing
+
+	return filtered, nil
+}
@@ -1,15 +1,43 @@
 package main
 
 import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
 	"bitbucket.org/sjbog/go-dbscan"
 )
 
+// The cluster-id given to media too far from any others to be clustered; DBSCAN's noise points
+const NoiseClusterId = -1
+
+// The folder unclustered media are copied into
+const UnclusteredLabel = "unclustered"
+
+// The folder photos below --reject-below are copied into, mirroring the cluster-folders
+const RejectsLabel = "rejects"
+
 /**
  *
  */
 type MediaCluster struct {
 	clusters int
 	entries  []Media
+	labels   map[int]string
+	parts    map[int]ClusterPart
+	// how many media DBSCAN couldn't cluster, however they were handled
+	noise int
+}
+
+/**
+ * Where a sub-cluster came from, when an oversized cluster was split; `parent` is the
+ * id of the first sub-cluster, and `part` counts from one
+ */
+type ClusterPart struct {
+	parent int
+	part   int
 }
 
 /**
@@ -20,11 +48,359 @@ func (clusters *MediaCluster) ClusterSize() int {
 	return clusters.clusters
 }
 
+/**
+ * Return the number of media that weren't assigned to any cluster
+ */
+func (cluster *MediaCluster) NoiseSize() int {
+	count := 0
+
+	for _, media := range cluster.entries {
+		if media.clusterId == NoiseClusterId {
+			count += 1
+		}
+	}
+
+	return count
+}
+
+/**
+ * Return the folder-name for a cluster
+ */
+func (cluster *MediaCluster) GetLabel(clusterId int) string {
+	if clusterId == NoiseClusterId {
+		return UnclusteredLabel
+	}
+
+	if label, ok := cluster.labels[clusterId]; ok {
+		return label
+	}
+
+	return fmt.Sprint(clusterId)
+}
+
+/**
+ * Return the cluster a sub-cluster was split from, or the cluster itself if it wasn't split
+ */
+func (cluster *MediaCluster) GetParent(clusterId int) int {
+	if part, ok := cluster.parts[clusterId]; ok {
+		return part.parent
+	}
+
+	return clusterId
+}
+
+/**
+ * Suffix a label with its part-number, if the cluster was split; e.g 2021-07-04_part2
+ */
+func (cluster *MediaCluster) PartLabel(clusterId int, label string) string {
+	if part, ok := cluster.parts[clusterId]; ok {
+		return label + "_part" + fmt.Sprint(part.part)
+	}
+
+	return label
+}
+
+/**
+ * Get the capture time each cluster starts at, as a unix time. Sub-clusters are counted with the
+ * cluster they were split from
+ */
+func (cluster *MediaCluster) ClusterStarts() map[int]int {
+	starts := make(map[int]int)
+
+	for idx := range cluster.entries {
+		media := &cluster.entries[idx]
+		clusterId := cluster.GetParent(media.clusterId)
+
+		if clusterId == NoiseClusterId {
+			continue
+		}
+
+		ctime := media.GetCreationTime()
+		if start, ok := starts[clusterId]; !ok || ctime < start {
+			starts[clusterId] = ctime
+		}
+	}
+
+	return starts
+}
+
+/**
+ * Label each cluster by the date it starts, and the place most of its photos were taken
+ * when known; e.g 2021-07-04_Dublin. Sub-clusters share the label of the cluster they were split from,
+ * plus their part-number
+ */
+func (cluster *MediaCluster) LabelClusters(geo *Geocoder) error {
+	starts := cluster.ClusterStarts()
+	places := make(map[int]map[string]int)
+
+	for idx := range cluster.entries {
+		media := &cluster.entries[idx]
+		clusterId := cluster.GetParent(media.clusterId)
+
+		if clusterId == NoiseClusterId {
+			continue
+		}
+
+		lat, lng, ok := media.GetLocation()
+		if !ok {
+			continue
+		}
+
+		place, err := geo.Lookup(lat, lng)
+		if err != nil {
+			return err
+		}
+
+		if len(place) == 0 {
+			continue
+		}
+
+		if places[clusterId] == nil {
+			places[clusterId] = make(map[string]int)
+		}
+		places[clusterId][place] += 1
+	}
+
+	labels := make(map[int]string)
+	seen := make(map[string]bool)
+
+	for clusterId := 0; clusterId < cluster.clusters; clusterId++ {
+		if cluster.GetParent(clusterId) != clusterId {
+			continue
+		}
+
+		label := time.Unix(int64(starts[clusterId]), 0).Format("2006-01-02")
+
+		if place := DominantPlace(places[clusterId]); len(place) > 0 {
+			label += "_" + place
+		}
+
+		// several events on one day (or in one place) need distinct folders
+		if seen[label] {
+			label += "_" + fmt.Sprint(clusterId)
+		}
+
+		seen[label] = true
+		labels[clusterId] = label
+	}
+
+	for clusterId := 0; clusterId < cluster.clusters; clusterId++ {
+		labels[clusterId] = cluster.PartLabel(clusterId, labels[cluster.GetParent(clusterId)])
+	}
+
+	cluster.labels = labels
+
+	for idx := range cluster.entries {
+		cluster.entries[idx].clusterLabel = cluster.GetLabel(cluster.entries[idx].clusterId)
+	}
+
+	return nil
+}
+
+/**
+ * Return the most frequent place, breaking ties alphabetically
+ */
+func DominantPlace(places map[string]int) string {
+	dominant := ""
+
+	for place, count := range places {
+		if count > places[dominant] || (count == places[dominant] && place < dominant) {
+			dominant = place
+		}
+	}
+
+	return dominant
+}
+
+/**
+ * Parse a --cluster-by value; a comma-separated list of the dimensions media are clustered
+ * along. Media are always clustered by time, and optionally by GPS location. Returns whether
+ * media are clustered by location
+ */
+func ParseClusterDimensions(text string) (bool, error) {
+	hasTime := false
+	hasGps := false
+
+	for _, part := range strings.Split(text, ",") {
+		switch strings.ToLower(strings.TrimSpace(part)) {
+		case "time":
+			hasTime = true
+		case "gps":
+			hasGps = true
+		default:
+			return false, fmt.Errorf("badger: unknown --cluster-by dimension '%v'; expected time or gps", part)
+		}
+	}
+
+	if !hasTime {
+		return false, fmt.Errorf("badger: --cluster-by must include time, e.g 'time' or 'time,gps'")
+	}
+
+	return hasGps, nil
+}
+
+/**
+ * Project each media's GPS location onto a flat plane in kilometres, scaled so that media
+ * `geoDistanceKm` apart are `epsilon` apart; the same distance as `epsilon` seconds.
+ *
+ * Media without a location are left out, so they're clustered by time alone. Returns nil if no
+ * media has a location.
+ */
+func GetGeoPoints(epsilon float64, geoDistanceKm float64, library *MediaList) map[string][]float64 {
+	const earthRadiusKm = 6371.0
+
+	located := []*Media{}
+	meanLat := 0.0
+
+	for _, media := range library.Values() {
+		if lat, _, ok := media.GetLocation(); ok {
+			located = append(located, media)
+			meanLat += lat
+		}
+	}
+
+	if len(located) == 0 {
+		return nil
+	}
+
+	// an equirectangular projection around the library's mean latitude
+	meanLat = meanLat / float64(len(located))
+	scale := epsilon / geoDistanceKm
+	lngScale := math.Cos(meanLat * math.Pi / 180)
+
+	points := make(map[string][]float64)
+
+	for _, media := range located {
+		lat, lng, _ := media.GetLocation()
+
+		points[media.source] = []float64{
+			earthRadiusKm * (lng * math.Pi / 180) * lngScale * scale,
+			earthRadiusKm * (lat * math.Pi / 180) * scale,
+		}
+	}
+
+	return points
+}
+
+/**
+ * The distance between two points, over the dimensions both have. Points start with a capture
+ * time, so media without a location are compared with others by time alone
+ */
+func PointDistance(first []float64, second []float64) float64 {
+	dims := len(first)
+	if len(second) < dims {
+		dims = len(second)
+	}
+
+	sum := 0.0
+	for dim := 0; dim < dims; dim++ {
+		diff := first[dim] - second[dim]
+		sum += diff * diff
+	}
+
+	return math.Sqrt(sum)
+}
+
+/**
+ * Cluster points with DBSCAN, measuring them by PointDistance; the dbscan package compares every
+ * dimension, so can't cluster media with a location alongside media without. Points further apart
+ * in time than `epsilon` can't be neighbours, so each point's neighbours are searched for in time
+ * order. Returns the indices of each cluster's points; points in no cluster are noise
+ */
+func ClusterPoints(points [][]float64, epsilon float64, minPoints int) [][]int {
+	const unvisited, noise = -2, -1
+
+	order := make([]int, len(points))
+	for idx := range order {
+		order[idx] = idx
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		return points[order[i]][0] < points[order[j]][0]
+	})
+
+	rank := make([]int, len(points))
+	for pos, idx := range order {
+		rank[idx] = pos
+	}
+
+	// every point within epsilon of a point, including itself
+	neighbours := func(idx int) []int {
+		found := []int{}
+
+		for pos := rank[idx]; pos >= 0 && points[idx][0]-points[order[pos]][0] <= epsilon; pos-- {
+			if PointDistance(points[idx], points[order[pos]]) <= epsilon {
+				found = append(found, order[pos])
+			}
+		}
+
+		for pos := rank[idx] + 1; pos < len(order) && points[order[pos]][0]-points[idx][0] <= epsilon; pos++ {
+			if PointDistance(points[idx], points[order[pos]]) <= epsilon {
+				found = append(found, order[pos])
+			}
+		}
+
+		return found
+	}
+
+	labels := make([]int, len(points))
+	for idx := range labels {
+		labels[idx] = unvisited
+	}
+
+	clusters := [][]int{}
+
+	for _, idx := range order {
+		if labels[idx] != unvisited {
+			continue
+		}
+
+		seeds := neighbours(idx)
+		if len(seeds) < minPoints {
+			labels[idx] = noise
+			continue
+		}
+
+		clusterId := len(clusters)
+		labels[idx] = clusterId
+		members := []int{idx}
+
+		for len(seeds) > 0 {
+			next := seeds[0]
+			seeds = seeds[1:]
+
+			// noise reachable from a core point borders the cluster, but doesn't extend it
+			if labels[next] == noise {
+				labels[next] = clusterId
+				members = append(members, next)
+				continue
+			}
+
+			if labels[next] != unvisited {
+				continue
+			}
+
+			labels[next] = clusterId
+			members = append(members, next)
+
+			if reachable := neighbours(next); len(reachable) >= minPoints {
+				seeds = append(seeds, reachable...)
+			}
+		}
+
+		clusters = append(clusters, members)
+	}
+
+	return clusters
+}
+
 /**
  * Apply DBSCAN clustering to a set of media, based on their creation times. Apply this to all
- * files present.
+ * files present. When `geoDistanceKm` is positive media are also clustered by location, so
+ * events close in time but far apart are split. Media DBSCAN can't cluster are handled by the
+ * noise policy; kept with the noise cluster-id, added to the nearest cluster, or dropped.
  */
-func ClusterMedia(epsilon float64, minPoints int, library *MediaList) *MediaCluster {
+func ClusterMedia(epsilon float64, minPoints int, geoDistanceKm float64, noise NoisePolicy, library *MediaList) *MediaCluster {
 	// create the clusterer
 	var clusterer = dbscan.NewDBSCANClusterer(epsilon, minPoints)
 	clusterer.AutoSelectDimension = false
@@ -32,22 +408,54 @@ func ClusterMedia(epsilon float64, minPoints int, library *MediaList) *MediaClus
 
 	// create a clusterable data-array
 	var data = make([]dbscan.ClusterablePoint, library.Size())
+	var points = make([][]float64, library.Size())
 	var mediaDict = make(map[string]Media)
+	var pointDict = make(map[string][]float64)
 
-	for idx, media := range library.Values() {
-		mediaDict[media.source] = *media
+	var geoPoints map[string][]float64
+	if geoDistanceKm > 0 {
+		geoPoints = GetGeoPoints(epsilon, geoDistanceKm, library)
+	}
 
+	for idx, media := range library.Values() {
 		// create a named point, with the file as the name and the mtime as a
 		// dimension it is clustered along
+		point := []float64{float64(media.GetCreationTime())}
+
+		// media without a location are only placed in time
+		if location, ok := geoPoints[media.source]; ok {
+			point = append(point, location...)
+		}
+
 		data[idx] = &dbscan.NamedPoint{
 			Name:  media.source,
-			Point: []float64{float64(media.GetCreationTime())},
+			Point: point,
 		}
+
+		mediaDict[media.source] = *media
+		pointDict[media.source] = point
+		points[idx] = point
 	}
 
 	// cluster the media, and restructure the data for use later
-	clusters := clusterer.Cluster(data)
+	var clusters [][]dbscan.ClusterablePoint
+
+	if geoPoints != nil {
+		for _, members := range ClusterPoints(points, epsilon, minPoints) {
+			cluster := make([]dbscan.ClusterablePoint, len(members))
+			for idx, member := range members {
+				cluster[idx] = data[member]
+			}
+
+			clusters = append(clusters, cluster)
+		}
+	} else {
+		clusters = clusterer.Cluster(data)
+	}
 	labelledMedia := make([]Media, 0)
+	clustered := make(map[string]bool)
+	clusteredPoints := [][]float64{}
+	clusteredIds := []int{}
 
 	for clusterId, cluster := range clusters {
 		clusterList := make([]Media, len(cluster))
@@ -59,31 +467,206 @@ func ClusterMedia(epsilon float64, minPoints int, library *MediaList) *MediaClus
 			media.clusterId = clusterId
 
 			clusterList[idx] = media
+			clustered[fpath] = true
+			clusteredPoints = append(clusteredPoints, pointDict[fpath])
+			clusteredIds = append(clusteredIds, clusterId)
 		}
 
 		labelledMedia = append(labelledMedia, clusterList...)
 	}
 
+	// DBSCAN drops noise points; unless skipping them, keep them so lone photos are still copied
+	noiseCount := 0
+
+	for _, media := range library.Values() {
+		if clustered[media.source] {
+			continue
+		}
+
+		noiseCount += 1
+		if noise == SKIP_NOISE {
+			continue
+		}
+
+		lone := mediaDict[media.source]
+		lone.clusterId = NoiseClusterId
+		lone.clusterLabel = UnclusteredLabel
+
+		if noise == ASSIGN_NEAREST {
+			lone.clusterId = NearestCluster(pointDict[media.source], clusteredPoints, clusteredIds)
+			if lone.clusterId != NoiseClusterId {
+				lone.clusterLabel = ""
+			}
+		}
+
+		labelledMedia = append(labelledMedia, lone)
+	}
+
 	// return number of clusters, and the clustered media-entries
 	return &MediaCluster{
 		clusters: len(clusters),
 		entries:  labelledMedia,
+		noise:    noiseCount,
 	}
 }
 
 /**
- *
+ * Split clusters with more than `maxSize` members into sequential sub-clusters, ordered by
+ * capture time. Media sharing a prefix (e.g a RAW image & its JPEG) stay in the same sub-cluster,
+ * so a sub-cluster can exceed `maxSize` only when a single prefix does. Cluster ids are renumbered
+ */
+func (cluster *MediaCluster) SplitClusters(maxSize int) {
+	byCluster := make(map[int][]int)
+
+	for idx, media := range cluster.entries {
+		byCluster[media.clusterId] = append(byCluster[media.clusterId], idx)
+	}
+
+	ids := make([]int, len(cluster.entries))
+	parts := make(map[int]ClusterPart)
+	labels := make(map[int]string)
+	nextId := 0
+
+	for clusterId := 0; clusterId < cluster.clusters; clusterId++ {
+		indices := byCluster[clusterId]
+
+		// group siblings together, ordered by their earliest capture time
+		groups := [][]int{}
+		groupOf := make(map[string]int)
+
+		for _, idx := range indices {
+			prefix := cluster.entries[idx].GetPrefix()
+
+			if group, ok := groupOf[prefix]; ok {
+				groups[group] = append(groups[group], idx)
+				continue
+			}
+
+			groupOf[prefix] = len(groups)
+			groups = append(groups, []int{idx})
+		}
+
+		earliest := func(group []int) int {
+			start := math.MaxInt
+			for _, idx := range group {
+				if ctime := cluster.entries[idx].GetCreationTime(); ctime < start {
+					start = ctime
+				}
+			}
+			return start
+		}
+
+		sort.SliceStable(groups, func(i, j int) bool {
+			return earliest(groups[i]) < earliest(groups[j])
+		})
+
+		// fill each sub-cluster until the next group would overflow it
+		split := [][]int{}
+		current := []int{}
+
+		for _, group := range groups {
+			if len(current) > 0 && len(current)+len(group) > maxSize {
+				split = append(split, current)
+				current = []int{}
+			}
+
+			current = append(current, group...)
+		}
+
+		if len(current) > 0 {
+			split = append(split, current)
+		}
+
+		parent := nextId
+
+		for part, members := range split {
+			if len(split) > 1 {
+				parts[nextId] = ClusterPart{parent, part + 1}
+			}
+
+			for _, idx := range members {
+				ids[idx] = nextId
+			}
+
+			nextId += 1
+		}
+	}
+
+	cluster.clusters = nextId
+	cluster.parts = parts
+
+	for clusterId := 0; clusterId < cluster.clusters; clusterId++ {
+		labels[clusterId] = cluster.PartLabel(clusterId, fmt.Sprint(cluster.GetParent(clusterId)))
+	}
+
+	cluster.labels = labels
+
+	for idx := range cluster.entries {
+		// unclustered media are never split
+		if cluster.entries[idx].clusterId == NoiseClusterId {
+			continue
+		}
+
+		cluster.entries[idx].clusterId = ids[idx]
+		cluster.entries[idx].clusterLabel = labels[ids[idx]]
+	}
+}
+
+/**
+ * Group the photos in each cluster by cluster-id. Returns indices into the cluster entries.
  */
-func (cluster *MediaCluster) GetByPrefix(media *Media) []*Media {
-	prefix := media.GetPrefix()
+func (cluster *MediaCluster) GetPhotosByCluster() map[int][]int {
+	byCluster := make(map[int][]int)
+
+	for idx, media := range cluster.entries {
+		if media.GetType() == PHOTO {
+			byCluster[media.clusterId] = append(byCluster[media.clusterId], idx)
+		}
+	}
 
-	matches := []*Media{}
+	return byCluster
+}
+
+/**
+ * Group the photos in each cluster into bursts; each frame in a burst was taken within
+ * `window` seconds of the previous frame. Returns indices into the cluster entries.
+ */
+func (cluster *MediaCluster) GetBursts(window float64) [][]int {
+	ctimes := make(map[int]int)
+	byCluster := make(map[int][]int)
+
+	for idx, media := range cluster.entries {
+		if media.GetType() != PHOTO {
+			continue
+		}
+
+		ctimes[idx] = media.GetCreationTime()
+		byCluster[media.clusterId] = append(byCluster[media.clusterId], idx)
+	}
+
+	bursts := [][]int{}
+
+	for _, indices := range byCluster {
+		sort.SliceStable(indices, func(i, j int) bool {
+			return ctimes[indices[i]] < ctimes[indices[j]]
+		})
+
+		burst := []int{}
+
+		for _, idx := range indices {
+			// start a new burst once frames drift too far apart
+			if len(burst) > 0 && float64(ctimes[idx]-ctimes[burst[len(burst)-1]]) > window {
+				bursts = append(bursts, burst)
+				burst = []int{}
+			}
+
+			burst = append(burst, idx)
+		}
 
-	for _, candidate := range cluster.entries {
-		if candidate.GetPrefix() == prefix {
-			matches = append(matches, &candidate)
+		if len(burst) > 0 {
+			bursts = append(bursts, burst)
 		}
 	}
 
-	return matches
+	return bursts
 }
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+/*
+ * Media without a location are compared with others by time alone, rather than borrowing a location
+ */
+func TestPointDistance(t *testing.T) {
+	cases := []struct {
+		first    []float64
+		second   []float64
+		expected float64
+	}{
+		{[]float64{0, 3, 4}, []float64{0, 0, 0}, 5},
+		{[]float64{0, 3, 4}, []float64{6}, 6},
+		{[]float64{6}, []float64{0, 3, 4}, 6},
+		{[]float64{2}, []float64{5}, 3},
+	}
+
+	for _, tc := range cases {
+		if actual := PointDistance(tc.first, tc.second); actual != tc.expected {
+			t.Errorf("expected the distance between %v and %v to be %v, got %v", tc.first, tc.second, tc.expected, actual)
+		}
+	}
+}
+
+func TestClusterPoints(t *testing.T) {
+	cases := []struct {
+		name      string
+		points    [][]float64
+		minPoints int
+		expected  [][]int
+	}{
+		{"close in time but far apart", [][]float64{{0, 0, 0}, {10, 1000, 0}}, 1, [][]int{{0}, {1}}},
+		{"close in time and place", [][]float64{{0, 0, 0}, {10, 5, 5}}, 1, [][]int{{0, 1}}},
+		{"close in time, without a location", [][]float64{{0, 1000, 0}, {10}}, 1, [][]int{{0, 1}}},
+		{"far apart in time, without a location", [][]float64{{0, 0, 0}, {100}}, 1, [][]int{{0}, {1}}},
+		{"too few neighbours", [][]float64{{0}, {1}, {2}, {100}}, 3, [][]int{{0, 1, 2}}},
+		{"chained through time", [][]float64{{30}, {0}, {15}, {45}}, 2, [][]int{{0, 1, 2, 3}}},
+	}
+
+	for _, tc := range cases {
+		actual := ClusterPoints(tc.points, 20, tc.minPoints)
+
+		for _, cluster := range actual {
+			sort.Ints(cluster)
+		}
+
+		if !reflect.DeepEqual(actual, tc.expected) {
+			t.Errorf("expected points %v to be clustered as %v, got %v", tc.name, tc.expected, actual)
+		}
+	}
+}
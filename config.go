@@ -0,0 +1,359 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/docopt/docopt-go"
+	"gopkg.in/yaml.v3"
+)
+
+// Short flags, and the long flags they stand for
+var ShortFlags = map[string]string{
+	"-s": "--max-seconds-diff",
+	"-m": "--min-points",
+	"-q": "--quiet",
+	"-y": "--yes",
+	"-h": "--help",
+}
+
+// Long flags, as named in the usage text; short flags are listed alongside them
+var LongFlagPattern = regexp.MustCompile(`--[a-z][a-z0-9-]*`)
+
+// Short flags that take a value, which may be attached to them (e.g `-s30`)
+var ShortValueFlags = map[string]bool{
+	"-s": true,
+	"-m": true,
+}
+
+// Sets of alternative flags; at most one of each may be set
+var ExclusiveGroups = [][]string{
+	{"--since", "--after"},
+	{"--until", "--before"},
+	{"--no-preserve-times", "--preserve"},
+	{"--symlink", "--link", "--move"},
+	{"--layout", "--flatten"},
+}
+
+// Flags only ever taken from the command-line, for some or all (*) subcommands; a config file shared by
+// every subcommand mustn't skip undo's confirmation, or widen which runs it removes
+var CommandLineOnlyFlags = map[string][]string{
+	"*":      {"--yes"},
+	"undo":   {"--since", "--run"},
+	"verify": {"--run"},
+	"runs":   {"--since", "--run"},
+}
+
+/*
+ * Get the subcommand the parsed options select, like 'cluster' or 'db query', and the long flags its
+ * usage line accepts. Returns an empty command when no usage line matches
+ */
+func CommandFlags(usage string, opts docopt.Opts) (string, map[string]bool) {
+	for _, line := range strings.Split(usage, "\n") {
+		words := strings.Fields(line)
+		if len(words) < 2 || words[0] != "badger" {
+			continue
+		}
+
+		// the subcommand is named by the words before the first flag or argument
+		command := []string{}
+		for _, word := range words[1:] {
+			if strings.ContainsAny(word[:1], "-[<(") {
+				break
+			}
+
+			command = append(command, word)
+		}
+
+		selected := len(command) > 0
+		for _, word := range command {
+			if given, _ := opts.Bool(word); !given {
+				selected = false
+			}
+		}
+
+		if !selected {
+			continue
+		}
+
+		flags := make(map[string]bool)
+		for _, flag := range LongFlagPattern.FindAllString(line, -1) {
+			flags[flag] = true
+		}
+
+		return strings.Join(command, " "), flags
+	}
+
+	return "", map[string]bool{}
+}
+
+/*
+ * Can the config file set a flag for a subcommand? Only flags in the subcommand's usage can be set,
+ * and never those taken only from the command-line
+ */
+func ConfigSets(command string, flags map[string]bool, flag string) bool {
+	if !flags[flag] {
+		return false
+	}
+
+	for _, scope := range []string{"*", command} {
+		for _, excluded := range CommandLineOnlyFlags[scope] {
+			if flag == excluded {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+/*
+ * Get the config file auto-discovered when --config isn't given; ~/.config/badger/config.yaml
+ */
+func DefaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(dir, "badger", "config.yaml")
+}
+
+/*
+ * Was a flag given on the command-line, either by its long or short name?
+ */
+func FlagGiven(args []string, flag string) bool {
+	for _, arg := range args {
+		if arg == "--" {
+			return false
+		}
+
+		if arg == flag || strings.HasPrefix(arg, flag+"=") {
+			return true
+		}
+
+		if strings.HasPrefix(arg, "--") || !strings.HasPrefix(arg, "-") {
+			continue
+		}
+
+		// short flags can be combined, like `-qy`; a flag taking a value ends the combination
+		for _, char := range arg[1:] {
+			short := "-" + string(char)
+
+			if ShortFlags[short] == flag {
+				return true
+			}
+
+			if ShortValueFlags[short] {
+				break
+			}
+		}
+	}
+
+	return false
+}
+
+/*
+ * Was a flag, or any flag it's exclusive with, given on the command-line?
+ */
+func GroupGiven(args []string, flag string) bool {
+	for _, group := range ExclusiveGroups {
+		for _, member := range group {
+			if member != flag {
+				continue
+			}
+
+			for _, alternative := range group {
+				if FlagGiven(args, alternative) {
+					return true
+				}
+			}
+		}
+	}
+
+	return FlagGiven(args, flag)
+}
+
+/*
+ * Check at most one of a set of alternative flags was set, on the command-line or by the config file
+ */
+func ExclusiveFlags(opts docopt.Opts, flags ...string) error {
+	set := []string{}
+
+	for _, flag := range flags {
+		switch value := opts[flag].(type) {
+		case bool:
+			if value {
+				set = append(set, flag)
+			}
+		case string:
+			set = append(set, flag)
+		case []string:
+			if len(value) > 0 {
+				set = append(set, flag)
+			}
+		}
+	}
+
+	if len(set) > 1 {
+		return fmt.Errorf("badger: %v can't be used together", strings.Join(set, " and "))
+	}
+
+	return nil
+}
+
+/*
+ * Convert a config value to the type docopt stores for a flag; a bool for switches, a list
+ * for repeated flags, and a string for everything else
+ */
+func ConfigValue(key string, current interface{}, value interface{}) (interface{}, error) {
+	switch current.(type) {
+	case bool:
+		flag, ok := value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("badger: config key '%v' must be true or false", key)
+		}
+
+		return flag, nil
+	case []string:
+		values, ok := value.([]interface{})
+		if !ok {
+			values = []interface{}{value}
+		}
+
+		strs := make([]string, len(values))
+		for idx, item := range values {
+			strs[idx] = fmt.Sprint(item)
+		}
+
+		return strs, nil
+	}
+
+	if _, ok := value.([]interface{}); ok {
+		return nil, fmt.Errorf("badger: config key '%v' takes a single value", key)
+	}
+
+	// YAML reads unquoted dates, like 'since: 2021-07-01', as times
+	if date, ok := value.(time.Time); ok {
+		if date.Equal(date.Truncate(24 * time.Hour)) {
+			return date.Format("2006-01-02"), nil
+		}
+
+		return date.Format(time.RFC3339), nil
+	}
+
+	return fmt.Sprint(value), nil
+}
+
+/*
+ * Overlay a named profile's values onto a config's top-level values. Profiles are listed under
+ * the config's `profiles` key, and are themselves keyed like the top-level config
+ */
+func SelectProfile(config map[string]interface{}, profile string, path string) error {
+	profiles := map[string]interface{}{}
+
+	if listed, ok := config["profiles"]; ok {
+		profiles, ok = listed.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("badger: 'profiles' in config file %v must map profile names to flag values", path)
+		}
+
+		delete(config, "profiles")
+	}
+
+	if len(profile) == 0 {
+		return nil
+	}
+
+	selected, ok := profiles[profile]
+	if !ok {
+		return fmt.Errorf("badger: no profile '%v' in config file %v", profile, path)
+	}
+
+	values, ok := selected.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("badger: profile '%v' in config file %v must map flag names to values", profile, path)
+	}
+
+	for key, value := range values {
+		config[key] = value
+	}
+
+	return nil
+}
+
+/*
+ * Default options from a YAML config file, whose keys mirror the command-line flags without
+ * their dashes (e.g `max-seconds-diff: 30m`). Flags given on the command-line take precedence
+ * over the selected profile, then the rest of the config file, then the defaults in the usage
+ * text; setting one of a set of alternative flags on the command-line drops the config's values
+ * for the others. Only flags the invoked subcommand accepts are set, and never --yes. When `path` is
+ * empty, the default config path is read if it exists
+ */
+func ApplyConfig(opts docopt.Opts, path string, profile string, args []string) error {
+	explicit := len(path) > 0
+	if !explicit {
+		path = DefaultConfigPath()
+	}
+
+	if len(path) == 0 {
+		return nil
+	}
+
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !explicit {
+		if len(profile) > 0 {
+			return fmt.Errorf("badger: --profile '%v' was given, but there's no config file at %v", profile, path)
+		}
+
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("badger: failed to read config file %v: %v", path, err)
+	}
+
+	config := map[string]interface{}{}
+	if err := yaml.Unmarshal(content, &config); err != nil {
+		return fmt.Errorf("badger: failed to parse config file %v: %v", path, err)
+	}
+
+	if err := SelectProfile(config, profile, path); err != nil {
+		return err
+	}
+
+	// a config file is shared by every subcommand, so only sets the flags of the one invoked
+	command, flags := CommandFlags(Usage, opts)
+
+	for key, value := range config {
+		flag := "--" + key
+
+		current, ok := opts[flag]
+		if !ok || flag == "--config" || flag == "--profile" || flag == "--help" {
+			return fmt.Errorf("badger: unknown key '%v' in config file %v", key, path)
+		}
+
+		if !ConfigSets(command, flags, flag) {
+			continue
+		}
+
+		// a flag given on the command-line overrides its alternatives in the config too
+		if GroupGiven(args, flag) {
+			continue
+		}
+
+		converted, err := ConfigValue(key, current, value)
+		if err != nil {
+			return err
+		}
+
+		opts[flag] = converted
+	}
+
+	return nil
+}
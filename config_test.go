@@ -0,0 +1,211 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/docopt/docopt-go"
+)
+
+func TestFlagGiven(t *testing.T) {
+	cases := []struct {
+		args     []string
+		flag     string
+		expected bool
+	}{
+		{[]string{"--yes"}, "--yes", true},
+		{[]string{"-y"}, "--yes", true},
+		{[]string{"--max-seconds-diff=30"}, "--max-seconds-diff", true},
+		{[]string{"-qy"}, "--yes", true},
+		{[]string{"-qy"}, "--quiet", true},
+		{[]string{"-yq"}, "--quiet", true},
+		{[]string{"-q"}, "--yes", false},
+		{[]string{"-s30"}, "--max-seconds-diff", true},
+		{[]string{"-qs30"}, "--max-seconds-diff", true},
+		{[]string{"-sy"}, "--yes", false},
+		{[]string{"--", "-y"}, "--yes", false},
+		{[]string{"--yes-please"}, "--yes", false},
+	}
+
+	for _, tc := range cases {
+		if actual := FlagGiven(tc.args, tc.flag); actual != tc.expected {
+			t.Errorf("expected FlagGiven(%v, %v) to be %v, but was %v", tc.args, tc.flag, tc.expected, actual)
+		}
+	}
+}
+
+/*
+ * Parse a cluster command-line, then default its unset flags from a config file
+ */
+func ParseTestArgs(t *testing.T, config string, args ...string) docopt.Opts {
+	t.Helper()
+
+	return ParseTestCommand(t, config, append([]string{"cluster", "--to", t.TempDir()}, args...)...)
+}
+
+/*
+ * Parse any command-line, then default its unset flags from a config file
+ */
+func ParseTestCommand(t *testing.T, config string, argv ...string) docopt.Opts {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	WriteTestFile(t, path, config)
+
+	opts, err := docopt.ParseArgs(Usage, argv, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ApplyConfig(opts, path, "", argv); err != nil {
+		t.Fatal(err)
+	}
+
+	return opts
+}
+
+/*
+ * A flag given on the command-line drops the config's values for its alternatives, so they
+ * aren't reported as used together
+ */
+func TestApplyConfigDropsExclusiveAlternatives(t *testing.T) {
+	cases := []struct {
+		name    string
+		config  string
+		args    []string
+		dropped string
+	}{
+		{"--move over symlink", "symlink: true\n", []string{"--move"}, "--symlink"},
+		{"--symlink over link", "link: hard\n", []string{"--symlink"}, "--link"},
+		{"--flatten over layout", "layout: '{year}'\n", []string{"--flatten"}, "--layout"},
+		{"--preserve over no-preserve-times", "no-preserve-times: true\n", []string{"--preserve", "times"}, "--no-preserve-times"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := ParseTestArgs(t, tc.config, tc.args...)
+
+			switch value := opts[tc.dropped].(type) {
+			case bool:
+				if value {
+					t.Errorf("expected %v from the config to be dropped", tc.dropped)
+				}
+			case string:
+				t.Errorf("expected %v from the config to be dropped, but it was %v", tc.dropped, value)
+			}
+
+			for _, group := range ExclusiveGroups {
+				if err := ExclusiveFlags(opts, group...); err != nil {
+					t.Error(err)
+				}
+			}
+		})
+	}
+}
+
+/*
+ * Flags given as combined short flags override the config, and unrelated config values are kept
+ */
+func TestApplyConfigKeepsUnrelatedValues(t *testing.T) {
+	opts := ParseTestArgs(t, "symlink: true\nverify: true\nyes: false\n", "-qy")
+
+	if yes, _ := opts.Bool("--yes"); !yes {
+		t.Error("expected -qy on the command-line to override yes from the config")
+	}
+
+	if symlink, _ := opts.Bool("--symlink"); !symlink {
+		t.Error("expected symlink from the config to be kept")
+	}
+
+	if verify, _ := opts.Bool("--verify"); !verify {
+		t.Error("expected verify from the config to be kept")
+	}
+}
+
+/*
+ * A config file is shared by every subcommand, so sets only the flags of the one invoked
+ */
+func TestApplyConfigOnlySetsCommandFlags(t *testing.T) {
+	config := "since: 2021-07-01\nmax-cluster-size: 50\nhash: md5\n"
+
+	cluster := ParseTestCommand(t, config, "cluster", "--to", t.TempDir())
+
+	if since, _ := cluster["--since"].(string); since != "2021-07-01" {
+		t.Errorf("expected cluster to take --since from the config, got %v", cluster["--since"])
+	}
+
+	copied := ParseTestCommand(t, config, "copy", "--from", "*.jpg", "--to", t.TempDir())
+
+	if size, ok := copied["--max-cluster-size"].(string); ok {
+		t.Errorf("expected copy not to take --max-cluster-size from the config, got %v", size)
+	}
+
+	if hash, _ := copied["--hash"].(string); hash != "md5" {
+		t.Errorf("expected copy to take --hash from the config, got %v", copied["--hash"])
+	}
+
+	undo := ParseTestCommand(t, config, "undo", "--db", t.TempDir())
+
+	if since, ok := undo["--since"].(string); ok {
+		t.Errorf("expected undo not to take --since from the config, got %v", since)
+	}
+}
+
+/*
+ * Extension mappings apply to every command that lists media, not just cluster
+ */
+func TestMapExtensionsForEachListingCommand(t *testing.T) {
+	for _, argv := range [][]string{
+		{"cluster", "--to", t.TempDir(), "--map-ext", ".cr3=raw"},
+		{"copy", "--from", "*.cr3", "--to", t.TempDir(), "--map-ext", ".cr3=raw"},
+		{"index", "--from", "*.cr3", "--to", t.TempDir(), "--map-ext", ".cr3=raw"},
+		{"copy", "--from", "*.cr3", "--to", t.TempDir()},
+	} {
+		opts := ParseTestCommand(t, "map-ext:\n  - .cr3=raw\n", argv...)
+
+		mappings, _ := opts["--map-ext"].([]string)
+		if len(mappings) != 1 || mappings[0] != ".cr3=raw" {
+			t.Errorf("expected %v to take --map-ext .cr3=raw, got %v", argv, opts["--map-ext"])
+		}
+	}
+}
+
+/*
+ * Confirmations are only skipped from the command-line, and which runs undo removes only chosen there
+ */
+func TestApplyConfigIgnoresCommandLineOnlyFlags(t *testing.T) {
+	config := "yes: true\nrun: 2021-07-01T00:00:00.000000000Z\n"
+
+	for _, argv := range [][]string{
+		{"cluster", "--to", t.TempDir()},
+		{"undo", "--db", t.TempDir()},
+		{"verify", "--db", t.TempDir()},
+	} {
+		opts := ParseTestCommand(t, config, argv...)
+
+		if yes, _ := opts.Bool("--yes"); yes {
+			t.Errorf("expected %v not to take --yes from the config", argv[0])
+		}
+
+		if run, ok := opts["--run"].(string); ok {
+			t.Errorf("expected %v not to take --run from the config, got %v", argv[0], run)
+		}
+	}
+}
+
+func TestCommandFlags(t *testing.T) {
+	opts, err := docopt.ParseArgs(Usage, []string{"db", "query", "--db", "library", "--blurriest"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	command, flags := CommandFlags(Usage, opts)
+
+	if command != "db query" {
+		t.Errorf("expected the db query command, got '%v'", command)
+	}
+
+	if !flags["--blurriest"] || !flags["--db"] || flags["--out"] {
+		t.Errorf("expected the db query command's flags, got %v", flags)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// The content already at the destination, by hash, so --skip-same-content never copies the same content
+// twice; content earlier runs copied, content copied earlier in this run, and with --scan-to, files
+// already beneath --to
+type ContentIndex struct {
+	lock        sync.Mutex
+	db          *BadgerDb
+	destination Destination
+	// the destination each hash was copied to by this run, or found at by --scan-to
+	copied map[string]string
+	// files found by --scan-to that aren't hashed yet, by size; only files the same size as a media can match it
+	unhashed map[int64][]string
+}
+
+/*
+ * Construct a content index. When scanning, list the files already beneath a local --to; hidden files,
+ * like the database and thumbnails, are skipped
+ */
+func NewContentIndex(db *BadgerDb, destination Destination, dstDir string, scan bool) (*ContentIndex, error) {
+	index := ContentIndex{
+		db:          db,
+		destination: destination,
+		copied:      map[string]string{},
+		unhashed:    map[int64][]string{},
+	}
+
+	if !scan {
+		return &index, nil
+	}
+
+	err := filepath.WalkDir(dstDir, func(fpath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if fpath != dstDir && strings.HasPrefix(entry.Name(), ".") {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		index.unhashed[info.Size()] = append(index.unhashed[info.Size()], fpath)
+		return nil
+	})
+
+	return &index, err
+}
+
+/*
+ * Find where a media's content was already copied to, or otherwise claim its content for its own
+ * destination so other media with the same content aren't copied. Returns the existing copy, or an
+ * empty string if there wasn't one
+ */
+func (index *ContentIndex) Claim(media *Media) (string, error) {
+	hash, err := media.GetHash()
+	if err != nil {
+		return "", err
+	}
+
+	size, err := media.Size()
+	if err != nil {
+		return "", err
+	}
+
+	index.lock.Lock()
+	defer index.lock.Unlock()
+
+	if existing, ok := index.copied[hash]; ok {
+		return existing, nil
+	}
+
+	// earlier runs' copies only count if they're still there
+	row, found, err := index.db.GetCopyByHash(hash, media.hashAlgorithm, media.runId)
+	if err != nil {
+		return "", err
+	}
+
+	if found {
+		if _, err := index.destination.Stat(row.dst); err == nil {
+			index.copied[hash] = row.dst
+			return row.dst, nil
+		}
+	}
+
+	// hash files found by --scan-to lazily, and only if they could match
+	candidates := index.unhashed[size]
+	delete(index.unhashed, size)
+
+	for _, candidate := range candidates {
+		candidateHash, err := GetHash(candidate, media.hashAlgorithm)
+		if err != nil {
+			continue
+		}
+
+		if _, ok := index.copied[candidateHash]; !ok {
+			index.copied[candidateHash] = candidate
+		}
+	}
+
+	if existing, ok := index.copied[hash]; ok {
+		return existing, nil
+	}
+
+	index.copied[hash] = media.GetDestinationPath()
+
+	return "", nil
+}
+
+/*
+ * Release a claim on some content, if copying it to a destination failed, so other media with the same content can be copied
+ */
+func (index *ContentIndex) Release(hash string, dst string) {
+	index.lock.Lock()
+	defer index.lock.Unlock()
+
+	if index.copied[hash] == dst {
+		delete(index.copied, hash)
+	}
+}
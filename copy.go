@@ -0,0 +1,403 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Which media `badger copy` copies
+type MediaFilter struct {
+	kind            string
+	maxIso          float64
+	maxExposureTime float64
+	// blur-score bounds; zero when unbounded
+	minBlur float64
+	maxBlur float64
+}
+
+/*
+ * Parse a shutter speed, either as a fraction of a second like 1/250, or as seconds like 0.5
+ */
+func ParseShutterSpeed(text string) (float64, error) {
+	parts := strings.SplitN(text, "/", 2)
+
+	num, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil || num <= 0 {
+		return 0, fmt.Errorf("badger: could not parse shutter speed '%v'; expected a fraction like 1/250, or seconds like 0.5", text)
+	}
+
+	if len(parts) == 1 {
+		return num, nil
+	}
+
+	den, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil || den <= 0 {
+		return 0, fmt.Errorf("badger: could not parse shutter speed '%v'; expected a fraction like 1/250, or seconds like 0.5", text)
+	}
+
+	return num / den, nil
+}
+
+/*
+ * Parse a --media type; all, or one of the media types
+ */
+func ParseMediaKind(name string) (string, error) {
+	switch name {
+	case "all", string(PHOTO), RAW, VIDEO, UNKNOWN:
+		return name, nil
+	}
+
+	return "", fmt.Errorf("badger: unsupported --media '%v'; expected all, photo, raw, video or unknown", name)
+}
+
+/*
+ * Does a media pass the filter? Media without a recorded ISO or shutter speed, like videos,
+ * aren't filtered by them
+ */
+func (filter MediaFilter) Matches(media *Media) bool {
+	if filter.kind != "all" && string(media.GetType()) != filter.kind {
+		return false
+	}
+
+	info, err := media.GetInformation()
+	if err != nil {
+		return false
+	}
+
+	if filter.maxIso > 0 && info.IsoValue > 0 && info.IsoValue > filter.maxIso {
+		return false
+	}
+
+	// a faster shutter speed is a shorter exposure
+	if filter.maxExposureTime > 0 && info.ShutterSeconds > 0 && info.ShutterSeconds > filter.maxExposureTime {
+		return false
+	}
+
+	return true
+}
+
+/*
+ * Keep only media passing a filter
+ */
+func (library *MediaList) Filter(filter MediaFilter) *MediaList {
+	kept := []*Media{}
+
+	for _, media := range library.Values() {
+		if filter.Matches(media) {
+			kept = append(kept, media)
+		}
+	}
+
+	filtered := NewMediaList(kept)
+	filtered.pairing = library.pairing
+
+	return filtered
+}
+
+/*
+ * Get a photo's blur-score, reading it from the database when an earlier run graded it the same way,
+ * and grading it otherwise (or when there's no database). Reports whether the photo could be scored;
+ * photos badger can't decode can't be
+ */
+func StoredBlur(db *BadgerDb, media *Media) (float64, bool, error) {
+	if db != nil {
+		row, err := db.GetMedia(media)
+		if err != nil {
+			return 0, false, err
+		}
+
+		if row.blur > 0 && row.metric == media.GetSharpnessMetric() && row.gradeEdge == media.gradeMaxEdge {
+			return float64(row.blur), true, nil
+		}
+
+		cached, ok, err := db.GetCachedGrade(media)
+		if err != nil {
+			return 0, false, err
+		}
+
+		if ok && cached.blur > 0 {
+			return float64(cached.blur), true, nil
+		}
+	}
+
+	// the grade is memoised, so photos aren't decoded again when copied
+	blur, err := media.Grade()
+	if err != nil {
+		return 0, false, nil
+	}
+
+	return blur, true, nil
+}
+
+/*
+ * Get the blur-score of each media graded to decide its pair's fate, by source, with a pool of
+ * workers. Each is graded once, by one worker, however many media share it. Media that can't be
+ * scored are left out
+ */
+func (library *MediaList) StoredBlurs(procCount int, db *BadgerDb, quiet bool) (map[string]float64, error) {
+	sources := []*Media{}
+	for _, media := range library.Values() {
+		if library.IsGraded(media) {
+			sources = append(sources, media)
+		}
+	}
+
+	counter := NewProgressCounter("Grading photos", len(sources), quiet)
+	defer counter.Done()
+
+	type score struct {
+		source string
+		blur   float64
+	}
+
+	jobs := make(chan *Media, len(sources))
+	results := make(chan Either[score], len(sources))
+	var wg sync.WaitGroup
+
+	for pid := 0; pid < procCount; pid++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for media := range jobs {
+				counter.Increment()
+
+				blur, scored, err := StoredBlur(db, media)
+				if err != nil {
+					results <- Either[score]{score{}, err}
+				} else if scored {
+					results <- Either[score]{score{media.source, blur}, nil}
+				}
+			}
+		}()
+	}
+
+	for _, media := range sources {
+		jobs <- media
+	}
+
+	close(jobs)
+	wg.Wait()
+	close(results)
+
+	blurs := make(map[string]float64)
+	for result := range results {
+		if result.Error != nil {
+			return nil, result.Error
+		}
+
+		blurs[result.Value.source] = result.Value.blur
+	}
+
+	return blurs, nil
+}
+
+/*
+ * Keep only media with a blur-score within the filter's bounds, judged by the photo graded for their
+ * pair. Media that aren't graded, like videos, or can't be, are kept
+ */
+func (library *MediaList) FilterByBlur(procCount int, db *BadgerDb, filter MediaFilter, quiet bool) (*MediaList, error) {
+	blurs, err := library.StoredBlurs(procCount, db, quiet)
+	if err != nil {
+		return nil, err
+	}
+
+	kept := []*Media{}
+
+	for _, media := range library.Values() {
+		blur, scored := blurs[library.GradingSource(media).source]
+
+		if !scored || ((filter.minBlur == 0 || blur >= filter.minBlur) && (filter.maxBlur == 0 || blur <= filter.maxBlur)) {
+			kept = append(kept, media)
+		}
+	}
+
+	filtered := NewMediaList(kept)
+	filtered.pairing = library.pairing
+
+	return filtered, nil
+}
+
+/*
+ * Keep the media filtering workers passed, in the library's order rather than the order workers finished in
+ */
+func (library *MediaList) KeepResults(results chan Either[*Media]) (*MediaList, error) {
+	passed := make(map[*Media]bool)
+	for result := range results {
+		if result.Error != nil {
+			return nil, result.Error
+		}
+
+		passed[result.Value] = true
+	}
+
+	kept := []*Media{}
+	for _, media := range library.Values() {
+		if passed[media] {
+			kept = append(kept, media)
+		}
+	}
+
+	filtered := NewMediaList(kept)
+	filtered.pairing = library.pairing
+
+	return filtered, nil
+}
+
+/*
+ * Open the database under a directory if there is one, to read grades stored by earlier runs. A new
+ * destination has no database yet, so nil is returned
+ */
+func OpenExistingDb(dbDir string) (*BadgerDb, error) {
+	if _, err := os.Stat(dbDir); err != nil {
+		return nil, nil
+	}
+
+	conn, err := NewSqliteDB(dbDir)
+	if err != nil {
+		return nil, err
+	}
+
+	db := &BadgerDb{conn}
+
+	// databases written by older versions of badger may lack newer columns
+	if err := db.CreateTables(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+/*
+ * Copy media matching a filter into a single folder, without clustering or grading them
+ */
+func Copy(opts *BadgerOpts, filter MediaFilter) int {
+	destination, dstDir, err := OpenDestination(opts.to)
+	bail(err)
+	defer destination.Close()
+
+	opts.destination = destination
+	opts.dstDir = dstDir
+
+	progress, err := OpenProgressStream(opts.progressJson)
+	bail(err)
+	defer progress.Close()
+
+	opts.progress = progress
+
+	log, err := OpenEventLog(opts.logPath, opts.json, progress, opts.logLevel)
+	bail(err)
+	defer log.Close()
+
+	opts.log = log
+
+	library, err := opts.ListMedia()
+	bail(err)
+
+	err = library.LoadInformation(opts.loadWorkers, opts.quiet)
+	bail(err)
+
+	// leave out media captured outside the --after/--before window
+	if opts.since > 0 || opts.until > 0 {
+		library, err = library.FilterByCaptureTime(opts.since, opts.until, opts.log)
+		bail(err)
+	}
+
+	library = library.Filter(filter)
+
+	if filter.minBlur > 0 || filter.maxBlur > 0 || opts.filter != nil {
+		db, err := OpenExistingDb(opts.dbDir)
+		bail(err)
+
+		if db != nil {
+			defer db.Close()
+		}
+
+		if filter.minBlur > 0 || filter.maxBlur > 0 {
+			library, err = library.FilterByBlur(opts.loadWorkers, db, filter, opts.quiet)
+			bail(err)
+		}
+
+		if opts.filter != nil {
+			library, err = library.FilterByExpression(opts.loadWorkers, db, opts.filter, opts.log, opts.quiet)
+			bail(err)
+		}
+	}
+
+	if library.Size() == 0 {
+		if opts.json {
+			PrintJsonLine(SUMMARY_LINE, RunSummary{RunId: opts.runId})
+		} else {
+			fmt.Println("badger: no media matched the filters; nothing to copy")
+		}
+
+		return 0
+	}
+
+	facts, err := GatherFacts(library, destination, dstDir)
+	bail(err)
+
+	// copied media keep their original names, rather than being prefixed by a blur-score
+	entries := make([]Media, library.Size())
+	for idx, media := range library.Values() {
+		entries[idx] = *media
+		entries[idx].blur = -1
+	}
+
+	clusters := &MediaCluster{entries: entries}
+
+	// warn about media already copied anywhere in the archive, not only into --to
+	err = CheckArchive(clusters.entries, facts)
+	bail(err)
+
+	proceed, err := PromptCopy(clusters, facts, opts)
+	bail(err)
+
+	if !proceed {
+		return 0
+	}
+
+	err = ProcessLibrary(opts, clusters, facts, library)
+
+	if IsOutOfSpace(err) || errors.Is(err, ErrCopyFailures) {
+		if opts.json {
+			PrintJsonError(err)
+		} else {
+			fmt.Println(err)
+		}
+
+		return 1
+	}
+
+	if err != nil {
+		opts.log.RunFailed(err)
+	}
+
+	bail(err)
+
+	return 0
+}
+
+/*
+ * Construct badger options for `badger copy`; media are copied as-is into a single folder
+ */
+func NewCopyOpts(from []string, to string, dbDir string) BadgerOpts {
+	return BadgerOpts{
+		from:     from,
+		to:       to,
+		dbDir:    dbDir,
+		copyOnly: true,
+		flatten:  true,
+		preserve: PreserveAttrs{times: true},
+		pairing:  FOLLOW_JPEG,
+		onExists: SKIP_EXISTING,
+		runId:    NewRunId(time.Now()),
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+/*
+ * A single file can be copied, as copying doesn't cluster media
+ */
+func TestCopyOneFile(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+
+	WriteTestImage(t, filepath.Join(src, "IMG_0001.png"), true, 1)
+
+	opts := NewTestCopyOpts(t, []string{filepath.Join(src, "IMG_0001.png")}, dst)
+
+	if code := Copy(opts, MediaFilter{kind: "all"}); code != 0 {
+		t.Fatalf("expected copy to succeed, got exit code %v", code)
+	}
+
+	if copied := CountMediaRows(t, OpenTestDb(t, dst), "skipped = 0"); copied != 1 {
+		t.Errorf("expected the file to be copied, got %v copied media", copied)
+	}
+
+	if matches, _ := filepath.Glob(filepath.Join(dst, "*.png")); len(matches) != 1 {
+		t.Errorf("expected one copy in %v, got %v", dst, matches)
+	}
+}
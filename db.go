@@ -2,7 +2,14 @@ package main
 
 import (
 	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 )
 
 type BadgerDb struct {
@@ -10,29 +17,89 @@ type BadgerDb struct {
 }
 
 /*
- * Construct a database
+ * Construct a database, stored in the destination directory. Write-ahead logging
+ * lets blur-workers read while results are written. Writers wait for the write-lock rather
+ * than failing with 'database is locked', and take it as their transaction starts, since a
+ * reader upgrading to a writer mid-transaction can't wait. So reads mustn't begin transactions
  */
-func NewSqliteDB(opts *BadgerOpts) (*sql.DB, error) {
-	dbPath := filepath.Join(opts.to, ".badger_metadata.sqlite")
-	return sql.Open("sqlite3", dbPath)
+func NewSqliteDB(dir string) (*sql.DB, error) {
+	dbPath := filepath.Join(dir, ".badger_metadata.sqlite")
+	return sql.Open("sqlite3", dbPath+"?_journal_mode=WAL&_synchronous=NORMAL&_busy_timeout=10000&_txlock=immediate")
 }
 
-func (conn *BadgerDb) Close() error {
-	return conn.db.Close()
+/*
+ * Open the database in a directory without changing it; it isn't created, nor migrated to the latest
+ * schema, and can't be written to even by statements that turn off query-only mode
+ */
+func OpenReadOnlyDb(dir string) (*BadgerDb, error) {
+	dbPath, err := filepath.Abs(filepath.Join(dir, ".badger_metadata.sqlite"))
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Stat(dbPath); err != nil {
+		return nil, fmt.Errorf("badger: %v doesn't contain a badger metadata database", dir)
+	}
+
+	uri := url.URL{Scheme: "file", Path: dbPath, RawQuery: "mode=ro&_busy_timeout=10000"}
+
+	conn, err := sql.Open("sqlite3", uri.String())
+	if err != nil {
+		return nil, err
+	}
+
+	return &BadgerDb{conn}, nil
 }
 
-func (conn *BadgerDb) CreateTables() error {
-	tx, err := conn.db.Begin()
-	defer tx.Rollback()
+/*
+ * Open the database in a directory to change its rows, without creating it or migrating it to the
+ * latest schema
+ */
+func OpenWritableDb(dir string) (*BadgerDb, error) {
+	if _, err := os.Stat(filepath.Join(dir, ".badger_metadata.sqlite")); err != nil {
+		return nil, fmt.Errorf("badger: %v doesn't contain a badger metadata database", dir)
+	}
 
+	conn, err := NewSqliteDB(dir)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS mediaData (
+	return &BadgerDb{conn}, nil
+}
+
+/*
+ * Does the database have a table? Databases written by older versions of badger may lack newer ones
+ */
+func (conn *BadgerDb) HasTable(table string) (bool, error) {
+	var count int
+
+	err := conn.db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, table).Scan(&count)
+
+	return count > 0, err
+}
+
+func (conn *BadgerDb) Close() error {
+	return conn.db.Close()
+}
+
+/*
+ * Create the tables, or upgrade them to the latest schema version
+ */
+func (conn *BadgerDb) CreateTables() error {
+	return conn.Migrate()
+}
+
+/*
+ * Schema version 1; the tables as they were before the schema was versioned. Databases written by
+ * earlier versions of badger have any missing columns added
+ */
+func CreateInitialSchema(tx *sql.Tx) error {
+	_, err := tx.Exec(`CREATE TABLE IF NOT EXISTS mediaData (
       src             TEXT NOT NULL,
 			dst             TEXT NOT NULL,
 			hash            TEXT NOT NULL,
+			hashAlgorithm   TEXT,
 			id              INTEEGR NOT NULL,
 			clusterId       INTEGER NOT NULL,
 			blur            INTEGER,
@@ -40,57 +107,315 @@ func (conn *BadgerDb) CreateTables() error {
 			iso             TEXT,
 			aperture        TEXT,
 			shutterSpeed    TEXT,
-			mtime           TEXT
+			mtime           TEXT,
+			duplicateGroup  INTEGER NOT NULL DEFAULT 0,
+			skipped         INTEGER NOT NULL DEFAULT 0,
+			linked          INTEGER NOT NULL DEFAULT 0,
+			moved           INTEGER NOT NULL DEFAULT 0,
+			runId           TEXT,
+			thumbnail       TEXT,
+			phash           TEXT,
+			rawBlur         INTEGER,
+			size            INTEGER,
+			faces           INTEGER,
+			clippedHighlights REAL,
+			crushedShadows  REAL,
+			sharpnessMetric TEXT,
+			gradeEdge       INTEGER,
+			sourceInput     TEXT
 	)`)
 
 	if err != nil {
 		return err
 	}
 
-	tx.Commit()
+	// add columns missing from tables created by older versions of badger
+	columns := []struct{ name, definition string }{
+		{"hashAlgorithm", "TEXT"},
+		{"skipped", "INTEGER NOT NULL DEFAULT 0"},
+		{"linked", "INTEGER NOT NULL DEFAULT 0"},
+		{"moved", "INTEGER NOT NULL DEFAULT 0"},
+		{"runId", "TEXT"},
+		{"thumbnail", "TEXT"},
+		{"phash", "TEXT"},
+		{"rawBlur", "INTEGER"},
+		{"size", "INTEGER"},
+		{"duplicateGroup", "INTEGER NOT NULL DEFAULT 0"},
+		{"faces", "INTEGER"},
+		{"clippedHighlights", "REAL"},
+		{"crushedShadows", "REAL"},
+		{"sharpnessMetric", "TEXT"},
+		{"gradeEdge", "INTEGER"},
+		{"sourceInput", "TEXT"},
+	}
 
-	return nil
-}
+	for _, column := range columns {
+		if err := AddMissingColumn(tx, "mediaData", column.name, column.definition); err != nil {
+			return err
+		}
+	}
+
+	// databases created before media were upserted may contain duplicate rows; keep
+	// the latest row for each source, so that the source can be made unique
+	_, err = tx.Exec(`DELETE FROM mediaData WHERE rowid NOT IN (
+		SELECT MAX(rowid) FROM mediaData GROUP BY src
+	)`)
 
-func (conn *BadgerDb) InsertMedia(media *Media) error {
-	tx, err := conn.db.Begin()
 	if err != nil {
 		return err
 	}
-	defer tx.Rollback()
 
-	iso := ""
-	aperture := ""
-	shutterSpeed := ""
+	_, err = tx.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS mediaDataSrc ON mediaData (src)`)
 
-	info, err := media.GetInformation()
 	if err != nil {
 		return err
 	}
 
-	if info != nil {
-		iso = info.Iso
-		aperture = info.Aperture
-		shutterSpeed = info.ShutterSpeed
+	_, err = tx.Exec(`CREATE INDEX IF NOT EXISTS mediaDataHash ON mediaData (hash)`)
+
+	if err != nil {
+		return err
+	}
+
+	// grades keyed by content rather than path, so photos seen from another mount point aren't regraded
+	_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS gradeCache (
+			hash            TEXT NOT NULL,
+			hashAlgorithm   TEXT NOT NULL,
+			sharpnessMetric TEXT NOT NULL,
+			gradeEdge       INTEGER NOT NULL,
+			upright         INTEGER NOT NULL,
+			blur            INTEGER NOT NULL,
+			phash           TEXT NOT NULL,
+			clippedHighlights REAL NOT NULL,
+			crushedShadows  REAL NOT NULL,
+			PRIMARY KEY (hash, hashAlgorithm, sharpnessMetric, gradeEdge, upright)
+	)`)
+
+	if err != nil {
+		return err
 	}
 
-	_, err = tx.Exec(`
+	_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS runs (
+			runId           TEXT PRIMARY KEY,
+			sources         TEXT NOT NULL,
+			destination     TEXT NOT NULL,
+			args            TEXT
+	)`)
+
+	if err != nil {
+		return err
+	}
+
+	// the arguments a run was started with, so it can be resumed
+	return AddMissingColumn(tx, "runs", "args", "TEXT")
+}
+
+/*
+ * Add a column to a table, unless the table already has it
+ */
+func AddMissingColumn(tx *sql.Tx, table string, column string, definition string) error {
+	var count int
+
+	err := tx.QueryRow(`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, table, column).Scan(&count)
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return nil
+	}
+
+	_, err = tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+// Run ids are UTC timestamps, fixed-width so they sort chronologically as text
+const RunIdFormat = "2006-01-02T15:04:05.000000000Z"
+
+/*
+ * Identify a badger run by the time it started
+ */
+func NewRunId(now time.Time) string {
+	return now.UTC().Format(RunIdFormat)
+}
+
+// Media are keyed by source and content, so a source reused for other content gets a row of its own.
+// A later run skipping a media never replaces the row of an earlier run that copied it
+const InsertMediaSQL = `
 	INSERT INTO mediaData (
 		src,
 		dst,
 		hash,
+		hashAlgorithm,
 		id,
 		clusterId,
 		blur,
 		mediaType,
 		iso,
 		aperture,
-		shutterSpeed
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`,
+		shutterSpeed,
+		skipped,
+		linked,
+		moved,
+		runId,
+		thumbnail,
+		phash,
+		rawBlur,
+		mtime,
+		size,
+		duplicateGroup,
+		faces,
+		clippedHighlights,
+		crushedShadows,
+		sharpnessMetric,
+		gradeEdge,
+		sourceInput,
+		latitude,
+		longitude,
+		altitude,
+		exif,
+		indexed
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT (src, hash) DO UPDATE SET
+		dst           = excluded.dst,
+		hash          = excluded.hash,
+		hashAlgorithm = excluded.hashAlgorithm,
+		id            = excluded.id,
+		clusterId     = excluded.clusterId,
+		blur          = excluded.blur,
+		mediaType     = excluded.mediaType,
+		iso           = excluded.iso,
+		aperture      = excluded.aperture,
+		shutterSpeed  = excluded.shutterSpeed,
+		skipped       = excluded.skipped,
+		linked        = excluded.linked,
+		moved         = excluded.moved,
+		runId         = excluded.runId,
+		thumbnail     = excluded.thumbnail,
+		phash         = excluded.phash,
+		rawBlur       = excluded.rawBlur,
+		mtime         = excluded.mtime,
+		size          = excluded.size,
+		duplicateGroup = excluded.duplicateGroup,
+		faces         = excluded.faces,
+		clippedHighlights = excluded.clippedHighlights,
+		crushedShadows = excluded.crushedShadows,
+		sharpnessMetric = excluded.sharpnessMetric,
+		gradeEdge     = excluded.gradeEdge,
+		sourceInput   = excluded.sourceInput,
+		latitude      = excluded.latitude,
+		longitude     = excluded.longitude,
+		altitude      = excluded.altitude,
+		exif          = excluded.exif,
+		indexed       = excluded.indexed
+	WHERE excluded.skipped = 0 OR mediaData.skipped = 1
+	`
+
+const CacheGradeSQL = `
+INSERT OR REPLACE INTO gradeCache (hash, hashAlgorithm, sharpnessMetric, gradeEdge, upright, blur, phash, clippedHighlights, crushedShadows)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+/*
+ * Get the column-values cached for a media's grade; nil if it wasn't fully graded. Raw images
+ * graded through their jpeg have no perceptual hash of their own, so aren't cached
+ */
+func GradeCacheValues(media *Media) []any {
+	kind := media.GetType()
+
+	if (kind != PHOTO && kind != RAW) || media.rawBlur < 0 || media.exposure == nil || len(media.phash) == 0 || len(media.hash) == 0 {
+		return nil
+	}
+
+	return []any{
+		media.hash,
+		media.hashAlgorithm,
+		media.GetSharpnessMetric(),
+		media.gradeMaxEdge,
+		!media.ignoreOrientation,
+		media.rawBlur,
+		media.phash,
+		media.exposure.Highlights,
+		media.exposure.Shadows,
+	}
+}
+
+/*
+ * Get the column-values inserted for a media
+ */
+func MediaRowValues(media *Media) ([]any, error) {
+	iso := ""
+	aperture := ""
+	shutterSpeed := ""
+
+	info, err := media.GetInformation()
+	if err != nil {
+		return nil, err
+	}
+
+	// the size is unknown if the source is gone; it's recorded as zero
+	size, _ := media.Size()
+	if size < 0 {
+		size = 0
+	}
+
+	// faces are unknown unless counted, so are stored as null
+	var faces any
+	if media.facesCounted {
+		faces = media.faces
+	}
+
+	// as are exposures, unless graded
+	var highlights, shadows any
+	if media.exposure != nil {
+		highlights = media.exposure.Highlights
+		shadows = media.exposure.Shadows
+	}
+
+	// only graded media have a blur-score, and so a metric and resolution that produced it
+	var metric, gradeEdge any
+	if media.blur >= 0 && (media.GetType() == PHOTO || media.GetType() == RAW) {
+		metric = media.GetSharpnessMetric()
+		gradeEdge = media.gradeMaxEdge
+	}
+
+	// and locations & exif tags, unless recorded
+	var latitude, longitude, altitude, tags any
+
+	// indexed media weren't copied anywhere
+	dst := media.GetDestinationPath()
+	if media.indexed {
+		dst = ""
+	}
+
+	if info != nil {
+		iso = info.Iso
+		aperture = info.Aperture
+		shutterSpeed = info.ShutterSpeed
+
+		if info.HasLocation {
+			latitude = info.Latitude
+			longitude = info.Longitude
+		}
+
+		if info.HasAltitude {
+			altitude = info.Altitude
+		}
+
+		if len(info.Tags) > 0 {
+			content, err := json.Marshal(info.Tags)
+			if err != nil {
+				return nil, err
+			}
+
+			tags = string(content)
+		}
+	}
+
+	return []any{
 		media.source,
-		media.GetDestinationPath(),
+		dst,
 		media.hash,
+		media.hashAlgorithm,
 		media.id,
 		media.clusterId,
 		media.blur,
@@ -98,47 +423,843 @@ func (conn *BadgerDb) InsertMedia(media *Media) error {
 		iso,
 		aperture,
 		shutterSpeed,
-	)
+		media.skipped,
+		media.linked,
+		media.moved,
+		media.runId,
+		media.thumbnail,
+		media.phash,
+		media.rawBlur,
+		time.Unix(int64(media.GetCreationTime()), 0).UTC().Format(time.RFC3339),
+		size,
+		media.duplicateGroup,
+		faces,
+		highlights,
+		shadows,
+		metric,
+		gradeEdge,
+		media.sourceInput,
+		latitude,
+		longitude,
+		altitude,
+		tags,
+		media.indexed,
+	}, nil
+}
+
+// Commit batched inserts after this many rows
+const MediaBatchSize = 500
+
+// Buffers media inserts into transactions, reusing a prepared statement, so large
+// imports don't commit (and fsync) once per file
+type MediaBatch struct {
+	conn  *BadgerDb
+	size  int
+	count int
+	tx    *sql.Tx
+	stmt  *sql.Stmt
+}
+
+/*
+ * Construct a batch of inserts, committed every `size` rows
+ */
+func (conn *BadgerDb) NewMediaBatch(size int) *MediaBatch {
+	return &MediaBatch{
+		conn: conn,
+		size: size,
+	}
+}
 
+/*
+ * Add a media to the batch, committing the batch once it's full
+ */
+func (batch *MediaBatch) Insert(media *Media) error {
+	if batch.tx == nil {
+		tx, err := batch.conn.db.Begin()
+		if err != nil {
+			return err
+		}
+
+		stmt, err := tx.Prepare(InsertMediaSQL)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		batch.tx = tx
+		batch.stmt = stmt
+	}
+
+	values, err := MediaRowValues(media)
 	if err != nil {
 		return err
 	}
 
-	err = tx.Commit()
-	if err != nil {
+	if _, err := batch.stmt.Exec(values...); err != nil {
 		return err
 	}
 
+	// cache the grade in the same transaction; a separate writer would wait on this one
+	if cacheValues := GradeCacheValues(media); cacheValues != nil {
+		if _, err := batch.tx.Exec(CacheGradeSQL, cacheValues...); err != nil {
+			return err
+		}
+	}
+
+	batch.count += 1
+
+	if batch.count >= batch.size {
+		return batch.Commit()
+	}
+
 	return nil
 }
 
+/*
+ * Commit any rows inserted so far
+ */
+func (batch *MediaBatch) Commit() error {
+	if batch.tx == nil {
+		return nil
+	}
+
+	batch.stmt.Close()
+	err := batch.tx.Commit()
+
+	batch.tx = nil
+	batch.stmt = nil
+	batch.count = 0
+
+	return err
+}
+
+// Records media from a single goroutine, fed by a channel, so however many workers copy at once
+// there's only ever one writer. Rows are batched into transactions
+type MediaWriter struct {
+	jobs chan Media
+	done chan bool
+	once sync.Once
+	lock sync.Mutex
+	err  error
+}
+
+/*
+ * Start recording media, committing every `size` rows. Media that fail to record are logged
+ */
+func (conn *BadgerDb) StartMediaWriter(size int, log *EventLog) *MediaWriter {
+	writer := &MediaWriter{
+		jobs: make(chan Media, size),
+		done: make(chan bool),
+	}
+
+	go func() {
+		defer close(writer.done)
+
+		batch := conn.NewMediaBatch(size)
+		defer batch.Close()
+
+		for media := range writer.jobs {
+			// after a failure, drain the remaining media without recording them
+			if writer.Err() != nil {
+				continue
+			}
+
+			if err := batch.Insert(&media); err != nil {
+				log.Failed("record", &media, err)
+				writer.fail(err)
+			}
+		}
+
+		if writer.Err() == nil {
+			writer.fail(batch.Commit())
+		}
+	}()
+
+	return writer
+}
+
+/*
+ * Queue a media to be recorded
+ */
+func (writer *MediaWriter) Write(media *Media) {
+	writer.jobs <- *media
+}
+
+/*
+ * Get the first error recording media, if any
+ */
+func (writer *MediaWriter) Err() error {
+	writer.lock.Lock()
+	defer writer.lock.Unlock()
+
+	return writer.err
+}
+
+func (writer *MediaWriter) fail(err error) {
+	writer.lock.Lock()
+	defer writer.lock.Unlock()
+
+	if writer.err == nil {
+		writer.err = err
+	}
+}
+
+/*
+ * Record every queued media, and commit them. Safe to call more than once
+ */
+func (writer *MediaWriter) Close() error {
+	writer.once.Do(func() {
+		close(writer.jobs)
+	})
+
+	<-writer.done
+
+	return writer.Err()
+}
+
+/*
+ * Discard any uncommitted rows
+ */
+func (batch *MediaBatch) Close() error {
+	if batch.tx == nil {
+		return nil
+	}
+
+	batch.stmt.Close()
+	err := batch.tx.Rollback()
+
+	batch.tx = nil
+	batch.stmt = nil
+	batch.count = 0
+
+	return err
+}
+
 type GetMediaRow struct {
-	src  string
-	dst  string
-	hash string
-	blur int
+	src      string
+	dst      string
+	hash     string
+	blur     int
+	phash    string
+	exposure *Exposure
+	metric   SharpnessMetric
+	// the long-edge the photo was shrunk to before grading; zero if graded at full resolution
+	gradeEdge int
 }
 
 /*
- * Get media by source
+ * Get the media last recorded from a source
  */
 func (conn *BadgerDb) GetMedia(media *Media) (*GetMediaRow, error) {
-	tx, err := conn.db.Begin()
 	store := GetMediaRow{}
 
-	if err != nil {
-		return &GetMediaRow{}, err
-	}
-	defer tx.Rollback()
+	// read outside a transaction; beginning one takes the write-lock, which the writer holds for a whole batch
+	result := conn.db.QueryRow(`SELECT src, dst, hash, COALESCE(rawBlur, blur, 0), IFNULL(phash, ''), clippedHighlights, crushedShadows, IFNULL(sharpnessMetric, 'laplacian'), IFNULL(gradeEdge, 0) FROM mediaData WHERE src = ? ORDER BY rowid DESC LIMIT 1`, media.source)
 
-	result := conn.db.QueryRow(`SELECT src, dst, hash, blur FROM mediaData WHERE src = ?`, media.source)
+	var highlights, shadows sql.NullFloat64
 
-	switch err := result.Scan(&store.src, &store.dst, &store.hash, &store.blur); err {
+	switch err := result.Scan(&store.src, &store.dst, &store.hash, &store.blur, &store.phash, &highlights, &shadows, &store.metric, &store.gradeEdge); err {
 	case sql.ErrNoRows:
 		return &store, nil
 	case nil:
+		if highlights.Valid && shadows.Valid {
+			store.exposure = &Exposure{highlights.Float64, shadows.Float64}
+		}
+
 		return &store, nil
+	default:
+		return &GetMediaRow{}, err
+	}
+}
+
+/*
+ * Get the grade cached for a media's content, graded the same way. Reports whether there was one
+ */
+func (conn *BadgerDb) GetCachedGrade(media *Media) (*GetMediaRow, bool, error) {
+	store := GetMediaRow{}
+
+	hash, err := media.GetHash()
+	if err != nil {
+		return &store, false, err
+	}
+
+	var highlights, shadows float64
+
+	err = conn.db.QueryRow(`
+	SELECT blur, phash, clippedHighlights, crushedShadows
+	FROM gradeCache
+	WHERE hash = ? AND hashAlgorithm = ? AND sharpnessMetric = ? AND gradeEdge = ? AND upright = ?`,
+		hash, media.hashAlgorithm, media.GetSharpnessMetric(), media.gradeMaxEdge, !media.ignoreOrientation).Scan(&store.blur, &store.phash, &highlights, &shadows)
+
+	if err == sql.ErrNoRows {
+		return &store, false, nil
+	}
+
+	if err != nil {
+		return &store, false, err
+	}
+
+	store.exposure = &Exposure{highlights, shadows}
+
+	return &store, true, nil
+}
+
+type StoredMediaRow struct {
+	src           string
+	dst           string
+	hash          string
+	hashAlgorithm HashAlgorithm
+	// the --to of the run that recorded the media, where it's listed
+	to string
+}
+
+/*
+ * Resolve a path recorded by an older version of badger, relative to the working directory it ran in.
+ * Copies are made under the run's --to, which holds the database, so they're found relative to the
+ * database's directory wherever badger now runs. Other paths are returned as they are
+ */
+func ResolveStoredPath(fpath string, to string, dbDir string) string {
+	if len(fpath) == 0 || filepath.IsAbs(fpath) || len(to) == 0 || filepath.IsAbs(to) || IsRemoteDestination(to) {
+		return fpath
+	}
+
+	rel, err := filepath.Rel(to, fpath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fpath
+	}
+
+	return filepath.Join(dbDir, rel)
+}
+
+// A media a run copied, as recorded in the archive index
+type ArchiveRow struct {
+	dst           string
+	hash          string
+	hashAlgorithm HashAlgorithm
+	size          int64
+}
+
+/*
+ * List each media a run copied, rather than skipped
+ */
+func (conn *BadgerDb) ListArchiveRows(runId string) ([]ArchiveRow, error) {
+	rows, err := conn.db.Query(`
+	SELECT dst, hash, IFNULL(hashAlgorithm, ''), IFNULL(size, 0)
+	FROM mediaData
+	WHERE skipped = 0 AND runId = ?`, runId)
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stored := []ArchiveRow{}
+
+	for rows.Next() {
+		row := ArchiveRow{}
+
+		if err := rows.Scan(&row.dst, &row.hash, &row.hashAlgorithm, &row.size); err != nil {
+			return nil, err
+		}
+
+		stored = append(stored, row)
+	}
+
+	return stored, rows.Err()
+}
+
+/*
+ * Get the media an earlier run recorded from a source path, other than by indexing it; the latest
+ * copy, if it was ever copied. Reports whether there was one
+ */
+func (conn *BadgerDb) GetMediaBySource(src string, runId string) (StoredMediaRow, bool, error) {
+	row := StoredMediaRow{}
+
+	err := conn.db.QueryRow(`
+	SELECT src, dst, hash, IFNULL(hashAlgorithm, '')
+	FROM mediaData
+	WHERE src = ? AND indexed = 0 AND IFNULL(runId, '') != ?
+	ORDER BY skipped, rowid DESC
+	LIMIT 1`, src, runId).Scan(&row.src, &row.dst, &row.hash, &row.hashAlgorithm)
+
+	if err == sql.ErrNoRows {
+		return row, false, nil
+	}
+
+	return row, err == nil, err
+}
+
+/*
+ * Get a media an earlier run recorded with the same content, from any source path, other than by
+ * indexing it. Reports whether there was one
+ */
+func (conn *BadgerDb) GetMediaByHash(hash string, algorithm HashAlgorithm, runId string) (StoredMediaRow, bool, error) {
+	row := StoredMediaRow{}
+
+	err := conn.db.QueryRow(`
+	SELECT src, dst, hash, IFNULL(hashAlgorithm, '')
+	FROM mediaData
+	WHERE hash = ? AND hashAlgorithm = ? AND indexed = 0 AND IFNULL(runId, '') != ?
+	LIMIT 1`, hash, algorithm, runId).Scan(&row.src, &row.dst, &row.hash, &row.hashAlgorithm)
+
+	if err == sql.ErrNoRows {
+		return row, false, nil
+	}
+
+	return row, err == nil, err
+}
+
+/*
+ * Get a media an earlier run copied with the same content, from any source path; skipped media
+ * weren't copied anywhere. Reports whether there was one
+ */
+func (conn *BadgerDb) GetCopyByHash(hash string, algorithm HashAlgorithm, runId string) (StoredMediaRow, bool, error) {
+	row := StoredMediaRow{}
+
+	err := conn.db.QueryRow(`
+	SELECT src, dst, hash, IFNULL(hashAlgorithm, '')
+	FROM mediaData
+	WHERE hash = ? AND hashAlgorithm = ? AND skipped = 0 AND IFNULL(runId, '') != ?
+	LIMIT 1`, hash, algorithm, runId).Scan(&row.src, &row.dst, &row.hash, &row.hashAlgorithm)
+
+	if err == sql.ErrNoRows {
+		return row, false, nil
+	}
+
+	return row, err == nil, err
+}
+
+/*
+ * Was a media recorded by an earlier run with the same content? A source path recorded earlier
+ * only counts while its content is unchanged, since files are sometimes edited in place
+ */
+func (conn *BadgerDb) WasImported(media *Media) (bool, error) {
+	row, found, err := conn.GetMediaBySource(media.source, media.runId)
+	if err != nil {
+		return false, err
+	}
+
+	if found && len(row.hash) > 0 {
+		algorithm := row.hashAlgorithm
+		if len(algorithm) == 0 {
+			algorithm = MD5
+		}
+
+		var hash string
+		if algorithm == media.hashAlgorithm {
+			hash, err = media.GetHash()
+		} else {
+			hash, err = GetHash(media.source, algorithm)
+		}
+
+		if err != nil {
+			return false, err
+		}
+
+		if hash == row.hash {
+			return true, nil
+		}
+	}
+
+	hash, err := media.GetHash()
+	if err != nil {
+		return false, err
+	}
+
+	_, found, err = conn.GetMediaByHash(hash, media.hashAlgorithm, media.runId)
+
+	return found, err
+}
+
+/*
+ * Was a media copied by an earlier run, and does the copy still match the hash recorded for it?
+ * Copies an interrupted run left missing or half-written don't count
+ */
+func (conn *BadgerDb) WasCopied(media *Media) (bool, error) {
+	row, found, err := conn.GetMediaBySource(media.source, media.runId)
+	if err != nil || !found {
+		return false, err
+	}
+
+	algorithm := row.hashAlgorithm
+	if len(algorithm) == 0 {
+		algorithm = MD5
+	}
+
+	file, err := media.GetDestination().Open(row.dst)
+	if err != nil {
+		return false, nil
+	}
+	defer file.Close()
+
+	hash, err := HashReader(file, algorithm)
+	if err != nil {
+		return false, nil
+	}
+
+	return hash == row.hash, nil
+}
+
+// Selects the rows written by a particular run, or by every run since a run id. An
+// empty filter selects every row
+type RunFilter struct {
+	runId string
+	since string
+}
+
+/*
+ * Get a where-clause, and its arguments, selecting the filtered runs
+ */
+func (filter RunFilter) Where() (string, []any) {
+	clauses := []string{}
+	args := []any{}
+
+	if len(filter.runId) > 0 {
+		clauses = append(clauses, "runId = ?")
+		args = append(args, filter.runId)
+	}
+
+	if len(filter.since) > 0 {
+		clauses = append(clauses, "runId >= ?")
+		args = append(args, filter.since)
+	}
+
+	if len(clauses) == 0 {
+		return "1 = 1", args
+	}
+
+	return strings.Join(clauses, " AND "), args
+}
+
+/*
+ * Describe the filtered runs, e.g "in runs since 2021-07-04T00:00:00.000000000Z"
+ */
+func (filter RunFilter) String() string {
+	switch {
+	case len(filter.runId) > 0:
+		return "in run " + filter.runId
+	case len(filter.since) > 0:
+		return "in runs since " + filter.since
+	}
+
+	return "in every run"
+}
+
+/*
+ * Record that a run started, copying from a set of sources into a destination, with the
+ * command-line arguments it was started with
+ */
+func (conn *BadgerDb) InsertRun(runId string, sources []string, destination string, args []string) error {
+	encoded, err := json.Marshal(args)
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.db.Exec(`INSERT OR IGNORE INTO runs (runId, sources, destination, args) VALUES (?, ?, ?, ?)`,
+		runId, strings.Join(sources, ","), destination, string(encoded))
+
+	return err
+}
+
+/*
+ * Get the id and command-line arguments of the latest run recorded with its arguments. Returns
+ * an empty run id if there's no such run
+ */
+func (conn *BadgerDb) LatestRunArgs() (string, []string, error) {
+	var runId string
+	var encoded string
+
+	err := conn.db.QueryRow(`
+	SELECT runId, args
+	FROM runs
+	WHERE args IS NOT NULL
+	ORDER BY runId DESC
+	LIMIT 1`).Scan(&runId, &encoded)
+
+	if err == sql.ErrNoRows {
+		return "", nil, nil
+	}
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	args := []string{}
+	if err := json.Unmarshal([]byte(encoded), &args); err != nil {
+		return "", nil, fmt.Errorf("badger: failed to read the arguments of run %v: %v", runId, err)
+	}
+
+	return runId, args, nil
+}
+
+// A run, and how many media it was the latest run to record
+type RunRow struct {
+	runId   string
+	sources string
+	files   int
+	skipped int
+}
+
+/*
+ * List each run that recorded media, oldest first. Copying a file again reassigns it to
+ * the later run
+ */
+func (conn *BadgerDb) ListRuns() ([]RunRow, error) {
+	rows, err := conn.db.Query(`
+	SELECT media.runId, IFNULL(runs.sources, ''), media.files, media.skipped
+	FROM (
+		SELECT runId, COUNT(*) AS files, SUM(skipped) AS skipped
+		FROM mediaData
+		WHERE runId IS NOT NULL
+		GROUP BY runId
+	) AS media
+	LEFT JOIN runs ON runs.runId = media.runId
+	ORDER BY media.runId`)
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []RunRow{}
+
+	for rows.Next() {
+		row := RunRow{}
+
+		if err := rows.Scan(&row.runId, &row.sources, &row.files, &row.skipped); err != nil {
+			return nil, err
+		}
+
+		runs = append(runs, row)
+	}
+
+	return runs, rows.Err()
+}
+
+/*
+ * Get the column selecting the --to of the run that recorded each media, and the join it needs; databases
+ * older than the runs table don't record one
+ */
+func (conn *BadgerDb) RunDestinationJoin() (string, string, error) {
+	exists, err := conn.HasTable("runs")
+	if err != nil || !exists {
+		return "''", "", err
+	}
+
+	return "IFNULL(runs.destination, '')", "LEFT JOIN runs ON runs.runId = media.runId", nil
+}
+
+/*
+ * List each media that was copied (rather than skipped) by the filtered runs, once per destination
+ */
+func (conn *BadgerDb) ListCopiedMedia(filter RunFilter) ([]StoredMediaRow, error) {
+	where, args := filter.Where()
+
+	to, join, err := conn.RunDestinationJoin()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := conn.db.Query(`
+	SELECT media.src, media.dst, media.hash, IFNULL(media.hashAlgorithm, ''), `+to+`
+	FROM (
+		SELECT * FROM mediaData
+		WHERE skipped = 0 AND `+where+`
+		GROUP BY dst
+	) AS media
+	`+join, args...)
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stored := []StoredMediaRow{}
+
+	for rows.Next() {
+		row := StoredMediaRow{}
+
+		if err := rows.Scan(&row.src, &row.dst, &row.hash, &row.hashAlgorithm, &row.to); err != nil {
+			return nil, err
+		}
+
+		stored = append(stored, row)
+	}
+
+	return stored, rows.Err()
+}
+
+/*
+ * List the destinations (--to) the filtered runs copied into
+ */
+func (conn *BadgerDb) ListRunDestinations(filter RunFilter) ([]string, error) {
+	where, args := filter.Where()
+
+	// databases older than the runs table don't record destinations
+	if exists, err := conn.HasTable("runs"); err != nil || !exists {
+		return []string{}, err
+	}
+
+	rows, err := conn.db.Query(`SELECT DISTINCT destination FROM runs WHERE `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	destinations := []string{}
+
+	for rows.Next() {
+		var destination string
+
+		if err := rows.Scan(&destination); err != nil {
+			return nil, err
+		}
+
+		destinations = append(destinations, destination)
+	}
+
+	return destinations, rows.Err()
+}
+
+/*
+ * Get the id of the most recent run, or an empty string if no run has been recorded
+ */
+func (conn *BadgerDb) LatestRunId() (string, error) {
+	var runId sql.NullString
+
+	err := conn.db.QueryRow(`SELECT MAX(runId) FROM mediaData`).Scan(&runId)
+	if err != nil {
+		return "", err
+	}
+
+	return runId.String, nil
+}
+
+// A media recorded during a run, as needed to undo that run
+type RunMediaRow struct {
+	StoredMediaRow
+	thumbnail string
+	skipped   bool
+	moved     bool
+}
+
+/*
+ * List each media recorded by the filtered runs
+ */
+func (conn *BadgerDb) ListRunMedia(filter RunFilter) ([]RunMediaRow, error) {
+	where, args := filter.Where()
+
+	to, join, err := conn.RunDestinationJoin()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := conn.db.Query(`
+	SELECT media.src, media.dst, media.hash, IFNULL(media.hashAlgorithm, ''), IFNULL(media.thumbnail, ''), media.skipped, media.moved, `+to+`
+	FROM (SELECT * FROM mediaData WHERE `+where+`) AS media
+	`+join, args...)
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stored := []RunMediaRow{}
+
+	for rows.Next() {
+		row := RunMediaRow{}
+
+		if err := rows.Scan(&row.src, &row.dst, &row.hash, &row.hashAlgorithm, &row.thumbnail, &row.skipped, &row.moved, &row.to); err != nil {
+			return nil, err
+		}
+
+		stored = append(stored, row)
+	}
+
+	return stored, rows.Err()
+}
+
+/*
+ * Remove the row recorded for a source's content
+ */
+func (conn *BadgerDb) DeleteMedia(src string, hash string) error {
+	_, err := conn.db.Exec(`DELETE FROM mediaData WHERE src = ? AND hash = ?`, src, hash)
+	return err
+}
+
+// A media's perceptual hash, as needed to find near-duplicates
+type PerceptualHashRow struct {
+	src   string
+	dst   string
+	phash string
+}
+
+/*
+ * List each media with a perceptual hash
+ */
+func (conn *BadgerDb) ListPerceptualHashes() ([]PerceptualHashRow, error) {
+	rows, err := conn.db.Query(`
+	SELECT src, dst, phash
+	FROM mediaData
+	WHERE phash IS NOT NULL AND phash != ''`)
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stored := []PerceptualHashRow{}
+
+	for rows.Next() {
+		row := PerceptualHashRow{}
+
+		if err := rows.Scan(&row.src, &row.dst, &row.phash); err != nil {
+			return nil, err
+		}
+
+		stored = append(stored, row)
+	}
+
+	return stored, rows.Err()
+}
+
+// A recorded media, as needed to summarise a library
+type StatsRow struct {
+	dst          string
+	blur         int
+	mediaType    MediaType
+	iso          string
+	shutterSpeed string
+	captureTime  string
+	skipped      bool
+	size         int64
+}
+
+/*
+ * List each recorded media, with the metadata summarised by 'badger stats'
+ */
+func (conn *BadgerDb) ListStatsRows() ([]StatsRow, error) {
+	rows, err := conn.db.Query(`
+	SELECT dst, IFNULL(blur, 0), mediaType, IFNULL(iso, ''), IFNULL(shutterSpeed, ''), IFNULL(mtime, ''), skipped, IFNULL(size, 0)
+	FROM mediaData`)
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stored := []StatsRow{}
+
+	for rows.Next() {
+		row := StatsRow{}
+
+		err := rows.Scan(&row.dst, &row.blur, &row.mediaType, &row.iso, &row.shutterSpeed, &row.captureTime, &row.skipped, &row.size)
+		if err != nil {
+			return nil, err
+		}
+
+		stored = append(stored, row)
 	}
 
-	return &store, nil
+	return stored, rows.Err()
 }
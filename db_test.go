@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+/*
+ * Construct a graded photo, with everything recorded about it already known
+ */
+func NewBenchmarkMedia(idx int) Media {
+	return Media{
+		source:        fmt.Sprintf("/media/card/IMG_%06d.jpg", idx),
+		dstDir:        "/media/library",
+		flatten:       true,
+		id:            idx,
+		hash:          fmt.Sprintf("%032x", idx),
+		hashAlgorithm: MD5,
+		blur:          100,
+		rawBlur:       100,
+		size:          4 * 1024 * 1024,
+		ctime:         1625410800 + idx,
+		exifData:      &PhotoInformation{Iso: "100", Aperture: "f/2.8", ShutterSpeed: "1/250"},
+		runId:         "benchmark",
+	}
+}
+
+/*
+ * Record media, in a single batch
+ */
+func InsertTestMedia(t *testing.T, db *BadgerDb, media ...Media) {
+	t.Helper()
+
+	batch := db.NewMediaBatch(len(media))
+	defer batch.Close()
+
+	for idx := range media {
+		if err := batch.Insert(&media[idx]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := batch.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+/*
+ * A later run that skips a media, like with --min-blur, doesn't replace the record of the run that copied it
+ */
+func TestInsertMediaKeepsCopiedRows(t *testing.T) {
+	db := NewTestRunDb(t, t.TempDir(), "", "")
+
+	copied := NewBenchmarkMedia(1)
+	copied.runId = "first"
+
+	skipped := NewBenchmarkMedia(1)
+	skipped.runId = "second"
+	skipped.skipped = true
+	skipped.skipReason = BELOW_MIN_BLUR
+
+	InsertTestMedia(t, db, copied)
+	InsertTestMedia(t, db, skipped)
+
+	if rows := CountMediaRows(t, db, "runId = 'first' AND skipped = 0"); rows != 1 {
+		t.Errorf("expected the first run's copy to be kept, but %v rows were", rows)
+	}
+
+	if rows := CountMediaRows(t, db, "1 = 1"); rows != 1 {
+		t.Errorf("expected one row for the media, got %v", rows)
+	}
+
+	// a later copy still replaces the record
+	recopied := NewBenchmarkMedia(1)
+	recopied.runId = "third"
+
+	InsertTestMedia(t, db, recopied)
+
+	if rows := CountMediaRows(t, db, "runId = 'third' AND skipped = 0"); rows != 1 {
+		t.Errorf("expected the third run's copy to be recorded, but %v rows were", rows)
+	}
+}
+
+/*
+ * A second card mounted at the same path has its own rows, rather than replacing the first card's
+ */
+func TestInsertMediaKeysBySourceAndHash(t *testing.T) {
+	db := NewTestRunDb(t, t.TempDir(), "", "")
+
+	first := NewBenchmarkMedia(1)
+	first.runId = "first"
+
+	second := NewBenchmarkMedia(1)
+	second.runId = "second"
+	second.hash = NewBenchmarkMedia(2).hash
+	second.skipped = true
+
+	InsertTestMedia(t, db, first)
+	InsertTestMedia(t, db, second)
+
+	if rows := CountMediaRows(t, db, "src = ?", first.source); rows != 2 {
+		t.Errorf("expected a row for each card's content, got %v", rows)
+	}
+
+	if rows := CountMediaRows(t, db, "runId = 'first' AND skipped = 0"); rows != 1 {
+		t.Errorf("expected the first card's copy to be kept, but %v rows were", rows)
+	}
+}
+
+func TestResolveStoredPath(t *testing.T) {
+	cases := []struct {
+		fpath    string
+		to       string
+		expected string
+	}{
+		{"/library/a.jpg", "library", "/library/a.jpg"},
+		{"library/2021/a.jpg", "library", "/mnt/library/2021/a.jpg"},
+		{"./library/a.jpg", "library/", "/mnt/library/a.jpg"},
+		{"2021/a.jpg", ".", "/mnt/library/2021/a.jpg"},
+		{"elsewhere/a.jpg", "library", "elsewhere/a.jpg"},
+		{"library/a.jpg", "/library", "library/a.jpg"},
+		{"", "library", ""},
+	}
+
+	for _, tc := range cases {
+		if actual := ResolveStoredPath(tc.fpath, tc.to, "/mnt/library"); actual != tc.expected {
+			t.Errorf("expected %v under --to %v to resolve to %v, got %v", tc.fpath, tc.to, tc.expected, actual)
+		}
+	}
+}
+
+/*
+ * Record media one transaction per row, as before batching, and in batches
+ */
+func BenchmarkMediaBatch(b *testing.B) {
+	sizes := map[string]int{"per-row": 1, "batched": MediaBatchSize}
+
+	for _, name := range []string{"per-row", "batched"} {
+		size := sizes[name]
+
+		b.Run(name, func(b *testing.B) {
+			conn, err := NewSqliteDB(b.TempDir())
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			db := BadgerDb{conn}
+			defer db.Close()
+
+			if err := db.CreateTables(); err != nil {
+				b.Fatal(err)
+			}
+
+			batch := db.NewMediaBatch(size)
+			defer batch.Close()
+
+			b.ResetTimer()
+
+			for idx := 0; idx < b.N; idx++ {
+				media := NewBenchmarkMedia(idx)
+
+				if err := batch.Insert(&media); err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			if err := batch.Commit(); err != nil {
+				b.Fatal(err)
+			}
+		})
+	}
+}
+
+/*
+ * A source path an earlier run imported only counts as imported while its content is unchanged
+ */
+func TestWasImportedComparesContent(t *testing.T) {
+	dir := t.TempDir()
+	db := NewTestRunDb(t, dir, "", "")
+
+	fpath := filepath.Join(dir, "IMG_0001.jpg")
+	WriteTestFile(t, fpath, "original")
+
+	hash, err := GetHash(fpath, MD5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	InsertTestRow(t, db, fpath, "/media/library/IMG_0001.jpg", hash)
+
+	media := &Media{source: fpath, hashAlgorithm: MD5, runId: "second"}
+	if imported, err := db.WasImported(media); err != nil || !imported {
+		t.Fatalf("expected the unchanged source to be imported; imported %v, error %v", imported, err)
+	}
+
+	WriteTestFile(t, fpath, "edited in place")
+
+	media = &Media{source: fpath, hashAlgorithm: MD5, runId: "second"}
+	if imported, err := db.WasImported(media); err != nil || imported {
+		t.Fatalf("expected the edited source not to be imported; imported %v, error %v", imported, err)
+	}
+
+	// the hash recorded with another algorithm is compared with that algorithm
+	media = &Media{source: fpath, hashAlgorithm: SHA256, runId: "second"}
+	if imported, err := db.WasImported(media); err != nil || imported {
+		t.Fatalf("expected the edited source not to be imported; imported %v, error %v", imported, err)
+	}
+}
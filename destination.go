@@ -0,0 +1,205 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Where copied media is written; the local filesystem, or a remote host
+type Destination interface {
+	MkdirAll(dir string) error
+	Create(fpath string) (io.WriteCloser, error)
+	Open(fpath string) (io.ReadCloser, error)
+	Stat(fpath string) (os.FileInfo, error)
+	Remove(fpath string) error
+	Chtimes(fpath string, atime time.Time, mtime time.Time) error
+	Chmod(fpath string, mode os.FileMode) error
+	Symlink(target string, fpath string) error
+	FreeSpace(dir string) (uint64, error)
+	Close() error
+}
+
+/*
+ * Is this --to a remote destination, like sftp://user@host/path?
+ */
+func IsRemoteDestination(to string) bool {
+	return strings.HasPrefix(to, "sftp://")
+}
+
+/*
+ * Open the destination named by --to; an SFTP connection for sftp:// URLs, or the local
+ * filesystem. Returns the destination, and the directory to copy into on it
+ */
+func OpenDestination(to string) (Destination, string, error) {
+	if IsRemoteDestination(to) {
+		return OpenSFTPDestination(to)
+	}
+
+	// copies are recorded under an absolute --to, so they're found again from another working directory
+	dstDir, err := filepath.Abs(to)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return LocalDestination{}, dstDir, nil
+}
+
+/*
+ * Get the directory badger's database is kept in. That's --to itself for local destinations; sqlite
+ * can't be used over SFTP, so remote destinations keep theirs under the user's cache directory
+ */
+func DatabaseDir(to string) (string, error) {
+	if !IsRemoteDestination(to) {
+		return to, nil
+	}
+
+	target, err := url.Parse(to)
+	if err != nil {
+		return "", err
+	}
+
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(cache, "badger", target.Hostname(), filepath.FromSlash(target.Path)), nil
+}
+
+/*
+ * Open the destination the filtered runs copied into, and the directory they copied into on it. Runs
+ * into a remote destination keep their database locally, so their copies are reached over SFTP rather
+ * than at the same path on this machine
+ */
+func OpenRunDestination(db *BadgerDb, filter RunFilter, dbDir string) (Destination, string, error) {
+	destinations, err := db.ListRunDestinations(filter)
+	if err != nil {
+		return nil, "", err
+	}
+
+	remote := []string{}
+	for _, to := range destinations {
+		if IsRemoteDestination(to) {
+			remote = append(remote, to)
+		}
+	}
+
+	if len(remote) > 0 && len(destinations) > 1 {
+		return nil, "", fmt.Errorf("badger: media copied %v went to several destinations (%v); select one run with --run", filter, strings.Join(destinations, ", "))
+	}
+
+	if len(remote) > 0 {
+		return OpenDestination(remote[0])
+	}
+
+	// databases for remote destinations are kept in the cache directory; without a recorded
+	// destination their copies can't be found, and local files at the same paths mustn't be touched
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return nil, "", err
+	}
+
+	dir, err := filepath.Abs(dbDir)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if IsWithin(filepath.Join(cache, "badger"), dir) {
+		return nil, "", fmt.Errorf("badger: %v is the database of a remote destination, but doesn't record which destination media %v were copied into", dbDir, filter)
+	}
+
+	return LocalDestination{}, dir, nil
+}
+
+/*
+ * Check a local --to folder can be written to, by creating and removing a file in it. When --to
+ * doesn't exist yet, the nearest folder above it (where it would be created) is checked instead
+ */
+func CheckWritable(to string) error {
+	if stat, err := os.Stat(to); err == nil && !stat.IsDir() {
+		return fmt.Errorf("badger: --to %v is a file, not a folder", to)
+	}
+
+	dir, err := NearestExistingDir(to)
+	if err != nil {
+		return err
+	}
+
+	checked := ""
+	if dir != filepath.Clean(to) {
+		checked = fmt.Sprintf(" (it doesn't exist yet, so %v was checked, where it would be created)", dir)
+	}
+
+	probe, err := os.CreateTemp(dir, ".badger-write-test-*")
+
+	switch {
+	case errors.Is(err, syscall.EROFS):
+		return fmt.Errorf("badger: can't write to --to %v%v: it's on a read-only filesystem", to, checked)
+	case errors.Is(err, os.ErrPermission):
+		return fmt.Errorf("badger: can't write to --to %v%v: permission denied", to, checked)
+	case err != nil:
+		return fmt.Errorf("badger: can't write to --to %v%v: %v", to, checked, err)
+	}
+
+	probe.Close()
+
+	return os.Remove(probe.Name())
+}
+
+// The local filesystem
+type LocalDestination struct{}
+
+func (LocalDestination) MkdirAll(dir string) error {
+	return os.MkdirAll(dir, os.ModePerm)
+}
+
+func (LocalDestination) Create(fpath string) (io.WriteCloser, error) {
+	return os.Create(fpath)
+}
+
+func (LocalDestination) Open(fpath string) (io.ReadCloser, error) {
+	return os.Open(fpath)
+}
+
+func (LocalDestination) Stat(fpath string) (os.FileInfo, error) {
+	return os.Stat(fpath)
+}
+
+func (LocalDestination) Remove(fpath string) error {
+	return os.Remove(fpath)
+}
+
+func (LocalDestination) Chtimes(fpath string, atime time.Time, mtime time.Time) error {
+	return os.Chtimes(fpath, atime, mtime)
+}
+
+func (LocalDestination) Chmod(fpath string, mode os.FileMode) error {
+	return os.Chmod(fpath, mode)
+}
+
+func (LocalDestination) Symlink(target string, fpath string) error {
+	return os.Symlink(target, fpath)
+}
+
+/*
+ * Get the free-space on the drive a directory is (or will be) created on
+ */
+func (LocalDestination) FreeSpace(dir string) (uint64, error) {
+	existing, err := NearestExistingDir(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	return GetFreeSpace(existing)
+}
+
+func (LocalDestination) Close() error {
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOpenRunDestinationLocal(t *testing.T) {
+	IsolateCache(t)
+	dir := t.TempDir()
+
+	db := NewTestRunDb(t, dir, "run", dir)
+
+	destination, dstDir, err := OpenRunDestination(db, RunFilter{}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := destination.(LocalDestination); !ok || dstDir != dir {
+		t.Errorf("expected the local destination %v, got %T %v", dir, destination, dstDir)
+	}
+}
+
+func TestOpenRunDestinationRemote(t *testing.T) {
+	IsolateCache(t)
+	t.Setenv("SSH_AUTH_SOCK", filepath.Join(t.TempDir(), "missing.sock"))
+
+	to := "sftp://user@example.invalid/photos"
+	dbDir, err := DatabaseDir(to)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := NewTestRunDb(t, dbDir, "run", to)
+
+	// the remote host is connected to, rather than local files at the same paths being used
+	_, _, err = OpenRunDestination(db, RunFilter{runId: "run"}, dbDir)
+	if err == nil || !strings.Contains(err.Error(), "ssh-agent") {
+		t.Errorf("expected the remote destination to be connected to, got %v", err)
+	}
+}
+
+func TestOpenRunDestinationUnknownRemote(t *testing.T) {
+	IsolateCache(t)
+
+	dbDir, err := DatabaseDir("sftp://user@example.invalid/photos")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// runs recorded before destinations were, have no destination to open
+	db := NewTestRunDb(t, dbDir, "", "")
+
+	if _, _, err := OpenRunDestination(db, RunFilter{}, dbDir); err == nil {
+		t.Error("expected a remote database without a recorded destination to be refused")
+	}
+}
+
+func TestOpenRunDestinationSeveral(t *testing.T) {
+	IsolateCache(t)
+	dir := t.TempDir()
+
+	db := NewTestRunDb(t, dir, "first", "sftp://user@example.invalid/photos")
+	if err := db.InsertRun("second", []string{"/media/card/*"}, "sftp://user@example.invalid/other", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := OpenRunDestination(db, RunFilter{}, dir); err == nil {
+		t.Error("expected runs into several destinations to be refused")
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+/*
+ * Grade the clustered media and print where each would be copied, without writing to the
+ * destination. Stored blur-scores aren't consulted, since the destination's database isn't opened
+ */
+func DryRun(opts *BadgerOpts, clusters *MediaCluster, library *MediaList) error {
+	if opts.dedupBursts {
+		if err := DedupBursts(opts.blurWorkers, opts.burstWindow, clusters); err != nil {
+			return err
+		}
+	}
+
+	if opts.groupDuplicates {
+		if err := GroupDuplicates(opts.blurWorkers, opts.duplicateDistance, clusters); err != nil {
+			return err
+		}
+	}
+
+	if opts.countFaces {
+		if err := DetectFaces(opts.blurWorkers, opts.minFaces, clusters); err != nil {
+			return err
+		}
+	}
+
+	var graded chan Either[Media]
+
+	if opts.normalizeBlur {
+		raw := CalcuateBlur(opts.blurWorkers, 0, 0, opts.maxClipped, false, nil, library, clusters, opts.log)
+		graded = NormalizeBlur(opts.blurWorkers, opts.minBlur, opts.rejectBelow, false, library, raw)
+	} else {
+		graded = CalcuateBlur(opts.blurWorkers, opts.minBlur, opts.rejectBelow, opts.maxClipped, false, nil, library, clusters, opts.log)
+	}
+
+	if opts.nameTemplate != nil {
+		graded = ClaimTemplatedNames(graded)
+	}
+
+	plan := []Media{}
+
+	for pair := range graded {
+		if pair.Error != nil {
+			return pair.Error
+		}
+
+		plan = append(plan, pair.Value)
+	}
+
+	sort.SliceStable(plan, func(i, j int) bool {
+		if plan[i].clusterId != plan[j].clusterId {
+			return plan[i].clusterId < plan[j].clusterId
+		}
+
+		return plan[i].source < plan[j].source
+	})
+
+	skipped := 0
+
+	for idx := range plan {
+		media := &plan[idx]
+
+		if media.skipped {
+			skipped += 1
+			fmt.Printf("%v -> skipped, %v (cluster %v, blur %v)\n", media.source, media.skipReason, media.GetClusterLabel(), media.blur)
+			continue
+		}
+
+		fmt.Printf("%v -> %v (cluster %v, blur %v)\n", media.source, media.GetDestinationPath(), media.GetClusterLabel(), media.blur)
+	}
+
+	fmt.Printf("\nbadger: dry-run; would copy %v media into %v cluster-folders, and skip %v\n", len(plan)-skipped, clusters.ClusterSize(), skipped)
+
+	return nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+/*
+ * Group media whose perceptual hashes are at most `distance` bits apart. Groups are
+ * transitive; if a is near b, and b is near c, all three are grouped. Returns groups
+ * of two or more media, as indices into the rows
+ */
+func GroupNearDuplicates(hashes []uint64, distance int) [][]int {
+	parents := make([]int, len(hashes))
+	for idx := range parents {
+		parents[idx] = idx
+	}
+
+	var find func(idx int) int
+	find = func(idx int) int {
+		if parents[idx] != idx {
+			parents[idx] = find(parents[idx])
+		}
+		return parents[idx]
+	}
+
+	for first := range hashes {
+		for second := first + 1; second < len(hashes); second++ {
+			if HammingDistance(hashes[first], hashes[second]) <= distance {
+				parents[find(second)] = find(first)
+			}
+		}
+	}
+
+	members := make(map[int][]int)
+	for idx := range hashes {
+		root := find(idx)
+		members[root] = append(members[root], idx)
+	}
+
+	groups := [][]int{}
+	for _, group := range members {
+		if len(group) > 1 {
+			groups = append(groups, group)
+		}
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i][0] < groups[j][0]
+	})
+
+	return groups
+}
+
+/*
+ * Report groups of near-duplicate images in a destination library, by their perceptual hashes
+ */
+func Dupes(dbDir string, distance int) int {
+	conn, err := NewSqliteDB(dbDir)
+	bail(err)
+
+	db := BadgerDb{conn}
+	defer db.Close()
+
+	// databases written by older versions of badger need a phash column
+	err = db.CreateTables()
+	bail(err)
+
+	rows, err := db.ListPerceptualHashes()
+	bail(err)
+
+	hashes := make([]uint64, len(rows))
+
+	for idx, row := range rows {
+		hashes[idx], err = ParsePerceptualHash(row.phash)
+		bail(err)
+	}
+
+	groups := GroupNearDuplicates(hashes, distance)
+
+	for _, group := range groups {
+		for _, idx := range group {
+			fmt.Printf("%v\t%v (copied from %v)\n", rows[idx].phash, rows[idx].dst, rows[idx].src)
+		}
+		fmt.Println()
+	}
+
+	fmt.Printf("badger: found %v groups of near-duplicates among %v images\n", len(groups), len(rows))
+
+	return 0
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Copy at most this many bytes when benchmarking the destination
+const BenchmarkBytes = 64 * 1000 * 1000
+
+// Try grading at most this many photos when estimating, skipping any that can't be decoded
+const EstimateMaxSamples = 5
+
+/*
+ * Get the nearest directory that exists, at or above a path
+ */
+func NearestExistingDir(fpath string) (string, error) {
+	current, err := filepath.Abs(fpath)
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		if stat, err := os.Stat(current); err == nil && stat.IsDir() {
+			return current, nil
+		}
+
+		parent := filepath.Dir(current)
+		if parent == current {
+			return current, nil
+		}
+
+		current = parent
+	}
+}
+
+/*
+ * Measure how many bytes per second can be copied from a sample file into a directory
+ */
+func BenchmarkCopy(sample string, dir string) (float64, error) {
+	source, err := os.Open(sample)
+	if err != nil {
+		return 0, err
+	}
+	defer source.Close()
+
+	dest, err := os.CreateTemp(dir, ".badger-benchmark-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(dest.Name())
+	defer dest.Close()
+
+	start := time.Now()
+
+	written, err := io.CopyN(dest, source, BenchmarkBytes)
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+
+	// include the time taken to reach the disk, not just the page-cache
+	if err := dest.Sync(); err != nil {
+		return 0, err
+	}
+
+	elapsed := time.Since(start).Seconds()
+	if elapsed <= 0 || written == 0 {
+		return 0, nil
+	}
+
+	return float64(written) / elapsed, nil
+}
+
+/*
+ * Estimate how long copying & grading the library will take, by copying part of its largest file
+ * and grading a photo the way the run will. Grading is CPU-bound and runs alongside copying, so the
+ * slower of the two dominates. Returns zero when there's nothing to measure
+ */
+func EstimateSeconds(library *MediaList, facts *Facts, opts *BadgerOpts) (float64, error) {
+	var largest *Media
+	var largestSize int64
+	photos := []*Media{}
+
+	for _, media := range library.Values() {
+		size, err := media.Size()
+		if err != nil {
+			return 0, err
+		}
+
+		if largest == nil || size > largestSize {
+			largest = media
+			largestSize = size
+		}
+
+		if media.GetType() == PHOTO && len(photos) < EstimateMaxSamples {
+			photos = append(photos, media)
+		}
+	}
+
+	copySeconds := 0.0
+
+	// links take next to no time to create, and remote destinations can't be benchmarked locally
+	if largest != nil && opts.link == NO_LINK && !IsRemoteDestination(opts.to) {
+		dir, err := NearestExistingDir(opts.to)
+		if err != nil {
+			return 0, err
+		}
+
+		rate, err := BenchmarkCopy(largest.source, dir)
+		if err != nil {
+			return 0, err
+		}
+
+		if rate > 0 {
+			copySeconds = float64(facts.Size) / rate
+		}
+	}
+
+	gradeSeconds := 0.0
+
+	for _, photo := range photos {
+		// graded as a copy, leaving the library as it was
+		sample := *photo
+		start := time.Now()
+
+		// photos that can't be decoded fail when copied, not when estimating
+		if _, err := sample.Grade(); err != nil {
+			continue
+		}
+
+		gradeSeconds = time.Since(start).Seconds() * float64(facts.PhotoCount) / float64(opts.blurWorkers)
+		break
+	}
+
+	if gradeSeconds > copySeconds {
+		return gradeSeconds, nil
+	}
+
+	return copySeconds, nil
+}
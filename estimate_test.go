@@ -0,0 +1,50 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+/*
+ * Photos that can't be decoded are skipped when estimating, rather than failing the estimate
+ */
+func TestEstimateSkipsUndecodablePhotos(t *testing.T) {
+	src := t.TempDir()
+
+	truncated := filepath.Join(src, "IMG_0001.png")
+	WriteTestFile(t, truncated, "a truncated photo")
+
+	photo := filepath.Join(src, "IMG_0002.png")
+	WriteTestImage(t, photo, true, 2)
+
+	opts := NewTestCopyOpts(t, []string{filepath.Join(src, "*.png")}, t.TempDir())
+
+	// links aren't benchmarked, so only grading is estimated
+	opts.link = HARD_LINK
+
+	cases := []struct {
+		sources []string
+		graded  bool
+	}{
+		{[]string{truncated, photo}, true},
+		{[]string{truncated}, false},
+	}
+
+	for _, tc := range cases {
+		media := make([]*Media, len(tc.sources))
+		for idx, source := range tc.sources {
+			media[idx] = &Media{source: source, sharpnessMetric: LAPLACIAN, gradeMaxEdge: GradeMaxEdge}
+		}
+
+		facts := &Facts{Count: len(media), PhotoCount: len(media)}
+
+		seconds, err := EstimateSeconds(NewMediaList(media), facts, opts)
+		if err != nil {
+			t.Fatalf("expected undecodable photos to be skipped, got %v", err)
+		}
+
+		if graded := seconds > 0; graded != tc.graded {
+			t.Errorf("expected grading %v to be estimated: %v, but estimated %v seconds", tc.sources, tc.graded, seconds)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+type LogEventKind string
+
+const (
+	COPIED  LogEventKind = "copied"
+	SKIPPED              = "skipped"
+	FAILED               = "failed"
+	GRADED               = "graded"
+	RETRIED              = "retried"
+	STARTED              = "started"
+)
+
+// How important a logged event is; events below the --log-level are dropped
+type LogLevel string
+
+const (
+	DEBUG LogLevel = "debug"
+	INFO           = "info"
+	WARN           = "warn"
+	ERROR          = "error"
+)
+
+// Levels, from least to most important
+var LogLevelRanks = map[LogLevel]int{
+	DEBUG: 0,
+	INFO:  1,
+	WARN:  2,
+	ERROR: 3,
+}
+
+/*
+ * Parse a --log-level name
+ */
+func ParseLogLevel(name string) (LogLevel, error) {
+	level := LogLevel(name)
+
+	if _, ok := LogLevelRanks[level]; !ok {
+		return "", fmt.Errorf("badger: unsupported --log-level '%v'; expected one of debug, info, warn or error", name)
+	}
+
+	return level, nil
+}
+
+type SkipReason string
+
+const (
+	ALREADY_EXISTS      SkipReason = "already-exists"
+	ALREADY_IMPORTED               = "already-imported"
+	BELOW_MIN_BLUR                 = "below-min-blur"
+	BURST_DUPLICATE                = "burst-duplicate"
+	OUTSIDE_TIME_WINDOW            = "outside-time-window"
+	TOO_FEW_FACES                  = "too-few-faces"
+	BADLY_EXPOSED                  = "badly-exposed"
+	FILTERED_OUT                   = "filtered-out"
+	SAME_CONTENT                   = "same-content"
+)
+
+// How each skip reason is described in a run's summary, in the order they're listed
+var SkipDescriptions = []struct {
+	reason      SkipReason
+	description string
+}{
+	{ALREADY_EXISTS, "media already in the destination"},
+	{SAME_CONTENT, "media whose content was already copied"},
+	{OUTSIDE_TIME_WINDOW, "media captured outside the time window"},
+	{FILTERED_OUT, "media left out by --filter"},
+	{BELOW_MIN_BLUR, "blurry media"},
+	{BADLY_EXPOSED, "badly exposed photos"},
+	{TOO_FEW_FACES, "photos with too few faces"},
+	{BURST_DUPLICATE, "duplicate frames within a burst"},
+}
+
+// A single line of the --log file
+type LogEvent struct {
+	Time        string       `json:"time"`
+	Level       LogLevel     `json:"level"`
+	Event       LogEventKind `json:"event"`
+	Stage       string       `json:"stage"`
+	Source      string       `json:"src,omitempty"`
+	Destination string       `json:"dst,omitempty"`
+	Hash        string       `json:"hash,omitempty"`
+	Blur        int          `json:"blur"`
+	Bytes       int64        `json:"bytes"`
+	Reason      SkipReason   `json:"reason,omitempty"`
+	Attempts    int          `json:"attempts,omitempty"`
+	Error       string       `json:"error,omitempty"`
+}
+
+// Records what happened to each media as JSON lines, for auditing unattended runs. Events are
+// appended to a file, printed as --json lines, streamed with --progress-json, or any of these.
+// A nil log records nothing
+type EventLog struct {
+	file     *os.File
+	stdout   bool
+	progress *ProgressStream
+	level    LogLevel
+	lock     sync.Mutex
+}
+
+/*
+ * Open a log file for appending, print events to stdout with --json, and stream them with
+ * --progress-json. Only events at `level` or above are recorded. Returns a nil log if events go nowhere
+ */
+func OpenEventLog(fpath string, stdout bool, progress *ProgressStream, level LogLevel) (*EventLog, error) {
+	if len(fpath) == 0 && !stdout && progress == nil {
+		return nil, nil
+	}
+
+	if len(fpath) == 0 {
+		return &EventLog{stdout: stdout, progress: progress, level: level}, nil
+	}
+
+	file, err := os.OpenFile(fpath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EventLog{file: file, stdout: stdout, progress: progress, level: level}, nil
+}
+
+/*
+ * Write an event as a single line. Lines are written straight to the file rather than buffered,
+ * so an interrupted run still leaves a record of everything that completed
+ */
+func (log *EventLog) Write(event LogEvent) {
+	if log == nil {
+		return
+	}
+
+	event.Time = time.Now().Format(time.RFC3339)
+
+	// progress displays need every event, whatever the --log-level
+	log.progress.Write(EVENT_LINE, event)
+
+	if LogLevelRanks[event.Level] < LogLevelRanks[log.level] {
+		return
+	}
+
+	if log.stdout {
+		PrintJsonLine(EVENT_LINE, event)
+	}
+
+	if log.file == nil {
+		return
+	}
+
+	line, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	log.lock.Lock()
+	defer log.lock.Unlock()
+
+	log.file.Write(append(line, '\n'))
+}
+
+/*
+ * Record a media starting to copy
+ */
+func (log *EventLog) Started(media *Media) {
+	log.Write(LogEvent{
+		Level:       DEBUG,
+		Event:       STARTED,
+		Stage:       "copy",
+		Source:      media.source,
+		Destination: media.GetDestinationPath(),
+		Bytes:       media.size,
+	})
+}
+
+/*
+ * Record a media copied (or linked) to its destination
+ */
+func (log *EventLog) Copied(media *Media) {
+	log.Write(LogEvent{
+		Level:       INFO,
+		Event:       COPIED,
+		Stage:       "copy",
+		Source:      media.source,
+		Destination: media.GetDestinationPath(),
+		Hash:        media.hash,
+		Blur:        media.blur,
+		Bytes:       media.size,
+	})
+}
+
+/*
+ * Record a media that was left out, and why
+ */
+func (log *EventLog) Skipped(stage string, media *Media, reason SkipReason) {
+	log.Write(LogEvent{
+		Level:  INFO,
+		Event:  SKIPPED,
+		Stage:  stage,
+		Source: media.source,
+		Hash:   media.hash,
+		Blur:   media.blur,
+		Bytes:  media.size,
+		Reason: reason,
+	})
+}
+
+/*
+ * Record a media that couldn't be processed, and the cause
+ */
+func (log *EventLog) Failed(stage string, media *Media, err error) {
+	log.Write(LogEvent{
+		Level:  ERROR,
+		Event:  FAILED,
+		Stage:  stage,
+		Source: media.source,
+		Blur:   media.blur,
+		Bytes:  media.size,
+		Error:  err.Error(),
+	})
+}
+
+/*
+ * Record a media's blur-score, once graded
+ */
+func (log *EventLog) Graded(media *Media) {
+	log.Write(LogEvent{
+		Level:  DEBUG,
+		Event:  GRADED,
+		Stage:  "grade",
+		Source: media.source,
+		Blur:   media.blur,
+	})
+}
+
+/*
+ * Record a media that only copied after retrying
+ */
+func (log *EventLog) Retried(media *Media, attempts int) {
+	log.Write(LogEvent{
+		Level:    WARN,
+		Event:    RETRIED,
+		Stage:    "copy",
+		Source:   media.source,
+		Attempts: attempts,
+	})
+}
+
+/*
+ * Record the error that ended a run, so the log shows where it stopped
+ */
+func (log *EventLog) RunFailed(err error) {
+	log.Write(LogEvent{
+		Level: ERROR,
+		Event: FAILED,
+		Stage: "run",
+		Error: err.Error(),
+	})
+}
+
+func (log *EventLog) Close() error {
+	if log == nil || log.file == nil {
+		return nil
+	}
+
+	return log.file.Close()
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"strings"
+
+	"github.com/rwcarlsen/goexif/exif"
+	"github.com/rwcarlsen/goexif/tiff"
+)
+
+/*
+ * Format a tag's first value as a string, e.g "1/250" for rationals
+ */
+func TagString(tag *tiff.Tag) string {
+	if tag.Format() == tiff.StringVal {
+		val, _ := tag.StringVal()
+		return val
+	}
+
+	return strings.Trim(strings.SplitN(tag.String(), ",", 2)[0], `[]"`)
+}
+
+/*
+ * Read a tag's first value as a float, whether it's stored as an integer, rational or float
+ */
+func TagFloat(tag *tiff.Tag) (float64, error) {
+	return TagFloatAt(tag, 0)
+}
+
+/*
+ * Read one of a tag's values as a float
+ */
+func TagFloatAt(tag *tiff.Tag, idx int) (float64, error) {
+	if idx >= int(tag.Count) {
+		return 0, errors.New("badger: exif tag has no values")
+	}
+
+	switch tag.Format() {
+	case tiff.IntVal:
+		val, err := tag.Int64(idx)
+		return float64(val), err
+	case tiff.FloatVal:
+		return tag.Float(idx)
+	case tiff.RatVal:
+		num, den, err := tag.Rat2(idx)
+		if err != nil {
+			return 0, err
+		}
+		if den == 0 {
+			return 0, errors.New("badger: exif rational has a zero denominator")
+		}
+
+		return float64(num) / float64(den), nil
+	}
+
+	return 0, errors.New("badger: exif tag is not numeric")
+}
+
+/*
+ * Read the exposure time in seconds; from ExposureTime, or else from the APEX ShutterSpeedValue
+ */
+func ReadShutterSeconds(metaData *exif.Exif) (string, float64) {
+	if tag, err := metaData.Get(exif.ExposureTime); err == nil {
+		if seconds, err := TagFloat(tag); err == nil {
+			return TagString(tag), seconds
+		}
+	}
+
+	if tag, err := metaData.Get(exif.ShutterSpeedValue); err == nil {
+		if apex, err := TagFloat(tag); err == nil {
+			return TagString(tag), math.Pow(2, -apex)
+		}
+	}
+
+	return "", 0
+}
+
+/*
+ * Read the aperture as an f-stop; from FNumber, or else from the APEX ApertureValue
+ */
+func ReadApertureFStop(metaData *exif.Exif) (string, float64) {
+	if tag, err := metaData.Get(exif.FNumber); err == nil {
+		if fstop, err := TagFloat(tag); err == nil {
+			return TagString(tag), fstop
+		}
+	}
+
+	if tag, err := metaData.Get(exif.ApertureValue); err == nil {
+		if apex, err := TagFloat(tag); err == nil {
+			return TagString(tag), math.Pow(2, apex/2)
+		}
+	}
+
+	return "", 0
+}
+
+/*
+ * Read the ISO speed
+ */
+func ReadIso(metaData *exif.Exif) (string, float64) {
+	if tag, err := metaData.Get(exif.ISOSpeedRatings); err == nil {
+		if iso, err := TagFloat(tag); err == nil {
+			return TagString(tag), iso
+		}
+	}
+
+	return "", 0
+}
+
+/*
+ * Read the orientation the camera stored the image in; one (upright) when it's missing or invalid
+ */
+func ReadOrientation(metaData *exif.Exif) int {
+	if tag, err := metaData.Get(exif.Orientation); err == nil {
+		if orientation, err := TagFloat(tag); err == nil && orientation >= 1 && orientation <= 8 {
+			return int(orientation)
+		}
+	}
+
+	return 1
+}
+
+/*
+ * Read the altitude, in metres above sea level; negative when GPSAltitudeRef marks it as below sea level
+ */
+func ReadAltitude(metaData *exif.Exif) (float64, bool) {
+	tag, err := metaData.Get(exif.GPSAltitude)
+	if err != nil {
+		return 0, false
+	}
+
+	altitude, err := TagFloat(tag)
+	if err != nil {
+		return 0, false
+	}
+
+	if ref, err := metaData.Get(exif.GPSAltitudeRef); err == nil {
+		if below, err := TagFloat(ref); err == nil && below == 1 {
+			altitude = -altitude
+		}
+	}
+
+	return altitude, true
+}
+
+// Tags with more values than this, like tone curves, aren't kept in the exif column
+const MaxExifTagValues = 16
+
+// Each decoded exif tag's value, keyed by tag name; text as strings, and numbers as a number or
+// list of numbers
+type ExifTags map[string]any
+
+/*
+ * Read every decoded exif tag. Binary tags, like maker-notes and thumbnails, aren't readable
+ * so aren't kept
+ */
+func ReadExifTags(metaData *exif.Exif) ExifTags {
+	tags := ExifTags{}
+	metaData.Walk(tags)
+
+	return tags
+}
+
+func (tags ExifTags) Walk(name exif.FieldName, tag *tiff.Tag) error {
+	switch tag.Format() {
+	case tiff.StringVal:
+		tags[string(name)] = strings.TrimSpace(TagString(tag))
+	case tiff.IntVal, tiff.FloatVal, tiff.RatVal:
+		if tag.Count == 0 || tag.Count > MaxExifTagValues {
+			return nil
+		}
+
+		values := []float64{}
+
+		for idx := 0; idx < int(tag.Count); idx++ {
+			value, err := TagFloatAt(tag, idx)
+
+			// JSON can't encode infinities or NaNs
+			if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+				return nil
+			}
+
+			values = append(values, value)
+		}
+
+		if len(values) == 1 {
+			tags[string(name)] = values[0]
+		} else {
+			tags[string(name)] = values
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// The format media metadata is exported in
+type ExportFormat string
+
+const (
+	// comma-separated values, with a header row of column names
+	CSV_EXPORT ExportFormat = "csv"
+	// an array of objects keyed by column name
+	JSON_EXPORT = "json"
+)
+
+// Each media's stored metadata, with the capture-time range and size of the cluster it was copied into.
+// The noise cluster isn't a cluster, so has no range
+var ExportQuery = fmt.Sprintf(`
+	SELECT mediaData.*, clusters.clusterFirst, clusters.clusterLast, clusters.clusterSize
+	FROM mediaData
+	LEFT JOIN (
+		SELECT runId, clusterId, MIN(mtime) AS clusterFirst, MAX(mtime) AS clusterLast, COUNT(*) AS clusterSize
+		FROM mediaData
+		WHERE skipped = 0 AND clusterId != %d
+		GROUP BY runId, clusterId
+	) AS clusters
+	ON clusters.runId IS mediaData.runId AND clusters.clusterId = mediaData.clusterId AND mediaData.skipped = 0
+	ORDER BY mediaData.runId, mediaData.clusterId, mediaData.mtime, mediaData.src`, NoiseClusterId)
+
+/*
+ * Parse an --format for exporting
+ */
+func ParseExportFormat(name string) (ExportFormat, error) {
+	switch ExportFormat(name) {
+	case CSV_EXPORT, JSON_EXPORT:
+		return ExportFormat(name), nil
+	}
+
+	return "", fmt.Errorf("badger: unsupported --format '%v'; expected csv or json", name)
+}
+
+/*
+ * Add the folder each media was copied into, relative to the library, since the destination path
+ * alone depends on where the library is mounted
+ */
+func AddExportFolders(dbDir string, result *QueryResult) {
+	dstIdx := 0
+	for idx, column := range result.columns {
+		if column == "dst" {
+			dstIdx = idx
+		}
+	}
+
+	result.columns = append(result.columns, "folder")
+
+	for idx, row := range result.rows {
+		folder := ""
+
+		if dst, ok := row[dstIdx].(string); ok {
+			if rel, err := filepath.Rel(dbDir, filepath.Dir(dst)); err == nil {
+				folder = rel
+			}
+		}
+
+		result.rows[idx] = append(row, folder)
+	}
+}
+
+/*
+ * Write a query's rows as CSV. Nulls are written as empty fields
+ */
+func WriteQueryCsv(result *QueryResult) error {
+	writer := csv.NewWriter(os.Stdout)
+
+	if err := writer.Write(result.columns); err != nil {
+		return err
+	}
+
+	for _, row := range result.rows {
+		fields := make([]string, len(row))
+
+		for idx, value := range row {
+			if value != nil {
+				fields[idx] = fmt.Sprint(value)
+			}
+		}
+
+		if err := writer.Write(fields); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+/*
+ * Print a destination library's media metadata as CSV or JSON, for spreadsheets and other tools
+ */
+func Export(dbDir string, format ExportFormat) int {
+	conn, err := NewSqliteDB(dbDir)
+	bail(err)
+
+	db := BadgerDb{conn}
+	defer db.Close()
+
+	// export the latest schema, whichever version of badger wrote the database
+	err = db.CreateTables()
+	bail(err)
+
+	result, err := db.Query(ExportQuery)
+	bail(err)
+
+	AddExportFolders(dbDir, result)
+
+	if format == CSV_EXPORT {
+		bail(WriteQueryCsv(result))
+		return 0
+	}
+
+	content, err := json.MarshalIndent(result.Objects(), "", "  ")
+	bail(err)
+
+	fmt.Println(string(content))
+
+	return 0
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"image"
+	"math"
+)
+
+// Pixels at least this bright count as clipped highlights
+const ClippedLevel = 250
+
+// Pixels at most this bright count as crushed shadows
+const CrushedLevel = 5
+
+// How much of a photo has lost detail to over- or under-exposure, as percentages of its pixels
+type Exposure struct {
+	Highlights float64
+	Shadows    float64
+}
+
+/*
+ * Measure the clipped-highlight and crushed-shadow percentages from an image's luminance histogram
+ */
+func GrayExposure(img *image.Gray) Exposure {
+	histogram := [256]int{}
+	bounds := img.Bounds()
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			histogram[img.GrayAt(x, y).Y] += 1
+		}
+	}
+
+	total := bounds.Dx() * bounds.Dy()
+	if total == 0 {
+		return Exposure{}
+	}
+
+	clipped := 0
+	for level := ClippedLevel; level < len(histogram); level++ {
+		clipped += histogram[level]
+	}
+
+	crushed := 0
+	for level := 0; level <= CrushedLevel; level++ {
+		crushed += histogram[level]
+	}
+
+	return Exposure{
+		Highlights: 100 * float64(clipped) / float64(total),
+		Shadows:    100 * float64(crushed) / float64(total),
+	}
+}
+
+/*
+ * Score an exposure from 0 to 100; the percentage of pixels neither clipped nor crushed
+ */
+func (exposure Exposure) Score() int {
+	return int(math.Round(100 - exposure.Highlights - exposure.Shadows))
+}
+
+/*
+ * Has more than `maxClipped` percent of a photo been clipped to white or crushed to black?
+ */
+func (exposure Exposure) Exceeds(maxClipped float64) bool {
+	return exposure.Highlights+exposure.Shadows > maxClipped
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	_ "embed"
+	"image"
+	"math"
+	"sync"
+
+	pigo "github.com/esimov/pigo/core"
+)
+
+// The pico face-detection cascade, as distributed with pigo
+//
+//go:embed cascade/facefinder
+var FaceCascade []byte
+
+// Photos are shrunk to this long-edge before detecting faces; it's much faster, and faces small
+// enough to be lost don't make a photo a portrait
+const FaceDetectMaxEdge = 1024
+
+// Detections scoring below this are discarded as false-positives
+const FaceQualityCutoff = 5.0
+
+var faceClassifier *pigo.Pigo
+var faceClassifierErr error
+var faceClassifierOnce sync.Once
+
+/*
+ * Unpack the face-detection cascade, once; the classifier is safe to share between workers
+ */
+func LoadFaceClassifier() (*pigo.Pigo, error) {
+	faceClassifierOnce.Do(func() {
+		faceClassifier, faceClassifierErr = pigo.NewPigo().Unpack(FaceCascade)
+	})
+
+	return faceClassifier, faceClassifierErr
+}
+
+/*
+ * Count the faces in a grayscale image
+ */
+func CountFaces(img *image.Gray) (int, error) {
+	classifier, err := LoadFaceClassifier()
+	if err != nil {
+		return 0, err
+	}
+
+	img, err = ScaleGrayToFit(img, FaceDetectMaxEdge)
+	if err != nil {
+		return 0, err
+	}
+
+	bounds := img.Bounds()
+	rows, cols := bounds.Dy(), bounds.Dx()
+
+	params := pigo.CascadeParams{
+		MinSize:     20,
+		MaxSize:     int(math.Max(float64(rows), float64(cols))),
+		ShiftFactor: 0.1,
+		ScaleFactor: 1.1,
+		ImageParams: pigo.ImageParams{
+			Pixels: GrayPixels(img),
+			Rows:   rows,
+			Cols:   cols,
+			Dim:    cols,
+		},
+	}
+
+	detections := classifier.RunCascade(params, 0.0)
+	detections = classifier.ClusterDetections(detections, 0.2)
+
+	faces := 0
+	for _, detection := range detections {
+		if detection.Q > FaceQualityCutoff {
+			faces += 1
+		}
+	}
+
+	return faces, nil
+}
+
+/*
+ * Get a grayscale image's pixels as consecutive rows, dropping any stride padding
+ */
+func GrayPixels(img *image.Gray) []uint8 {
+	bounds := img.Bounds()
+	cols := bounds.Dx()
+
+	if img.Stride == cols {
+		return img.Pix[:cols*bounds.Dy()]
+	}
+
+	pixels := make([]uint8, 0, cols*bounds.Dy())
+	for row := 0; row < bounds.Dy(); row++ {
+		start := row * img.Stride
+		pixels = append(pixels, img.Pix[start:start+cols]...)
+	}
+
+	return pixels
+}
+
+/*
+ * Count the faces in a photo; they're counted while it's decoded for grading, so it's decoded once
+ */
+func (media *Media) CountFaces() (int, error) {
+	if media.facesCounted {
+		return media.faces, nil
+	}
+
+	media.countFaces = true
+
+	if _, err := media.Grade(); err != nil {
+		return 0, err
+	}
+
+	// graded before faces were asked for, so decoded without counting them
+	if !media.facesCounted {
+		img, err := media.ReadGray()
+		if err != nil {
+			return 0, err
+		}
+
+		faces, err := CountFaces(img)
+		if err != nil {
+			return 0, err
+		}
+
+		media.faces = faces
+		media.facesCounted = true
+	}
+
+	return media.faces, nil
+}
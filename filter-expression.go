@@ -0,0 +1,539 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// The types a --filter expression's values can have
+type FilterKind string
+
+const (
+	NUMBER_FILTER FilterKind = "number"
+	STRING_FILTER            = "string"
+	BOOL_FILTER              = "bool"
+)
+
+// The fields of a media's metadata record that --filter expressions can refer to, and their types
+var FilterFields = map[string]FilterKind{
+	"type":     STRING_FILTER,
+	"ext":      STRING_FILTER,
+	"name":     STRING_FILTER,
+	"size":     NUMBER_FILTER,
+	"iso":      NUMBER_FILTER,
+	"aperture": NUMBER_FILTER,
+	"shutter":  NUMBER_FILTER,
+	"year":     NUMBER_FILTER,
+	"month":    NUMBER_FILTER,
+	"hour":     NUMBER_FILTER,
+	"located":  BOOL_FILTER,
+	"blur":     NUMBER_FILTER,
+}
+
+// A typed value within a --filter expression
+type FilterValue struct {
+	kind   FilterKind
+	number float64
+	text   string
+	truth  bool
+}
+
+// The values of each filter field for a single media
+type FilterRecord map[string]FilterValue
+
+// A node of a parsed --filter expression. Nodes are type-checked as they're parsed, so evaluating
+// one can't fail
+type FilterNode interface {
+	Kind() FilterKind
+	Eval(record FilterRecord) FilterValue
+}
+
+type literalNode struct {
+	value FilterValue
+}
+
+type fieldNode struct {
+	name string
+	kind FilterKind
+}
+
+type notNode struct {
+	operand FilterNode
+}
+
+type logicalNode struct {
+	op    string
+	left  FilterNode
+	right FilterNode
+}
+
+type compareNode struct {
+	op    string
+	left  FilterNode
+	right FilterNode
+}
+
+// A parsed --filter expression, and the fields it refers to
+type FilterExpression struct {
+	source string
+	root   FilterNode
+	fields map[string]bool
+}
+
+func (node literalNode) Kind() FilterKind { return node.value.kind }
+func (node fieldNode) Kind() FilterKind   { return node.kind }
+func (node notNode) Kind() FilterKind     { return BOOL_FILTER }
+func (node logicalNode) Kind() FilterKind { return BOOL_FILTER }
+func (node compareNode) Kind() FilterKind { return BOOL_FILTER }
+
+func (node literalNode) Eval(record FilterRecord) FilterValue {
+	return node.value
+}
+
+func (node fieldNode) Eval(record FilterRecord) FilterValue {
+	return record[node.name]
+}
+
+func (node notNode) Eval(record FilterRecord) FilterValue {
+	return FilterValue{kind: BOOL_FILTER, truth: !node.operand.Eval(record).truth}
+}
+
+func (node logicalNode) Eval(record FilterRecord) FilterValue {
+	left := node.left.Eval(record).truth
+
+	// short-circuit, like go
+	if node.op == "&&" && !left || node.op == "||" && left {
+		return FilterValue{kind: BOOL_FILTER, truth: left}
+	}
+
+	return FilterValue{kind: BOOL_FILTER, truth: node.right.Eval(record).truth}
+}
+
+func (node compareNode) Eval(record FilterRecord) FilterValue {
+	left := node.left.Eval(record)
+	right := node.right.Eval(record)
+
+	var truth bool
+
+	switch left.kind {
+	case NUMBER_FILTER:
+		switch node.op {
+		case "==":
+			truth = left.number == right.number
+		case "!=":
+			truth = left.number != right.number
+		case "<":
+			truth = left.number < right.number
+		case "<=":
+			truth = left.number <= right.number
+		case ">":
+			truth = left.number > right.number
+		case ">=":
+			truth = left.number >= right.number
+		}
+	case STRING_FILTER:
+		truth = (left.text == right.text) == (node.op == "==")
+	case BOOL_FILTER:
+		truth = (left.truth == right.truth) == (node.op == "==")
+	}
+
+	return FilterValue{kind: BOOL_FILTER, truth: truth}
+}
+
+// A token of a --filter expression, and the position it starts at
+type filterToken struct {
+	text     string
+	position int
+	// quoted strings are values, even if they look like operators or fields
+	quoted bool
+}
+
+/*
+ * Split a --filter expression into identifiers, numbers, quoted strings, operators and parentheses
+ */
+func TokenizeFilter(source string) ([]filterToken, error) {
+	tokens := []filterToken{}
+	runes := []rune(source)
+
+	for idx := 0; idx < len(runes); {
+		char := runes[idx]
+		start := idx
+
+		switch {
+		case unicode.IsSpace(char):
+			idx += 1
+			continue
+		case char == '"':
+			idx += 1
+			for idx < len(runes) && runes[idx] != '"' {
+				idx += 1
+			}
+
+			if idx == len(runes) {
+				return nil, fmt.Errorf("badger: unterminated string in --filter at position %v", start+1)
+			}
+
+			idx += 1
+			tokens = append(tokens, filterToken{string(runes[start+1 : idx-1]), start, true})
+			continue
+		case unicode.IsLetter(char) || char == '_':
+			for idx < len(runes) && (unicode.IsLetter(runes[idx]) || unicode.IsDigit(runes[idx]) || runes[idx] == '_') {
+				idx += 1
+			}
+		case unicode.IsDigit(char) || char == '.':
+			for idx < len(runes) && (unicode.IsDigit(runes[idx]) || runes[idx] == '.') {
+				idx += 1
+			}
+		case strings.ContainsRune("()", char):
+			idx += 1
+		default:
+			// two-character operators first, so <= isn't read as < then =
+			if idx+1 < len(runes) {
+				if pair := string(runes[idx : idx+2]); pair == "&&" || pair == "||" || pair == "==" || pair == "!=" || pair == "<=" || pair == ">=" {
+					tokens = append(tokens, filterToken{pair, start, false})
+					idx += 2
+					continue
+				}
+			}
+
+			if !strings.ContainsRune("<>!", char) {
+				return nil, fmt.Errorf("badger: unexpected '%c' in --filter at position %v", char, start+1)
+			}
+
+			idx += 1
+		}
+
+		tokens = append(tokens, filterToken{string(runes[start:idx]), start, false})
+	}
+
+	return tokens, nil
+}
+
+// A recursive-descent parser over a --filter expression's tokens
+type filterParser struct {
+	tokens []filterToken
+	idx    int
+	fields map[string]bool
+}
+
+/*
+ * Parse and type-check a --filter expression, like iso < 1600 && blur > 200 && type == "photo"
+ */
+func ParseFilterExpression(source string) (*FilterExpression, error) {
+	tokens, err := TokenizeFilter(source)
+	if err != nil {
+		return nil, err
+	}
+
+	parser := filterParser{tokens: tokens, fields: make(map[string]bool)}
+
+	root, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if parser.idx < len(tokens) {
+		return nil, parser.errorf("unexpected '%v'", tokens[parser.idx].text)
+	}
+
+	if root.Kind() != BOOL_FILTER {
+		return nil, fmt.Errorf("badger: --filter must be a condition, like iso < 1600, but '%v' is a %v", source, root.Kind())
+	}
+
+	return &FilterExpression{source, root, parser.fields}, nil
+}
+
+func (parser *filterParser) errorf(format string, args ...any) error {
+	position := "the end"
+	if parser.idx < len(parser.tokens) {
+		position = fmt.Sprintf("position %v", parser.tokens[parser.idx].position+1)
+	}
+
+	return fmt.Errorf("badger: could not parse --filter at %v: %v", position, fmt.Sprintf(format, args...))
+}
+
+func (parser *filterParser) peek() (filterToken, bool) {
+	if parser.idx >= len(parser.tokens) {
+		return filterToken{}, false
+	}
+
+	return parser.tokens[parser.idx], true
+}
+
+/*
+ * Is the next token an (unquoted) operator among `ops`?
+ */
+func (parser *filterParser) accept(ops ...string) (string, bool) {
+	token, ok := parser.peek()
+	if !ok || token.quoted {
+		return "", false
+	}
+
+	for _, op := range ops {
+		if token.text == op {
+			parser.idx += 1
+			return op, true
+		}
+	}
+
+	return "", false
+}
+
+func (parser *filterParser) parseOr() (FilterNode, error) {
+	return parser.parseLogical("||", parser.parseAnd)
+}
+
+func (parser *filterParser) parseAnd() (FilterNode, error) {
+	return parser.parseLogical("&&", parser.parseUnary)
+}
+
+/*
+ * Parse operands joined by a boolean operator, which all have to be conditions
+ */
+func (parser *filterParser) parseLogical(op string, parseOperand func() (FilterNode, error)) (FilterNode, error) {
+	left, err := parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		opIdx := parser.idx
+		if _, ok := parser.accept(op); !ok {
+			return left, nil
+		}
+
+		right, err := parseOperand()
+		if err != nil {
+			return nil, err
+		}
+
+		if left.Kind() != BOOL_FILTER || right.Kind() != BOOL_FILTER {
+			parser.idx = opIdx
+			return nil, parser.errorf("%v joins conditions, not a %v and a %v", op, left.Kind(), right.Kind())
+		}
+
+		left = logicalNode{op, left, right}
+	}
+}
+
+func (parser *filterParser) parseUnary() (FilterNode, error) {
+	if _, ok := parser.accept("!"); ok {
+		operand, err := parser.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		if operand.Kind() != BOOL_FILTER {
+			return nil, parser.errorf("! negates a condition, not a %v", operand.Kind())
+		}
+
+		return notNode{operand}, nil
+	}
+
+	return parser.parseComparison()
+}
+
+func (parser *filterParser) parseComparison() (FilterNode, error) {
+	left, err := parser.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	opIdx := parser.idx
+	op, ok := parser.accept("==", "!=", "<=", ">=", "<", ">")
+	if !ok {
+		return left, nil
+	}
+
+	right, err := parser.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	// type errors are reported at the operator
+	if left.Kind() != right.Kind() {
+		parser.idx = opIdx
+		return nil, parser.errorf("can't compare a %v with a %v", left.Kind(), right.Kind())
+	}
+
+	if left.Kind() != NUMBER_FILTER && op != "==" && op != "!=" {
+		parser.idx = opIdx
+		return nil, parser.errorf("%v only compares numbers, not a %v", op, left.Kind())
+	}
+
+	return compareNode{op, left, right}, nil
+}
+
+func (parser *filterParser) parsePrimary() (FilterNode, error) {
+	token, ok := parser.peek()
+	if !ok {
+		return nil, parser.errorf("expected a value, but the expression ended")
+	}
+
+	if token.quoted {
+		parser.idx += 1
+		return literalNode{FilterValue{kind: STRING_FILTER, text: token.text}}, nil
+	}
+
+	if _, ok := parser.accept("("); ok {
+		node, err := parser.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := parser.accept(")"); !ok {
+			return nil, parser.errorf("expected ')'")
+		}
+
+		return node, nil
+	}
+
+	if number, err := strconv.ParseFloat(token.text, 64); err == nil {
+		parser.idx += 1
+		return literalNode{FilterValue{kind: NUMBER_FILTER, number: number}}, nil
+	}
+
+	if token.text == "true" || token.text == "false" {
+		parser.idx += 1
+		return literalNode{FilterValue{kind: BOOL_FILTER, truth: token.text == "true"}}, nil
+	}
+
+	if kind, ok := FilterFields[token.text]; ok {
+		parser.idx += 1
+		parser.fields[token.text] = true
+		return fieldNode{token.text, kind}, nil
+	}
+
+	return nil, parser.errorf("unknown field '%v'", token.text)
+}
+
+/*
+ * Does the expression refer to a field?
+ */
+func (expr *FilterExpression) Uses(field string) bool {
+	return expr.fields[field]
+}
+
+/*
+ * Does a media's record satisfy the expression?
+ */
+func (expr *FilterExpression) Matches(record FilterRecord) bool {
+	return expr.root.Eval(record).truth
+}
+
+/*
+ * Build the metadata record --filter expressions are evaluated against. Fields a media doesn't
+ * record, like a video's ISO, are zero. The blur-score is passed in, since it's only computed when used
+ */
+func NewFilterRecord(media *Media, blur float64) (FilterRecord, error) {
+	info, err := media.GetInformation()
+	if err != nil {
+		return nil, err
+	}
+
+	size, err := media.Size()
+	if err != nil {
+		return nil, err
+	}
+
+	captured := time.Unix(int64(media.GetCreationTime()), 0)
+
+	number := func(value float64) FilterValue {
+		return FilterValue{kind: NUMBER_FILTER, number: value}
+	}
+
+	text := func(value string) FilterValue {
+		return FilterValue{kind: STRING_FILTER, text: value}
+	}
+
+	return FilterRecord{
+		"type":     text(string(media.GetType())),
+		"ext":      text(strings.ToLower(strings.TrimPrefix(media.GetExt(), "."))),
+		"name":     text(filepath.Base(media.source)),
+		"size":     number(float64(size)),
+		"iso":      number(info.IsoValue),
+		"aperture": number(info.ApertureFStop),
+		"shutter":  number(info.ShutterSeconds),
+		"year":     number(float64(captured.Year())),
+		"month":    number(float64(captured.Month())),
+		"hour":     number(float64(captured.Hour())),
+		"located":  {kind: BOOL_FILTER, truth: info.HasLocation},
+		"blur":     number(blur),
+	}, nil
+}
+
+/*
+ * Keep only media matching a --filter expression. Photos are only graded when the expression uses
+ * their blur-score, and raw images paired with a photo are scored by the photo. Media that aren't
+ * graded, like videos, have a score of zero, while photos that can't be decoded match no expression
+ * using blur. Media left out are logged as skipped
+ */
+func (library *MediaList) FilterByExpression(procCount int, db *BadgerDb, expr *FilterExpression, log *EventLog, quiet bool) (*MediaList, error) {
+	blurs := map[string]float64{}
+
+	if expr.Uses("blur") {
+		var err error
+
+		blurs, err = library.StoredBlurs(procCount, db, quiet)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	counter := NewProgressCounter("Filtering media", library.Size(), quiet)
+	defer counter.Done()
+
+	jobs := make(chan *Media, library.Size())
+	results := make(chan Either[*Media], library.Size())
+	var wg sync.WaitGroup
+
+	for pid := 0; pid < procCount; pid++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for media := range jobs {
+				counter.Increment()
+
+				blur := 0.0
+				if mediaType := media.GetType(); expr.Uses("blur") && (mediaType == PHOTO || mediaType == RAW) {
+					score, scored := blurs[library.GradingSource(media).source]
+					if !scored {
+						log.Skipped("list", media, FILTERED_OUT)
+						continue
+					}
+
+					blur = score
+				}
+
+				record, err := NewFilterRecord(media, blur)
+				if err != nil {
+					results <- Either[*Media]{nil, err}
+					continue
+				}
+
+				if expr.Matches(record) {
+					results <- Either[*Media]{media, nil}
+				} else {
+					log.Skipped("list", media, FILTERED_OUT)
+				}
+			}
+		}()
+	}
+
+	for _, media := range library.Values() {
+		jobs <- media
+	}
+
+	close(jobs)
+	wg.Wait()
+	close(results)
+
+	return library.KeepResults(results)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+/*
+ * A record of a sharp, high-ISO photo shot in July
+ */
+func NewTestFilterRecord() FilterRecord {
+	number := func(value float64) FilterValue {
+		return FilterValue{kind: NUMBER_FILTER, number: value}
+	}
+
+	text := func(value string) FilterValue {
+		return FilterValue{kind: STRING_FILTER, text: value}
+	}
+
+	return FilterRecord{
+		"type":     text("photo"),
+		"ext":      text("jpg"),
+		"name":     text("IMG_0001.jpg"),
+		"size":     number(4000000),
+		"iso":      number(3200),
+		"aperture": number(2.8),
+		"shutter":  number(0.01),
+		"year":     number(2021),
+		"month":    number(7),
+		"hour":     number(14),
+		"located":  {kind: BOOL_FILTER, truth: true},
+		"blur":     number(250),
+	}
+}
+
+func TestParseFilterExpression(t *testing.T) {
+	cases := []struct {
+		source  string
+		matches bool
+	}{
+		{`iso < 1600 && blur > 200 && type == "photo"`, false},
+		{`iso >= 1600 && blur > 200 && type == "photo"`, true},
+		{`iso < 1600 || blur > 200`, true},
+		{`!(iso < 1600)`, true},
+		{`iso < 1600 || blur > 200 && type == "video"`, false},
+		{`(iso < 1600 || blur > 200) && type != "video"`, true},
+		{`located == true && month == 7`, true},
+		{`!located`, false},
+		{`name == "IMG_0001.jpg"`, true},
+		{`ext == "&&"`, false},
+		{`shutter <= 0.01 && aperture > 2`, true},
+	}
+
+	record := NewTestFilterRecord()
+
+	for _, tc := range cases {
+		expr, err := ParseFilterExpression(tc.source)
+		if err != nil {
+			t.Errorf("expected %v to parse, got %v", tc.source, err)
+			continue
+		}
+
+		if matches := expr.Matches(record); matches != tc.matches {
+			t.Errorf("expected %v to match: %v, but was %v", tc.source, tc.matches, matches)
+		}
+	}
+}
+
+func TestParseFilterExpressionErrors(t *testing.T) {
+	for _, source := range []string{
+		`iso <`,
+		`iso < "1600"`,
+		`type < "photo"`,
+		`lens == "35mm"`,
+		`(iso < 1600`,
+		`iso < 1600)`,
+		`!iso`,
+		`iso`,
+		`iso < 1600 &&`,
+		`type == "photo`,
+	} {
+		if _, err := ParseFilterExpression(source); err == nil {
+			t.Errorf("expected %v to be rejected", source)
+		}
+	}
+}
+
+func TestFilterExpressionUses(t *testing.T) {
+	expr, err := ParseFilterExpression(`iso < 1600 && (blur > 200 || !located)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for field, used := range map[string]bool{"iso": true, "blur": true, "located": true, "type": false} {
+		if expr.Uses(field) != used {
+			t.Errorf("expected the expression to use %v: %v", field, used)
+		}
+	}
+}
+
+/*
+ * Raw images following their photo are filtered by the photo's blur-score, and media that can't be
+ * decoded match no expression using blur rather than failing the run
+ */
+func TestFilterByExpressionScoresPairs(t *testing.T) {
+	library, _ := NewTestPairedLibrary(t, FOLLOW_JPEG)
+
+	// a photo that can't be decoded
+	truncated := filepath.Join(filepath.Dir(library.Values()[0].source), "IMG_0004.png")
+	WriteTestFile(t, truncated, "a truncated photo")
+
+	media := append(library.Values(), &Media{source: truncated, hashAlgorithm: MD5, sharpnessMetric: LAPLACIAN})
+	library = NewMediaList(media)
+	library.pairing = FOLLOW_JPEG
+
+	expr, err := ParseFilterExpression("blur < 10")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filtered, err := library.FilterByExpression(2, nil, expr, nil, true)
+	if err != nil {
+		t.Fatalf("expected undecodable media not to fail filtering, got %v", err)
+	}
+
+	kept := []string{}
+	for _, media := range filtered.Values() {
+		kept = append(kept, filepath.Base(media.source))
+	}
+	sort.Strings(kept)
+
+	// the blurry photo and the raw image following it; not the sharp photo, nor media without a score
+	expected := []string{"IMG_0001.png", "IMG_0001.rw2"}
+
+	if !reflect.DeepEqual(kept, expected) {
+		t.Errorf("expected %v to be kept, got %v", expected, kept)
+	}
+}
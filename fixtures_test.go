@@ -0,0 +1,229 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+/*
+ * Write a small test image; a sharp image is a checkerboard, and a blurry one a flat grey. Each
+ * seed gives different content, so images aren't deduplicated by hash
+ */
+func WriteTestImage(t *testing.T, fpath string, sharp bool, seed int) {
+	t.Helper()
+
+	img := image.NewGray(image.Rect(0, 0, 256, 256))
+	for y := 0; y < 256; y++ {
+		for x := 0; x < 256; x++ {
+			value := uint8(128)
+			if sharp && (x/4+y/4)%2 == 0 {
+				value = 0
+			} else if sharp {
+				value = 255
+			}
+
+			img.SetGray(x, y, color.Gray{value})
+		}
+	}
+
+	// nudge a row of pixels by one level, spelling out the seed, without changing the image's sharpness
+	for bit := 0; bit < 16; bit++ {
+		if seed&(1<<bit) != 0 {
+			value := img.GrayAt(bit, 0).Y
+			if value == 255 {
+				value -= 1
+			} else {
+				value += 1
+			}
+
+			img.SetGray(bit, 0, color.Gray{value})
+		}
+	}
+
+	file, err := os.Create(fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	if strings.HasSuffix(strings.ToLower(fpath), ".png") {
+		err = png.Encode(file, img)
+	} else {
+		err = jpeg.Encode(file, img, &jpeg.Options{Quality: 100})
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+/*
+ * Write a file with fixed content
+ */
+func WriteTestFile(t *testing.T, fpath string, content string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(fpath), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(fpath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+/*
+ * Open the database badger wrote into a directory
+ */
+func OpenTestDb(t *testing.T, dir string) *BadgerDb {
+	t.Helper()
+
+	conn, err := NewSqliteDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := &BadgerDb{conn}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+/*
+ * Count the rows in the media table matching a condition
+ */
+func CountMediaRows(t *testing.T, db *BadgerDb, where string, args ...any) int {
+	t.Helper()
+
+	var count int
+	if err := db.db.QueryRow(`SELECT COUNT(*) FROM mediaData WHERE `+where, args...).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+
+	return count
+}
+
+/*
+ * Keep the archive index, and anything else badger caches, inside the test's temporary directory
+ */
+func IsolateCache(t *testing.T) {
+	t.Helper()
+
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+}
+
+/*
+ * Construct options for `badger copy`, run without prompting or progress output
+ */
+func NewTestCopyOpts(t *testing.T, from []string, to string) *BadgerOpts {
+	t.Helper()
+	IsolateCache(t)
+
+	opts := NewCopyOpts(from, to, to)
+	opts.yes = true
+	opts.quiet = true
+	opts.hashAlgorithm = MD5
+	opts.sharpnessMetric = LAPLACIAN
+	opts.loadWorkers = 2
+	opts.blurWorkers = 2
+	opts.copyWorkers = 2
+
+	return &opts
+}
+
+/*
+ * Record a copied media directly, with only the columns badger requires
+ */
+func InsertTestRow(t *testing.T, db *BadgerDb, src string, dst string, hash string) {
+	t.Helper()
+
+	_, err := db.db.Exec(`INSERT INTO mediaData (src, dst, hash, hashAlgorithm, id, clusterId, mediaType, runId)
+	VALUES (?, ?, ?, 'md5', 0, 0, 'photo', 'run')`, src, dst, hash)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+/*
+ * Create a database in a directory, recording a run into a destination
+ */
+func NewTestRunDb(t *testing.T, dir string, runId string, to string) *BadgerDb {
+	t.Helper()
+
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	db := OpenTestDb(t, dir)
+	if err := db.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(runId) > 0 {
+		if err := db.InsertRun(runId, []string{"/media/card/*"}, to, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return db
+}
+
+/*
+ * Run a function, returning what it printed to stdout
+ */
+func CaptureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := os.Stdout
+	os.Stdout = writer
+
+	// read concurrently, so a full pipe doesn't block the function
+	output := make(chan string)
+	go func() {
+		content, _ := io.ReadAll(reader)
+		output <- string(content)
+	}()
+
+	defer func() {
+		os.Stdout = stdout
+	}()
+
+	fn()
+	writer.Close()
+
+	return <-output
+}
+
+/*
+ * Change the working directory for the rest of a test
+ */
+func ChdirTest(t *testing.T, dir string) {
+	t.Helper()
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		os.Chdir(cwd)
+	})
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync"
+)
+
+// A named place, used for offline reverse-geocoding
+type City struct {
+	Name string
+	Lat  float64
+	Lng  float64
+}
+
+// Coordinates further than this from every known city are left unnamed
+const MaxCityDistanceKm = 150
+
+// A small offline database of places
+var Cities = []City{
+	{"Amsterdam", 52.3676, 4.9041},
+	{"Athens", 37.9838, 23.7275},
+	{"Auckland", -36.8485, 174.7633},
+	{"Bangkok", 13.7563, 100.5018},
+	{"Barcelona", 41.3874, 2.1686},
+	{"Beijing", 39.9042, 116.4074},
+	{"Belfast", 54.5973, -5.9301},
+	{"Berlin", 52.5200, 13.4050},
+	{"Boston", 42.3601, -71.0589},
+	{"Brussels", 50.8503, 4.3517},
+	{"Budapest", 47.4979, 19.0402},
+	{"Buenos Aires", -34.6037, -58.3816},
+	{"Cairo", 30.0444, 31.2357},
+	{"Cape Town", -33.9249, 18.4241},
+	{"Chicago", 41.8781, -87.6298},
+	{"Copenhagen", 55.6761, 12.5683},
+	{"Cork", 51.8985, -8.4756},
+	{"Delhi", 28.7041, 77.1025},
+	{"Dubai", 25.2048, 55.2708},
+	{"Dublin", 53.3498, -6.2603},
+	{"Edinburgh", 55.9533, -3.1883},
+	{"Florence", 43.7696, 11.2558},
+	{"Galway", 53.2707, -9.0568},
+	{"Glasgow", 55.8642, -4.2518},
+	{"Helsinki", 60.1699, 24.9384},
+	{"Hong Kong", 22.3193, 114.1694},
+	{"Istanbul", 41.0082, 28.9784},
+	{"Jakarta", -6.2088, 106.8456},
+	{"Johannesburg", -26.2041, 28.0473},
+	{"Kyoto", 35.0116, 135.7681},
+	{"Lagos", 6.5244, 3.3792},
+	{"Limerick", 52.6638, -8.6267},
+	{"Lisbon", 38.7223, -9.1393},
+	{"London", 51.5074, -0.1278},
+	{"Los Angeles", 34.0522, -118.2437},
+	{"Lyon", 45.7640, 4.8357},
+	{"Madrid", 40.4168, -3.7038},
+	{"Manchester", 53.4808, -2.2426},
+	{"Melbourne", -37.8136, 144.9631},
+	{"Mexico City", 19.4326, -99.1332},
+	{"Milan", 45.4642, 9.1900},
+	{"Montreal", 45.5017, -73.5673},
+	{"Moscow", 55.7558, 37.6173},
+	{"Mumbai", 19.0760, 72.8777},
+	{"Munich", 48.1351, 11.5820},
+	{"Nairobi", -1.2921, 36.8219},
+	{"Naples", 40.8518, 14.2681},
+	{"New York", 40.7128, -74.0060},
+	{"Oslo", 59.9139, 10.7522},
+	{"Paris", 48.8566, 2.3522},
+	{"Prague", 50.0755, 14.4378},
+	{"Reykjavik", 64.1466, -21.9426},
+	{"Rio de Janeiro", -22.9068, -43.1729},
+	{"Rome", 41.9028, 12.4964},
+	{"San Francisco", 37.7749, -122.4194},
+	{"Santiago", -33.4489, -70.6693},
+	{"Seattle", 47.6062, -122.3321},
+	{"Seoul", 37.5665, 126.9780},
+	{"Shanghai", 31.2304, 121.4737},
+	{"Singapore", 1.3521, 103.8198},
+	{"Stockholm", 59.3293, 18.0686},
+	{"Sydney", -33.8688, 151.2093},
+	{"Tokyo", 35.6762, 139.6503},
+	{"Toronto", 43.6532, -79.3832},
+	{"Vancouver", 49.2827, -123.1207},
+	{"Venice", 45.4408, 12.3155},
+	{"Vienna", 48.2082, 16.3738},
+	{"Warsaw", 52.2297, 21.0122},
+	{"Washington", 38.9072, -77.0369},
+	{"Zurich", 47.3769, 8.5417},
+}
+
+// Maps coordinates to a place name; an empty name means the place is unknown
+type GeocodeLookup func(lat float64, lng float64) (string, error)
+
+// Reverse-geocodes coordinates, caching lookups
+type Geocoder struct {
+	lookup GeocodeLookup
+	lock   sync.Mutex
+	cache  map[string]string
+}
+
+/*
+ * Construct a geocoder with a lookup function. The nearest city is used if none is provided
+ */
+func NewGeocoder(lookup GeocodeLookup) *Geocoder {
+	if lookup == nil {
+		lookup = NearestCity
+	}
+
+	return &Geocoder{
+		lookup: lookup,
+		cache:  make(map[string]string),
+	}
+}
+
+/*
+ * Look up a place-name for a set of coordinates. Coordinates are
+ * rounded to ~1km, so nearby photos share a cache entry
+ */
+func (geo *Geocoder) Lookup(lat float64, lng float64) (string, error) {
+	key := fmt.Sprintf("%.2f,%.2f", lat, lng)
+
+	geo.lock.Lock()
+	defer geo.lock.Unlock()
+
+	if name, ok := geo.cache[key]; ok {
+		return name, nil
+	}
+
+	name, err := geo.lookup(lat, lng)
+	if err != nil {
+		return "", err
+	}
+
+	geo.cache[key] = name
+
+	return name, nil
+}
+
+/*
+ * Find the nearest city within MaxCityDistanceKm of a set of coordinates
+ */
+func NearestCity(lat float64, lng float64) (string, error) {
+	name := ""
+	nearest := math.Inf(1)
+
+	for _, city := range Cities {
+		distance := HaversineKm(lat, lng, city.Lat, city.Lng)
+
+		if distance < nearest {
+			nearest = distance
+			name = city.Name
+		}
+	}
+
+	if nearest > MaxCityDistanceKm {
+		return "", nil
+	}
+
+	return name, nil
+}
+
+/*
+ * Great-circle distance between two coordinates, in kilometres
+ */
+func HaversineKm(lat0 float64, lng0 float64, lat1 float64, lng1 float64) float64 {
+	const earthRadiusKm = 6371.0
+
+	toRadians := func(deg float64) float64 {
+		return deg * math.Pi / 180
+	}
+
+	dLat := toRadians(lat1 - lat0)
+	dLng := toRadians(lng1 - lng0)
+
+	a := math.Pow(math.Sin(dLat/2), 2) +
+		math.Cos(toRadians(lat0))*math.Cos(toRadians(lat1))*math.Pow(math.Sin(dLng/2), 2)
+
+	return earthRadiusKm * 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
@@ -6,20 +6,30 @@ require (
 	bitbucket.org/sjbog/go-dbscan v0.0.0-20150721083751-f30c2f04d63c
 	github.com/Ernyoke/Imger v0.0.0-20210929183401-55700becd332
 	github.com/buger/goterm v1.0.3
+	github.com/cespare/xxhash/v2 v2.1.2
 	github.com/docopt/docopt-go v0.0.0-20180111231733-ee0de3bc6815
+	github.com/esimov/pigo v1.4.5
 	github.com/gdamore/tcell v1.4.0
 	github.com/google/gops v0.3.22
+	github.com/jdeng/goheif v0.0.0-20200323230657-a0d6a8b3e68f
 	github.com/manifoldco/promptui v0.9.0
 	github.com/mattn/go-sqlite3 v1.14.9
+	github.com/pkg/sftp v1.13.4
 	github.com/rivo/tview v0.0.0-20211202162923-2a6de950f73b
 	github.com/rwcarlsen/goexif v0.0.0-20190401172101-9e8deecbddbd
+	github.com/zeebo/xxh3 v1.0.2
+	golang.org/x/crypto v0.0.0-20211215153901-e495a2d5b3d3
 	golang.org/x/sys v0.0.0-20211216021012-1d35b9e2eb4e
+	gopkg.in/yaml.v3 v3.0.1
+	lukechampine.com/blake3 v1.1.7
 )
 
 require (
 	github.com/chzyer/readline v0.0.0-20180603132655-2972be24d48e // indirect
 	github.com/gdamore/encoding v1.0.0 // indirect
 	github.com/gdamore/tcell/v2 v2.4.1-0.20210905002822-f057f0a857a1 // indirect
+	github.com/klauspost/cpuid/v2 v2.0.9 // indirect
+	github.com/kr/fs v0.1.0 // indirect
 	github.com/lucasb-eyer/go-colorful v1.2.0 // indirect
 	github.com/mattn/go-runewidth v0.0.13 // indirect
 	github.com/rivo/uniseg v0.2.0 // indirect
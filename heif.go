@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/jdeng/goheif"
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+func init() {
+	// decoded images otherwise point into memory the decoder frees
+	goheif.SafeEncoding = true
+}
+
+/*
+ * Is this an HEIC/HEIF image, like those iPhones take?
+ */
+func IsHeif(fpath string) bool {
+	ext := strings.ToLower(path.Ext(fpath))
+	return ext == ".heic" || ext == ".heif"
+}
+
+/*
+ * Decode the exif metadata stored as an item in an HEIF container
+ */
+func LoadHeifExif(fpath string) (*exif.Exif, error) {
+	file, err := os.Open(fpath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	data, err := goheif.ExtractExif(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return exif.Decode(bytes.NewReader(data))
+}
+
+/*
+ * Decode an HEIF image's primary image
+ */
+func ReadHeif(fpath string) (image.Image, error) {
+	file, err := os.Open(fpath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return goheif.Decode(file)
+}
+
+/*
+ * Read an HEIF image as a grayscale image
+ */
+func ReadHeifGray(fpath string) (*image.Gray, error) {
+	img, err := ReadHeif(fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	gray := image.NewGray(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(gray, gray.Bounds(), img, bounds.Min, draw.Src)
+
+	return gray, nil
+}
+
+/*
+ * Read an HEIF image as a colour image
+ */
+func ReadHeifRGBA(fpath string) (*image.RGBA, error) {
+	img, err := ReadHeif(fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Src)
+
+	return rgba, nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+/*
+ * Record media's exif, hashes, sizes and blur-scores in a library's database without copying them, so
+ * the library can be analysed and queried first, and copied from selectively later. Indexed media
+ * aren't treated as imported, so later runs still copy them
+ */
+func Index(opts *BadgerOpts) int {
+	log, err := OpenEventLog(opts.logPath, false, nil, opts.logLevel)
+	bail(err)
+	defer log.Close()
+
+	opts.log = log
+
+	library, err := opts.ListMedia()
+	bail(err)
+
+	err = library.LoadInformation(opts.loadWorkers, opts.quiet)
+	bail(err)
+
+	err = os.MkdirAll(opts.dbDir, os.ModePerm)
+	bail(err)
+
+	conn, err := NewSqliteDB(opts.dbDir)
+	bail(err)
+
+	db := BadgerDb{conn}
+	defer db.Close()
+
+	err = db.CreateTables()
+	bail(err)
+
+	err = db.InsertRun(opts.runId, SourceGlobs(opts.from, opts.fromDirs), opts.to, opts.args)
+	bail(err)
+
+	// indexed media aren't clustered
+	entries := make([]Media, library.Size())
+	for idx, media := range library.Values() {
+		entries[idx] = *media
+		entries[idx].clusterId = NoiseClusterId
+	}
+
+	clusters := &MediaCluster{entries: entries}
+
+	if !opts.quiet {
+		fmt.Printf("Indexing %v media...\n", len(entries))
+	}
+
+	graded := CalcuateBlur(opts.blurWorkers, 0, 0, 100, false, &db, library, clusters, opts.log)
+
+	writer := db.StartMediaWriter(MediaBatchSize, opts.log)
+	defer writer.Close()
+
+	indexed := 0
+	failed := 0
+
+	for pair := range graded {
+		if err := writer.Err(); err != nil {
+			bail(err)
+		}
+
+		// unreadable media are logged, and left out of the index
+		if pair.Error != nil {
+			failed += 1
+			continue
+		}
+
+		media := pair.Value
+
+		// graded media are already hashed, but videos aren't
+		if _, err := media.GetHash(); err != nil {
+			opts.log.Failed("hash", &media, err)
+			failed += 1
+			continue
+		}
+
+		media.skipped = true
+		media.indexed = true
+
+		writer.Write(&media)
+		indexed += 1
+	}
+
+	err = writer.Close()
+	bail(err)
+
+	fmt.Printf("badger: indexed %v media into %v, without copying them\n", indexed, opts.dbDir)
+
+	if failed > 0 {
+		fmt.Printf("badger: failed to read %v media\n", failed)
+	}
+
+	return 0
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+/*
+ * Every media is recorded, even with more media than blur-workers; workers read the database while
+ * the writer holds its batch open
+ */
+func TestIndexRecordsEveryMedia(t *testing.T) {
+	src := t.TempDir()
+	dbDir := t.TempDir()
+
+	count := 40
+	for idx := 0; idx < count; idx++ {
+		WriteTestImage(t, filepath.Join(src, fmt.Sprintf("IMG_%04d.png", idx)), idx%2 == 0, idx)
+	}
+
+	opts := &BadgerOpts{
+		from:            []string{filepath.Join(src, "*.png")},
+		dbDir:           dbDir,
+		hashAlgorithm:   MD5,
+		sharpnessMetric: LAPLACIAN,
+		runId:           "index-test",
+		quiet:           true,
+		loadWorkers:     2,
+		blurWorkers:     2,
+	}
+
+	if code := Index(opts); code != 0 {
+		t.Fatalf("expected index to succeed, got exit code %v", code)
+	}
+
+	db := OpenTestDb(t, dbDir)
+
+	if indexed := CountMediaRows(t, db, "indexed = 1"); indexed != count {
+		t.Errorf("expected %v indexed media, got %v", count, indexed)
+	}
+
+	if blank := CountMediaRows(t, db, "hash = ''"); blank != 0 {
+		t.Errorf("expected every indexed media to be hashed, but %v weren't", blank)
+	}
+}
+
+/*
+ * A single file can be indexed, as indexing doesn't cluster media
+ */
+func TestIndexOneFile(t *testing.T) {
+	src := t.TempDir()
+	dbDir := t.TempDir()
+
+	WriteTestImage(t, filepath.Join(src, "IMG_0001.png"), true, 1)
+
+	opts := &BadgerOpts{
+		from:            []string{filepath.Join(src, "IMG_0001.png")},
+		dbDir:           dbDir,
+		hashAlgorithm:   MD5,
+		sharpnessMetric: LAPLACIAN,
+		runId:           "index-test",
+		quiet:           true,
+		loadWorkers:     2,
+		blurWorkers:     2,
+	}
+
+	if code := Index(opts); code != 0 {
+		t.Fatalf("expected index to succeed, got exit code %v", code)
+	}
+
+	if indexed := CountMediaRows(t, OpenTestDb(t, dbDir), "indexed = 1"); indexed != 1 {
+		t.Errorf("expected the file to be indexed, got %v indexed media", indexed)
+	}
+}
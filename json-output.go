@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// Each --json line is tagged with its type, and holds its value under a key of the same name;
+// e.g {"type": "facts", "facts": {...}}
+type JsonLineKind string
+
+const (
+	FACTS_LINE    JsonLineKind = "facts"
+	PLAN_LINE                  = "plan"
+	EVENT_LINE                 = "event"
+	PROGRESS_LINE              = "progress"
+	SUMMARY_LINE               = "summary"
+	ERROR_LINE                 = "error"
+)
+
+// The outcome of a run, printed as the last --json line
+type RunSummary struct {
+	RunId             string             `json:"runId"`
+	Copied            int                `json:"copied"`
+	Skipped           int                `json:"skipped"`
+	SkipReasons       map[SkipReason]int `json:"skipReasons,omitempty"`
+	Imported          int                `json:"imported"`
+	ThumbnailFailures int                `json:"thumbnailFailures"`
+	Failed            int                `json:"failed"`
+	Failures          []string           `json:"failures,omitempty"`
+}
+
+// workers print events concurrently, so lines are written one at a time
+var jsonLineLock sync.Mutex
+
+/*
+ * Encode a single --json line, tagged with its type
+ */
+func JsonLine(kind JsonLineKind, value any) ([]byte, error) {
+	return json.Marshal(map[string]any{
+		"type":       kind,
+		string(kind): value,
+	})
+}
+
+/*
+ * Print a single --json line to stdout
+ */
+func PrintJsonLine(kind JsonLineKind, value any) error {
+	line, err := JsonLine(kind, value)
+	if err != nil {
+		return err
+	}
+
+	jsonLineLock.Lock()
+	defer jsonLineLock.Unlock()
+
+	fmt.Println(string(line))
+
+	return nil
+}
+
+/*
+ * Report a run's failure as a --json line, rather than as text
+ */
+func PrintJsonError(err error) {
+	PrintJsonLine(ERROR_LINE, err.Error())
+}
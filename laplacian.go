@@ -0,0 +1,126 @@
+package main
+
+import (
+	"image"
+	"math"
+	"runtime"
+	"sync"
+)
+
+// Images are split into bands of at least this many rows, each scored by its own goroutine
+const LaplacianMinBandRows = 64
+
+// Counts of each laplacian value in part of an image. The laplacian is clamped to a byte, so
+// its variance can be computed from a histogram rather than from every pixel
+type LaplacianHistogram [256]int64
+
+/*
+ * Count the laplacian values (using the 4-neighbour kernel) of rows [minRow, maxRow) of an image. Pixels
+ * beyond the image's border count as black, and values are clamped to 0..255
+ */
+func CountLaplacianBand(img *image.Gray, minRow int, maxRow int, histogram *LaplacianHistogram) {
+	width := img.Rect.Dx()
+	height := img.Rect.Dy()
+	stride := img.Stride
+	pix := img.Pix
+
+	for y := minRow; y < maxRow; y++ {
+		row := pix[y*stride : y*stride+width]
+
+		var above, below []uint8
+		if y > 0 {
+			above = pix[(y-1)*stride : (y-1)*stride+width]
+		}
+		if y < height-1 {
+			below = pix[(y+1)*stride : (y+1)*stride+width]
+		}
+
+		for x := 0; x < width; x++ {
+			sum := -4 * int(row[x])
+
+			if x > 0 {
+				sum += int(row[x-1])
+			}
+			if x < width-1 {
+				sum += int(row[x+1])
+			}
+			if above != nil {
+				sum += int(above[x])
+			}
+			if below != nil {
+				sum += int(below[x])
+			}
+
+			if sum < 0 {
+				sum = 0
+			} else if sum > 255 {
+				sum = 255
+			}
+
+			histogram[sum] += 1
+		}
+	}
+}
+
+/*
+ * Score how sharp a grayscale image is, by the variance of its laplacian. Bands of rows are
+ * counted in parallel, and their histograms merged
+ */
+func GrayBlur(img *image.Gray) (float64, error) {
+	height := img.Rect.Dy()
+	pixels := int64(img.Rect.Dx()) * int64(height)
+
+	if pixels == 0 {
+		return 0, nil
+	}
+
+	bands := runtime.NumCPU()
+	if maxBands := (height + LaplacianMinBandRows - 1) / LaplacianMinBandRows; bands > maxBands {
+		bands = maxBands
+	}
+
+	histograms := make([]LaplacianHistogram, bands)
+	rowsPerBand := (height + bands - 1) / bands
+	var wg sync.WaitGroup
+
+	for band := 0; band < bands; band++ {
+		minRow := band * rowsPerBand
+		maxRow := minRow + rowsPerBand
+
+		if maxRow > height {
+			maxRow = height
+		}
+
+		wg.Add(1)
+
+		go func(band int, minRow int, maxRow int) {
+			defer wg.Done()
+			CountLaplacianBand(img, minRow, maxRow, &histograms[band])
+		}(band, minRow, maxRow)
+	}
+
+	wg.Wait()
+
+	var histogram LaplacianHistogram
+	for _, bandHistogram := range histograms {
+		for value, count := range bandHistogram {
+			histogram[value] += count
+		}
+	}
+
+	pixSum := 0.0
+	for value, count := range histogram {
+		pixSum += float64(value) * float64(count)
+	}
+
+	mean := pixSum / float64(pixels)
+
+	variance := 0.0
+	for value, count := range histogram {
+		variance += float64(count) * math.Pow(float64(value)-mean, 2)
+	}
+
+	variance = variance / float64(pixels)
+
+	return math.Ceil(variance * 10), nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"image"
+	"math"
+	"math/rand"
+	"path/filepath"
+	"testing"
+
+	ed "github.com/Ernyoke/Imger/edgedetection"
+	"github.com/Ernyoke/Imger/imgio"
+	"github.com/Ernyoke/Imger/padding"
+)
+
+/*
+ * Score an image the way badger did before the laplacian was counted in bands; Imger's 4-neighbour
+ * laplacian, with black borders, and the variance of every pixel
+ */
+func ImgerGrayBlur(t *testing.T, img *image.Gray) float64 {
+	t.Helper()
+
+	laplacian, err := ed.LaplacianGray(img, padding.BorderConstant, ed.K4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pixSum := 0.0
+	for _, pix := range laplacian.Pix {
+		pixSum += float64(pix)
+	}
+
+	mean := pixSum / float64(len(laplacian.Pix))
+
+	variance := 0.0
+	for _, pix := range laplacian.Pix {
+		variance += math.Pow(float64(pix)-mean, 2)
+	}
+
+	return math.Ceil(variance / float64(len(laplacian.Pix)) * 10)
+}
+
+/*
+ * Construct an image of random noise, which clamps many laplacian values at both ends
+ */
+func NewNoiseImage(width int, height int, seed int64) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	rand.New(rand.NewSource(seed)).Read(img.Pix)
+
+	return img
+}
+
+/*
+ * Copy an image into one whose rows are padded by extra bytes, as some decoders leave them. Imger ignores
+ * the bounds' origin, so images are compared from (0, 0)
+ */
+func NewPaddedImage(img *image.Gray, extra int) *image.Gray {
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	padded := &image.Gray{
+		Pix:    make([]uint8, (width+extra)*height),
+		Stride: width + extra,
+		Rect:   image.Rect(0, 0, width, height),
+	}
+
+	for y := 0; y < height; y++ {
+		copy(padded.Pix[y*padded.Stride:], img.Pix[y*img.Stride:y*img.Stride+width])
+	}
+
+	return padded
+}
+
+/*
+ * Read a fixture image, as written by WriteTestImage
+ */
+func ReadTestImage(t *testing.T, sharp bool, seed int) *image.Gray {
+	t.Helper()
+
+	fpath := filepath.Join(t.TempDir(), "IMG_0001.png")
+	WriteTestImage(t, fpath, sharp, seed)
+
+	img, err := imgio.ImreadGray(fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return img
+}
+
+func TestGrayBlurMatchesImger(t *testing.T) {
+	noise := NewNoiseImage(300, 200, 1)
+
+	cases := []struct {
+		name string
+		img  *image.Gray
+	}{
+		{"sharp fixture", ReadTestImage(t, true, 1)},
+		{"blurry fixture", ReadTestImage(t, false, 2)},
+		{"noise", noise},
+		{"noise across several bands", NewNoiseImage(97, LaplacianMinBandRows*5+3, 2)},
+		{"single row", NewNoiseImage(64, 1, 3)},
+		{"single column", NewNoiseImage(1, 64, 4)},
+		{"single pixel", NewNoiseImage(1, 1, 5)},
+		{"image with a wider stride", NewPaddedImage(noise, 7)},
+	}
+
+	for _, tc := range cases {
+		actual, err := GrayBlur(tc.img)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected := ImgerGrayBlur(t, tc.img); actual != expected {
+			t.Errorf("expected the %v to score %v, as with Imger, but scored %v", tc.name, expected, actual)
+		}
+	}
+}
+
+func BenchmarkComputeBlur(b *testing.B) {
+	// roughly a 12 megapixel photo, graded at full resolution
+	img := NewNoiseImage(4000, 3000, 1)
+
+	b.SetBytes(int64(len(img.Pix)))
+	b.ResetTimer()
+
+	for idx := 0; idx < b.N; idx++ {
+		if _, err := GrayBlur(img); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
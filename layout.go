@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// A --layout placeholder, like {yyyy}
+var LayoutPlaceholder = regexp.MustCompile(`\{([a-z]+)\}`)
+
+// The date a layout placeholder is replaced by, as a Go time-layout
+var LayoutDateFields = map[string]string{
+	"yyyy": "2006",
+	"mm":   "01",
+	"dd":   "02",
+}
+
+/*
+ * Check a --layout, like {yyyy}/{mm}/{dd}/{cluster}, only uses known placeholders and stays within --to
+ */
+func ParseLayout(layout string) (string, error) {
+	for _, match := range LayoutPlaceholder.FindAllStringSubmatch(layout, -1) {
+		if _, ok := LayoutDateFields[match[1]]; !ok && match[1] != "cluster" {
+			return "", fmt.Errorf("badger: unsupported placeholder %v in --layout '%v'; expected {yyyy}, {mm}, {dd} or {cluster}", match[0], layout)
+		}
+	}
+
+	clean := filepath.Clean(layout)
+	if len(layout) == 0 || filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("badger: --layout '%v' must be a relative path within --to", layout)
+	}
+
+	return layout, nil
+}
+
+/*
+ * Render a --layout for a cluster starting at `start`, with its existing folder-name as {cluster}
+ */
+func RenderLayout(layout string, start time.Time, label string) string {
+	return LayoutPlaceholder.ReplaceAllStringFunc(layout, func(placeholder string) string {
+		name := strings.Trim(placeholder, "{}")
+
+		if name == "cluster" {
+			return label
+		}
+
+		return start.Format(LayoutDateFields[name])
+	})
+}
+
+/**
+ * Nest each cluster-folder by a --layout, under folders for the date the cluster starts. Sub-clusters are
+ * dated by the cluster they were split from, so they stay together. Unclustered media span many dates,
+ * so keep their own folder
+ */
+func (cluster *MediaCluster) LayoutClusters(layout string) {
+	starts := cluster.ClusterStarts()
+	labels := make(map[int]string)
+
+	for clusterId := 0; clusterId < cluster.clusters; clusterId++ {
+		start := time.Unix(int64(starts[cluster.GetParent(clusterId)]), 0)
+		labels[clusterId] = RenderLayout(layout, start, cluster.GetLabel(clusterId))
+	}
+
+	cluster.labels = labels
+
+	for idx := range cluster.entries {
+		cluster.entries[idx].clusterLabel = cluster.GetLabel(cluster.entries[idx].clusterId)
+	}
+}
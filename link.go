@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// How media are linked to their destination, rather than copied
+type LinkMode string
+
+const (
+	NO_LINK   LinkMode = ""
+	HARD_LINK LinkMode = "hard"
+	REFLINK   LinkMode = "reflink"
+	SYMLINK   LinkMode = "symlink"
+)
+
+// Returned when a link can't be made, e.g because the source and destination are on different filesystems.
+// Retrying won't help
+var ErrCantLink = errors.New("could not link")
+
+/*
+ * Parse a --link mode
+ */
+func ParseLinkMode(name string) (LinkMode, error) {
+	switch mode := LinkMode(name); mode {
+	case HARD_LINK, REFLINK, SYMLINK:
+		return mode, nil
+	}
+
+	return NO_LINK, fmt.Errorf("badger: unsupported --link '%v'; expected one of hard, reflink or symlink", name)
+}
+
+/*
+ * Hard link or reflink a file to a local destination path. Both need the destination on the same
+ * filesystem as the source, and reflinks need a copy-on-write filesystem like btrfs or XFS
+ */
+func LinkFile(mode LinkMode, source string, fpath string) error {
+	if mode == REFLINK {
+		return Reflink(source, fpath)
+	}
+
+	err := os.Link(source, fpath)
+	if errors.Is(err, os.ErrExist) {
+		return err
+	}
+
+	if err != nil {
+		return fmt.Errorf("%w %v with a hard link; is --to on the same filesystem? %v", ErrCantLink, source, err)
+	}
+
+	return nil
+}
@@ -4,7 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"runtime"
+	"text/template"
+	"time"
 
 	tm "github.com/buger/goterm"
 	"github.com/docopt/docopt-go"
@@ -15,8 +18,20 @@ import (
 const Usage = `badger: cluster photos by date, and sort by blurriness.
 
 Usage:
-	badger cluster --from=<srcglob> --to=<dstdir> [-s <num>|--max-seconds-diff <num>] [-m <num>|--min-points <num>] [-y|--yes]
-	badger copy --from=<srcglob> --to=<dstdir> [--media (all|photo|video|raw|unknown)] [--max-iso <iso>] [--min-shutter-speed <speed>]
+	badger cluster [--from=<srcglob>]... [--from-dir=<dir>]... [--from-list=<file>]... [--null] [--exclude <glob>]... --to=<dstdir> [-s <num>|--max-seconds-diff <num>|--auto-eps] [-m <num>|--min-points <num>] [--drop-noise] [--noise <policy>] [--max-cluster-size <num>] [--since <timestamp>] [--after <date>] [--until <timestamp>] [--before <date>] [--sample <n> [--seed <num>]] [--filter <expr>] [--min-blur <blur>] [--reject-below <blur>] [--normalize-blur] [--pairing <policy>] [--on-exists <policy>] [--incremental] [--skip-same-content [--scan-to]] [--dedup-bursts [--burst-window <num>]] [--group-duplicates [--distance <n>]] [--count-faces] [--min-faces <n>] [--max-clipped <pct>] [--no-preserve-times] [--preserve <attrs>] [--symlink|--move] [--link <mode>] [--verify] [--name-template <template>] [--layout <layout>] [--flatten] [--thumbnails] [--ignore-orientation] [--geocode] [--cluster-by <dimensions>] [--geo-cluster] [--geo-distance <km>] [--sharpness-metric <metric>] [--full-resolution] [--hash <algorithm>] [--map-ext <mapping>]... [--load-workers <num>] [--copy-workers <num> | --adaptive-workers [--min-copy-workers <num>] [--max-copy-workers <num>]] [--blur-workers <num>] [--retries <num>] [--log <path>] [--log-level <level>] [--progress-json <target>] [--config <path>] [--profile <name>] [-q|--quiet|--tui] [-y|--yes] [--json-plan|--dry-run|--json]
+	badger copy [--from=<srcglob>]... [--from-dir=<dir>]... [--from-list=<file>]... [--null] [--exclude <glob>]... --to=<dstdir> [--media <type>] [--max-iso <iso>] [--min-shutter-speed <speed>] [--min-blur <blur>] [--max-blur <blur>] [--after <date>] [--before <date>] [--filter <expr>] [--preserve <attrs>] [--verify] [--skip-same-content [--scan-to]] [--hash <algorithm>] [--map-ext <mapping>]... [--copy-workers <num>] [--retries <num>] [--log <path>] [--log-level <level>] [--progress-json <target>] [--config <path>] [--profile <name>] [-q|--quiet] [-y|--yes] [--json]
+	badger resume --to=<dstdir> [-y|--yes]
+	badger index [--from=<srcglob>]... [--from-dir=<dir>]... [--from-list=<file>]... [--null] [--exclude <glob>]... --to=<dstdir> [--hash <algorithm>] [--map-ext <mapping>]... [--sharpness-metric <metric>] [--full-resolution] [--load-workers <num>] [--blur-workers <num>] [--log <path>] [--log-level <level>] [--config <path>] [--profile <name>] [-q|--quiet]
+	badger import --camera --to=<dstdir> [--port <port>] [--staging <dir>] [--config <path>] [--profile <name>] [-y|--yes]
+	badger watch --from-dir=<dir> --to=<dstdir> [--debounce <seconds>] [--config <path>] [--profile <name>]
+	badger verify --db=<dir> [--run <id>] [--config <path>]
+	badger undo --db=<dir> [--run <id>|--since <timestamp>] [--unchanged-only] [--config <path>] [-y|--yes]
+	badger runs --db=<dir> [--config <path>]
+	badger dupes --db=<dir> [--distance <n>] [--config <path>]
+	badger stats --db=<dir> [--json] [--config <path>]
+	badger export --db=<dir> [--format <format>] [--config <path>]
+	badger db query --db=<dir> [<sql>] [--blurriest] [--largest-clusters] [--errors] [--limit <n>] [--json] [--config <path>]
+	badger db merge <dir>... --out=<dir> [--config <path>]
 	badger (-h|--help)
 
 Description:
@@ -25,15 +40,154 @@ Description:
 Commans:
 	badger cluster                 cluster photos by date, and sort by blurriness.
 	badger copy                    copy media matching a set of filters into a target folder.
+	badger resume                  re-run the latest run into a directory, skipping media it copied intact before it was interrupted.
+	badger index                   record media's exif, hashes, sizes and blur-scores in a directory's database, without copying them.
+	badger import                  download media straight from a camera attached over USB, then cluster & copy it.
+	badger watch                   watch a folder for newly arriving media, and cluster & copy it once it stops arriving.
+	badger verify                  check copied media against the hashes stored when they were copied, and report extra files.
+	badger undo                    remove media copied by the latest run, and forget them.
+	badger runs                    list the runs that copied media into a directory.
+	badger dupes                   report groups of near-duplicate images, like one shot exported at two qualities.
+	badger stats                   summarise a directory's clusters, sizes, blur, ISO, shutter-speeds and capture dates.
+	badger export                  print a directory's media metadata as CSV or JSON, with each cluster's capture-time range.
+	badger db query                run SQL, or a canned query, against a directory's metadata database, without changing it.
+	badger db merge                merge the metadata databases of several directories into one, deduplicating media by content.
 
 Options:
-	--from=<srcglob>               source glob
-	--to=<dstdir>                  target directory
-	--yes                          complete copy without manual prompt
-	--max-seconds-diff <num>       max seconds photos can be apart in order to cluster them together [default: 9]
-	--min-shutter-speed <speed>    minimum shutter speed for images to copy.
-	--min-points <num>             minimum number of media to cluster [default: 2]
-	--max-iso <iso>                maximum iso for images to copy.
+	--config <path>                a YAML file of default flag values, keyed by flag name; e.g 'max-seconds-diff: 30m'. Flags given
+	                               on the command-line take precedence. Defaults to ~/.config/badger/config.yaml, if present
+	--profile <name>               overlay a named set of defaults from the config file's 'profiles' key, like 'travel' or 'studio'
+	--from=<srcglob>               source glob. Repeat, or comma-separate, to merge several cards or folders
+	--from-dir=<dir>               source folder, searched recursively for media with a known extension (and their sidecars),
+	                               like a camera's nested DCIM folders. Hidden folders aren't searched. Repeat to merge several
+	--from-list=<file>             a file listing source paths, one per line, or - to read them from stdin (which needs --yes);
+	                               e.g to select media with find. Repeat to merge several
+	--null                         read --from-list paths separated by NUL characters rather than lines, as printed by find -print0
+	--exclude <glob>               leave out listed files matching a glob, like '*.LRV' for GoPro proxies. Globs match each
+	                               file's name or path, ignoring case. Repeat to exclude several
+	--to=<dstdir>                  target directory, or a remote one like sftp://user@host/photos. Remote destinations authenticate
+	                               with ssh-agent, and keep their database under ~/.cache/badger/<host>/<path>
+	--camera                       import from a PTP/MTP camera, using gphoto2, without mounting its card as a folder
+	--port <port>                  the gphoto2 port of the camera to import from, like usb:001,005, if several are attached
+	--staging <dir>                download camera media into this folder, and keep it; otherwise a temporary folder is used
+	                               and removed once imported
+	--debounce <seconds>           when watching, how long no new media must arrive before it's imported [default: 5]
+	--db=<dir>                     a directory badger copied media into, containing its metadata database
+	-y, --yes                      complete copy without manual prompt
+	--json                         print JSON rather than text. Statistics are printed as one object; cluster and copy print JSON lines
+	                               of the facts, the plan, each file's result, progress, and a summary. Needs --yes
+	--blurriest                    query the blurriest graded photos copied
+	--largest-clusters             query the clusters with the most media, per run
+	--errors                       query photos that couldn't be decoded, so were copied without a blur-score
+	--limit <n>                    the most rows a canned query prints [default: 20]
+	--format <format>              the format to export metadata in; csv or json [default: csv]
+	--out=<dir>                    the directory to write the merged metadata database into; merging into an existing one adds to it
+	--distance <n>                 max bits perceptual hashes can differ by for images to count as near-duplicates [default: 4]
+	--run <id>                     only consider media copied by this run; see 'badger runs'
+	--since <timestamp>            a date or time, like 2021-07-04 or 2021-07-04T15:04:05Z. When clustering, only copy media captured
+	                               since then. When undoing, undo every run since then, rather than only the latest
+	--until <timestamp>            only copy media captured until a date or time, like 2021-07-31 or 2021-07-31T18:00:00Z
+	--after <date>                 only copy media captured since a date or time, or within a relative span of hours, days or
+	                               weeks, like 12h, 7d or 2w
+	--before <date>                only copy media captured before a date or time (not on that date), or longer ago than a
+	                               relative span, like 7d
+	--unchanged-only               only remove files whose hash still matches the hash stored when they were copied
+	--json-plan                    print the clustering plan as JSON, with each cluster's members and a summary, and exit without copying
+	--dry-run                      grade the media and print where each would be copied, without writing to the destination
+	--tui                          show copy progress in a full-screen terminal UI
+	-q, --quiet                    don't draw progress to the terminal; print JSON progress lines while copying instead
+	-s, --max-seconds-diff <num>   max seconds (or a duration, like 30m) photos can be apart in order to cluster them together [default: 9]
+	--auto-eps                     pick --max-seconds-diff for this library, from the knee of its gaps between capture-times
+	--media <type>                 only copy media of a type; all, photo, raw, video or unknown [default: all]
+	--min-shutter-speed <speed>    only copy images taken at this shutter speed or faster, like 1/250. Media without a recorded
+	                               shutter speed are copied
+	-m, --min-points <num>         minimum number of media to cluster [default: 2]
+	--noise <policy>               what to do with media too far apart from any others to cluster; copy them into an
+	                               'unclustered' folder (own-folder), add each to the nearest cluster (assign-nearest), or
+	                               don't copy them (skip) [default: own-folder]
+	--drop-noise                   don't copy media too far apart from any others to cluster; the same as --noise skip
+	--max-cluster-size <num>       split clusters with more media than this into sequential parts, e.g 2021-07-04_part1
+	--pairing <policy>             how raw images paired with a jpeg are graded; follow-jpeg copies or skips the pair together,
+	                               based on the jpeg. independent grades each image on its own [default: follow-jpeg]
+	--on-exists <policy>           what to do when a destination file already exists; skip it, overwrite it (unless the content
+	                               is identical), or rename the new copy with a numeric suffix to keep both [default: skip]
+	--incremental                  skip media an earlier run already imported, matched by source path or content hash, even if
+	                               the copy was since renamed
+	--skip-same-content            skip media whose content was already copied, whatever its name; by an earlier run, if the
+	                               copy is still there, or earlier in this run
+	--scan-to                      also skip media with the same content as a file already in --to, even if badger didn't copy it
+	--dedup-bursts                 only copy the sharpest photo from each burst within a cluster
+	--burst-window <num>           max seconds photos can be apart to be considered part of the same burst [default: 2]
+	--group-duplicates             prefix near-duplicate photos within a cluster with a shared group number, like dup1_, to cull them
+	--count-faces                  count the faces in each photo, to record in the database and name portraits by
+	--min-faces <n>                skip photos with fewer than n faces; implies --count-faces [default: 0]
+	--max-clipped <pct>            skip photos with more than this percent of their pixels clipped to white or crushed to black,
+	                               as badly exposed [default: 100]
+	--no-preserve-times            don't copy each file's original access & modification times onto its copy, like preserving
+	                               none
+	--preserve <attrs>             the attributes copied from each file onto its copy; a list of times (access & modification
+	                               times), mode (permissions) and xattrs (extended attributes, on local --to only), or all or
+	                               none. Times are preserved by default
+	--symlink                      link to the original media rather than copying it, to browse clusters without duplicating files.
+	                               The same as a symlink --link
+	--link <mode>                  link to the original media rather than copying it; hard, reflink or symlink. Hard links and
+	                               reflinks need --to on the same filesystem as the media, and reflinks a copy-on-write
+	                               filesystem like btrfs or XFS. Unlike symlinks, they survive the original being removed
+	--move                         move media rather than copying it. Media are renamed on the same filesystem; otherwise the
+	                               source is only removed once its copy's hash matches. Skipped media are left in place
+	--verify                       re-read each copy and compare it to its source's hash before recording it as copied. Copies
+	                               that don't match are removed, and retried
+	--name-template <template>     a Go text/template for copied filenames, with fields .Blur, .Id, .Ext, .ClusterLabel,
+	                               .CaptureDate, .OriginalBase, .DuplicateGroup, .Faces and .Exposure. e.g '{{.CaptureDate.Format "2006-01-02_150405"}}_{{.OriginalBase}}{{.Ext}}'
+	--layout <layout>              nest cluster-folders under folders for the date each cluster starts, like
+	                               '{yyyy}/{mm}/{dd}/{cluster}'. {yyyy}, {mm} and {dd} are the start's year, month and day, and
+	                               {cluster} the cluster's own folder-name. Unclustered media keep their own folder
+	--flatten                      copy everything into --to directly, rather than into cluster-folders
+	--thumbnails                   write a small jpeg preview of each copied image under .thumbs, mirroring the cluster-folders
+	--ignore-orientation           grade & thumbnail images as stored, rather than turned upright using their exif orientation
+	--geocode                      name cluster-folders by date and the place photos were taken, using GPS metadata
+	--cluster-by <dimensions>      the dimensions to cluster along; time, or time,gps to split shoots in different places [default: time]
+	--geo-cluster                  shorthand for --cluster-by time,gps
+	--geo-distance <km>            kilometres apart photos can be to cluster them together, when taken at the same time. Weights
+	                               location against time; this distance counts the same as --max-seconds-diff [default: 1]
+	--sharpness-metric <metric>    the metric photos are graded for sharpness by; laplacian (variance), tenengrad, sobel
+	                               (variance), or modified-laplacian. Scores from different metrics aren't comparable [default: laplacian]
+	--full-resolution              grade photos at full resolution, rather than shrunk to a 1024px long-edge. Much slower, and
+	                               scores are only comparable between photos of the same resolution
+	--hash <algorithm>             the algorithm used to hash media; md5, sha256, xxh64, xxh3 or blake3 [default: xxh64]
+	--map-ext <mapping>            treat files with an extension as a photo, raw, video or unknown media; e.g '.cr3=raw'. Repeatable.
+	                               Common raw and video formats are recognised by default
+	--load-workers <num>           number of workers reading file information before clustering. Defaults to the number of CPUs
+	--copy-workers <num>           number of workers copying files. Copying is IO-bound; use more for fast disks, and fewer for
+	                               slow network mounts [default: 10]
+	--adaptive-workers             tune the number of copy workers to the destination's throughput, adding workers while copying
+	                               speeds up and removing them when it slows; for disks that slow down under contention
+	--min-copy-workers <num>       the fewest copy workers, with --adaptive-workers [default: 1]
+	--max-copy-workers <num>       the most copy workers, with --adaptive-workers [default: 32]
+	--blur-workers <num>           number of workers grading images. Grading is CPU-bound. Defaults to one less than the number of CPUs
+	--retries <num>                times to retry copying a file after a transient failure, backing off between attempts [default: 3]
+	--log <path>                   append a JSON line to this file for every media copied, skipped or failed, as an audit trail
+	--log-level <level>            the least important events logged; debug (adds each grade), info (each copy or skip), warn
+	                               (adds retried copies), or error (only failures) [default: info]
+	--progress-json <target>       stream JSON lines as each media starts copying, is copied, skipped or fails, and the bytes
+	                               copied so far, for other programs to show progress. Lines go to an open file descriptor,
+	                               like fd:3, or a listening UNIX socket, like unix:/tmp/badger.sock
+	--sample <n>                   only process a random sample of n shots, to quickly try out settings. A raw image and its jpeg
+	                               count as one shot, and are sampled together
+	--seed <num>                   the seed used to choose a --sample; the same seed chooses the same shots [default: 1]
+	--filter <expr>                only copy media matching an expression, like 'iso < 1600 && blur > 200 && type == "photo"'.
+	                               Fields are type, ext and name (strings), size, iso, aperture, shutter (in seconds), year,
+	                               month, hour and blur (numbers) and located (true or false); those a file doesn't record
+	                               are zero. Join conditions with &&, || and !, and compare with ==, !=, <, <=, > and >=.
+	                               Photos are only graded up front when the expression uses blur
+	--min-blur <blur>              skip photos (and their raw images) with a blur-score below this cutoff [default: 0]
+	--reject-below <blur>          copy photos (and their raw images) with a blur-score below this cutoff into a rejects folder,
+	                               mirroring the cluster-folders, so soft frames can be culled in one go [default: 0]
+	--max-blur <blur>              only copy photos with a blur-score at or below this cutoff, to review rejects. Scores are read
+	                               from the database when an earlier run graded the photo, and computed otherwise
+	--normalize-blur               rank blur-scores from 0 (blurriest) to 100 (sharpest) within the library. Every photo is graded
+	                               before any are copied, and --min-blur and --reject-below become percentiles
+	--max-iso <iso>                only copy images taken at this ISO or lower. Media without a recorded ISO are copied
 
 License:
 	The MIT License
@@ -53,30 +207,111 @@ License:
 	OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
 `
 
+// Worker-counts above this are almost certainly a mistake
+const MaxWorkers = 256
+
 // Badger docopt-arguments
 type BadgerOpts struct {
-	from           string
-	to             string
-	maxSecondsDiff float64
-	minPoints      int
-	yes            bool
-	copyWorkers    int
-	blurWorkers    int
+	from              []string
+	fromDirs          []string
+	excludes          []string
+	fromLists         []string
+	null              bool
+	to                string
+	dstDir            string
+	dbDir             string
+	destination       Destination
+	logPath           string
+	logLevel          LogLevel
+	log               *EventLog
+	progressJson      string
+	progress          *ProgressStream
+	maxSecondsDiff    float64
+	autoEps           bool
+	minPoints         int
+	noise             NoisePolicy
+	maxClusterSize    int
+	sample            int
+	seed              int64
+	since             int
+	until             int
+	minBlur           float64
+	rejectBelow       float64
+	normalizeBlur     bool
+	pairing           PairingPolicy
+	onExists          ExistsPolicy
+	incremental       bool
+	skipSameContent   bool
+	scanTo            bool
+	resume            bool
+	args              []string
+	dedupBursts       bool
+	burstWindow       float64
+	groupDuplicates   bool
+	duplicateDistance int
+	countFaces        bool
+	minFaces          int
+	maxClipped        float64
+	filter            *FilterExpression
+	preserve          PreserveAttrs
+	link              LinkMode
+	move              bool
+	verify            bool
+	nameTemplate      *template.Template
+	hashAlgorithm     HashAlgorithm
+	sharpnessMetric   SharpnessMetric
+	gradeMaxEdge      int
+	flatten           bool
+	layout            string
+	thumbnails        bool
+	ignoreOrientation bool
+	geocode           bool
+	geoCluster        bool
+	geoDistanceKm     float64
+	yes               bool
+	jsonPlan          bool
+	json              bool
+	dryRun            bool
+	copyOnly          bool
+	quiet             bool
+	tui               bool
+	loadWorkers       int
+	retries           int
+	runId             string
+	copyWorkers       int
+	adaptiveWorkers   bool
+	minCopyWorkers    int
+	maxCopyWorkers    int
+	blurWorkers       int
 }
 
 // Facts about the media-library, like size and count
 type Facts struct {
-	Count        int
-	Size         int
-	VideoCount   int
-	PhotoCount   int
-	RawCount     int
-	UnknownCount int
-	VideoSize    int
-	PhotoSize    int
-	RawSize      int
-	UnknownSize  int
-	FreeSpace    uint64
+	Count        int    `json:"count"`
+	Size         int    `json:"size"`
+	VideoCount   int    `json:"videoCount"`
+	PhotoCount   int    `json:"photoCount"`
+	RawCount     int    `json:"rawCount"`
+	UnknownCount int    `json:"unknownCount"`
+	VideoSize    int    `json:"videoSize"`
+	PhotoSize    int    `json:"photoSize"`
+	RawSize      int    `json:"rawSize"`
+	UnknownSize  int    `json:"unknownSize"`
+	FreeSpace    uint64 `json:"freeSpace"`
+	ClusterCount int    `json:"clusterCount"`
+
+	// media too far from any others to cluster, copied into their own folder
+	UnclusteredCount int `json:"unclusteredCount"`
+
+	// media too far from any others to cluster, however --noise handled them
+	NoiseCount int `json:"noiseCount"`
+
+	// approximately how long copying will take; zero if not estimated
+	EstimatedSeconds float64 `json:"estimatedSeconds"`
+
+	// media whose content badger already copied somewhere in the archive, and where
+	ArchivedCount int `json:"archivedCount"`
+	archived      []ArchiveMatch
 }
 
 /*
@@ -91,7 +326,7 @@ func bail(err error) {
 /*
  * Gather facts about the job that will be run
  */
-func GatherFacts(library *MediaList) (*Facts, error) {
+func GatherFacts(library *MediaList, destination Destination, dstDir string) (*Facts, error) {
 	size := 0
 	videoCount := 0
 	photoCount := 0
@@ -129,7 +364,7 @@ func GatherFacts(library *MediaList) (*Facts, error) {
 		}
 	}
 
-	freeSpace, err := GetFreeSpace("/home/rg")
+	freeSpace, err := destination.FreeSpace(dstDir)
 	bail(err)
 
 	return &Facts{
@@ -147,27 +382,97 @@ func GatherFacts(library *MediaList) (*Facts, error) {
 	}, nil
 }
 
+/*
+ * Parse --after and --before into an inclusive capture window of unix times; a zero bound is left open
+ */
+func ParseCaptureRange(opts docopt.Opts, now time.Time) (int, int, error) {
+	since := 0
+	if text, ok := opts["--after"].(string); ok {
+		after, _, err := ParseRelativeDate(text, now)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		since = int(after.Unix())
+	}
+
+	until := 0
+	if text, ok := opts["--before"].(string); ok {
+		var err error
+		if until, err = ParseBefore(text, now); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	return since, until, nil
+}
+
 /*
  * Ask whether the user wants to proceed with a copy
  */
 func PromptCopy(clusters *MediaCluster, facts *Facts, opts *BadgerOpts) (bool, error) {
-	if facts.FreeSpace < uint64(facts.Size) {
-		return false, fmt.Errorf("not enough free-space under / to copy files: %v vs %v bytes", facts.FreeSpace, facts.Size)
+	// links take up next to no space, so only check free-space when copying
+	spaceSummary := "links will be created to the original media, rather than copies"
+
+	if opts.link == NO_LINK {
+		if facts.FreeSpace < uint64(facts.Size) {
+			return false, fmt.Errorf("not enough free-space under %v to copy files: %v free, but %v to copy", opts.to, HumanizeBytes(facts.FreeSpace), HumanizeBytes(uint64(facts.Size)))
+		}
+
+		spaceSummary = "there will be " + HumanizeBytes(facts.FreeSpace-uint64(facts.Size)) + " free after copying"
+	}
+
+	// scripts read the facts and plan as --json lines instead
+	if opts.json {
+		if err := PrintJsonLine(FACTS_LINE, facts); err != nil {
+			return false, err
+		}
+
+		return true, PrintJsonLine(PLAN_LINE, NewPlan(clusters, nil))
+	}
+
+	totalSizeSummary := HumanizeBytes(uint64(facts.Size))
+	photosSizeSummary := HumanizeBytes(uint64(facts.PhotoSize))
+	rawSizeSummary := HumanizeBytes(uint64(facts.RawSize))
+	videoSizeSummary := HumanizeBytes(uint64(facts.VideoSize))
+	unknownSizeSummary := HumanizeBytes(uint64(facts.UnknownSize))
+
+	destSummary := "Badger will group this media into " + fmt.Sprint(facts.ClusterCount) + " cluster-folders.\n"
+	if facts.UnclusteredCount > 0 {
+		destSummary += fmt.Sprint(facts.UnclusteredCount) + " media too far from any others to cluster will be copied into '" + UnclusteredLabel + "'.\n"
+	} else if facts.NoiseCount > 0 && opts.noise == ASSIGN_NEAREST {
+		destSummary += fmt.Sprint(facts.NoiseCount) + " media too far from any others to cluster will be added to the nearest cluster.\n"
+	} else if facts.NoiseCount > 0 && opts.noise == SKIP_NOISE {
+		destSummary += fmt.Sprint(facts.NoiseCount) + " media too far from any others to cluster won't be copied.\n"
+	}
+	if opts.flatten {
+		destSummary = "Badger will copy this media into a single folder.\n"
 	}
 
-	freeAfterMb := fmt.Sprintf("%.2f", float64(facts.FreeSpace-uint64(facts.Size))/1e9)
+	if facts.ArchivedCount > 0 {
+		destSummary += "\n" + fmt.Sprint(facts.ArchivedCount) + " media are already in the archive, e.g:\n"
 
-	totalSizeSummary := fmt.Sprintf("%.2f", float64(facts.Size)/1.0e9)
-	photosSizeSummary := fmt.Sprintf("%.2f", float64(facts.PhotoSize)/1.0e9)
-	rawSizeSummary := fmt.Sprintf("%.2f", float64(facts.RawSize)/1.0e9)
-	videoSizeSummary := fmt.Sprintf("%.2f", float64(facts.VideoSize)/1.0e9)
+		for idx, match := range facts.archived {
+			if idx == ArchiveExamples {
+				break
+			}
 
-	message := ("Badger 🦡\n\n" + "Examining...\n" + fmt.Sprint(facts.Count) + " media files (" + totalSizeSummary + " gigabytes)\n" +
-		fmt.Sprint(facts.PhotoCount) + " photos (" + photosSizeSummary + " gigabytes)\n" +
-		fmt.Sprint(facts.RawCount) + " raw images (" + rawSizeSummary + " gigabytes)\n" +
-		fmt.Sprint(facts.VideoCount) + " videos (" + videoSizeSummary + " gigabytes)\n\n" +
-		"Badger will group this media into " + fmt.Sprint(clusters.ClusterSize()) + " cluster-folders.\n" +
-		"there will be " + fmt.Sprint(freeAfterMb) + " gigabytes free after copying")
+			destSummary += "\t" + match.source + " is at " + match.location + "\n"
+		}
+	}
+
+	if facts.EstimatedSeconds > 0 {
+		estimate := time.Duration(facts.EstimatedSeconds * float64(time.Second)).Round(time.Second)
+		spaceSummary += "\ncopying will take roughly " + estimate.String() + " (an approximate estimate)"
+	}
+
+	message := ("Badger 🦡\n\n" + "Examining...\n" + fmt.Sprint(facts.Count) + " media files (" + totalSizeSummary + ")\n" +
+		fmt.Sprint(facts.PhotoCount) + " photos (" + photosSizeSummary + ")\n" +
+		fmt.Sprint(facts.RawCount) + " raw images (" + rawSizeSummary + ")\n" +
+		fmt.Sprint(facts.VideoCount) + " videos (" + videoSizeSummary + ")\n" +
+		fmt.Sprint(facts.UnknownCount) + " other files (" + unknownSizeSummary + ")\n\n" +
+		destSummary +
+		spaceSummary)
 
 	fmt.Println(message)
 
@@ -200,23 +505,149 @@ func PromptCopy(clusters *MediaCluster, facts *Facts, opts *BadgerOpts) (bool, e
  * Core application. Cluster media into a new folder
  */
 func Badger(opts *BadgerOpts) int {
+	// connect to the destination up front, so a bad host fails before any work is done
+	destination, dstDir, err := OpenDestination(opts.to)
+	bail(err)
+	defer destination.Close()
+
+	opts.destination = destination
+	opts.dstDir = dstDir
+
+	progress, err := OpenProgressStream(opts.progressJson)
+	bail(err)
+	defer progress.Close()
+
+	opts.progress = progress
+
+	log, err := OpenEventLog(opts.logPath, opts.json, progress, opts.logLevel)
+	bail(err)
+	defer log.Close()
+
+	opts.log = log
+
 	// list everything that will be targeted
 	library, err := opts.ListMedia()
 
 	bail(err)
 
+	// clustering needs at least two media; copy and index have no such limit
+	if library.Size() < 2 && library.excluded > 0 {
+		bail(fmt.Errorf("badger: --exclude left out %v of the listed files, leaving fewer than two; are the --exclude globs right?", library.excluded))
+	}
+
+	if library.Size() < 2 {
+		bail(errors.New("badger: the '--from', '--from-dir' and '--from-list' sources only matched one file; is your device connected, and the glob valid and not just a directory path?"))
+	}
+
+	// load file information up front, in parallel
+	err = library.LoadInformation(opts.loadWorkers, opts.quiet)
+	bail(err)
+
+	// leave out media captured outside the --since/--until window
+	if opts.since > 0 || opts.until > 0 {
+		library, err = library.FilterByCaptureTime(opts.since, opts.until, opts.log)
+		bail(err)
+
+		// clustering needs at least two media; copy has no such limit
+		if library.Size() < 2 {
+			bail(errors.New("badger: fewer than two files were captured within the time window; are --since, --until, --after or --before right?"))
+		}
+	}
+
+	if opts.filter != nil {
+		db, err := OpenExistingDb(opts.dbDir)
+		bail(err)
+
+		library, err = library.FilterByExpression(opts.loadWorkers, db, opts.filter, opts.log, opts.quiet)
+		if db != nil {
+			db.Close()
+		}
+		bail(err)
+
+		if library.Size() < 2 {
+			bail(fmt.Errorf("badger: fewer than two files matched --filter '%v'", opts.filter.source))
+		}
+	}
+
 	// gather information about the media to be clustered
-	facts, err := GatherFacts(library)
+	facts, err := GatherFacts(library, destination, dstDir)
 	bail(err)
 
 	// cluster media by time
-	clusters := ClusterMedia(opts.maxSecondsDiff, opts.minPoints, library)
+	geoDistanceKm := 0.0
+	if opts.geoCluster {
+		geoDistanceKm = opts.geoDistanceKm
+	}
+
+	if opts.autoEps {
+		if epsilon := AutoEpsilon(opts.minPoints, library); epsilon > 0 {
+			opts.maxSecondsDiff = epsilon
+		}
+
+		if !opts.quiet {
+			fmt.Printf("Clustering with --max-seconds-diff %v\n", opts.maxSecondsDiff)
+		}
+	}
+
+	if !opts.quiet {
+		fmt.Printf("Clustering %v media...\n", library.Size())
+	}
+
+	clusters := ClusterMedia(opts.maxSecondsDiff, opts.minPoints, geoDistanceKm, opts.noise, library)
+
+	// break up clusters too large to browse comfortably
+	if opts.maxClusterSize > 0 {
+		clusters.SplitClusters(opts.maxClusterSize)
+	}
+
+	facts.ClusterCount = clusters.ClusterSize()
+	facts.UnclusteredCount = clusters.NoiseSize()
+	facts.NoiseCount = clusters.noise
+
+	// benchmarking takes a moment, so only estimate when someone's there to read the prompt
+	if !opts.yes && !opts.jsonPlan && !opts.dryRun {
+		estimate, err := EstimateSeconds(library, facts, opts)
+		if err == nil {
+			facts.EstimatedSeconds = estimate
+		}
+	}
+
+	// name clusters by date & place, rather than by number
+	if opts.geocode {
+		err = clusters.LabelClusters(NewGeocoder(nil))
+		bail(err)
+	}
+
+	if len(opts.layout) > 0 {
+		clusters.LayoutClusters(opts.layout)
+	}
+
+	// warn about media already copied anywhere in the archive, not only into --to
+	err = CheckArchive(clusters.entries, facts)
+	bail(err)
+
+	// describe the plan for other tools, rather than copying
+	if opts.jsonPlan {
+		err = PrintPlan(clusters, facts)
+		bail(err)
+
+		return 0
+	}
+
+	if opts.dryRun {
+		err = DryRun(opts, clusters, library)
+		bail(err)
+
+		return 0
+	}
 
 	// prompt whether we want to proceed
 	proceed, err := PromptCopy(clusters, facts, opts)
 	bail(err)
 
-	tm.Clear()
+	if !opts.quiet {
+		tm.Clear()
+	}
 
 	if !proceed {
 		return 0
@@ -224,6 +655,23 @@ func Badger(opts *BadgerOpts) int {
 
 	// start processing the media library
 	err = ProcessLibrary(opts, clusters, facts, library)
+
+	// running out of space is expected on long runs, as are unreadable files on a failing card, so
+	// report them rather than crashing
+	if IsOutOfSpace(err) || errors.Is(err, ErrCopyFailures) {
+		if opts.json {
+			PrintJsonError(err)
+		} else {
+			fmt.Println(err)
+		}
+
+		return 1
+	}
+
+	if err != nil {
+		opts.log.RunFailed(err)
+	}
+
 	bail(err)
 
 	// start scoring and copying
@@ -234,12 +682,112 @@ func Badger(opts *BadgerOpts) int {
  * Validate badger inputs
  */
 func ValidateOpts(opts *BadgerOpts) error {
-	if len(opts.from) == 0 {
-		return errors.New("--from was length-zero")
+	if len(opts.from) == 0 && len(opts.fromDirs) == 0 && len(opts.fromLists) == 0 {
+		return errors.New("one of --from, --from-dir or --from-list is needed")
+	}
+	for _, glob := range opts.from {
+		if len(glob) == 0 {
+			return errors.New("--from contained a length-zero glob")
+		}
+	}
+	stdinLists := 0
+	for _, list := range opts.fromLists {
+		if list == "-" {
+			stdinLists += 1
+		}
+	}
+	if stdinLists > 1 {
+		return errors.New("--from-list can only read stdin once")
+	}
+	if stdinLists > 0 && !opts.yes {
+		return errors.New("--from-list - reads stdin, so can't be answered at the prompt; use --yes")
+	}
+	for _, exclude := range opts.excludes {
+		if _, err := filepath.Match(exclude, ""); err != nil {
+			return fmt.Errorf("--exclude '%v' isn't a valid glob: %v", exclude, err)
+		}
+	}
+	for _, dir := range opts.fromDirs {
+		if stat, err := os.Stat(dir); err != nil || !stat.IsDir() {
+			return fmt.Errorf("--from-dir %v isn't a folder; is your device connected?", dir)
+		}
 	}
 	if len(opts.to) == 0 {
 		return errors.New("--to was length-zero")
 	}
+	if opts.rejectBelow > 0 && opts.rejectBelow <= opts.minBlur {
+		return fmt.Errorf("--reject-below %v would reject nothing, as photos below --min-blur %v aren't copied", opts.rejectBelow, opts.minBlur)
+	}
+	if IsRemoteDestination(opts.to) {
+		if opts.link != NO_LINK {
+			return errors.New("--symlink and --link can't link to media from a remote --to")
+		}
+
+		if opts.preserve.xattrs {
+			return errors.New("--preserve xattrs can't copy extended attributes to a remote --to")
+		}
+
+		if opts.scanTo {
+			return errors.New("--scan-to can only scan a local --to")
+		}
+	} else if err := CheckDestinationOutsideSources(SourceGlobs(opts.from, opts.fromDirs), opts.to); err != nil {
+		return err
+	} else if err := CheckWritable(opts.to); err != nil && !opts.jsonPlan && !opts.dryRun {
+		return err
+	}
+	if opts.json && opts.tui {
+		return errors.New("--json and --tui can't be used together")
+	}
+	if opts.json && !opts.yes {
+		return errors.New("--json needs --yes, as there's no one to answer the prompt")
+	}
+	if opts.quiet && opts.tui {
+		return errors.New("--quiet and --tui can't be used together")
+	}
+	workers := map[string]int{
+		"--load-workers": opts.loadWorkers,
+		"--copy-workers": opts.copyWorkers,
+		"--blur-workers": opts.blurWorkers,
+	}
+	if opts.adaptiveWorkers {
+		workers["--min-copy-workers"] = opts.minCopyWorkers
+		workers["--max-copy-workers"] = opts.maxCopyWorkers
+	}
+	for flag, count := range workers {
+		if count < 1 || count > MaxWorkers {
+			return fmt.Errorf("%v must be between 1 and %v", flag, MaxWorkers)
+		}
+	}
+	if opts.adaptiveWorkers && opts.minCopyWorkers > opts.maxCopyWorkers {
+		return errors.New("--min-copy-workers can't be more than --max-copy-workers")
+	}
+	if opts.retries < 0 {
+		return errors.New("--retries can't be negative")
+	}
+	if opts.since > 0 && opts.until > 0 && opts.since > opts.until {
+		return errors.New("--since or --after must be before --until or --before")
+	}
+	if opts.maxClusterSize < 0 {
+		return errors.New("--max-cluster-size can't be negative")
+	}
+	if opts.sample < 0 {
+		return errors.New("--sample can't be negative")
+	}
+
+	// 'badger copy' doesn't cluster
+	if opts.copyOnly {
+		return nil
+	}
+
+	if opts.minPoints < 1 {
+		return errors.New("--min-points must be at least one")
+	}
+	if opts.maxSecondsDiff <= 0 {
+		return errors.New("--max-seconds-diff must be a positive number of seconds, or duration")
+	}
+	if opts.geoCluster && opts.geoDistanceKm <= 0 {
+		return errors.New("--geo-distance must be positive")
+	}
 
 	return nil
 }
@@ -256,28 +804,548 @@ func main() {
 		}
 	}
 
-	opts, err := docopt.ParseDoc(Usage)
-	bail(err)
+	argv := os.Args[1:]
 
-	from, err := opts.String("--from")
+	opts, err := docopt.ParseArgs(Usage, argv, "")
 	bail(err)
 
-	to, err := opts.String("--to")
+	// default unset flags from the config file
+	configPath, _ := opts["--config"].(string)
+	profile, _ := opts["--profile"].(string)
+	err = ApplyConfig(opts, configPath, profile, argv)
 	bail(err)
 
+	// resume by running the latest run's command again
+	resuming := false
+
+	if resume, _ := opts.Bool("resume"); resume {
+		to, err := opts.String("--to")
+		bail(err)
+
+		yes, _ := opts.Bool("--yes")
+
+		argv, err = ResumeArgs(to, yes)
+		bail(err)
+
+		opts, err = docopt.ParseArgs(Usage, argv, "")
+		bail(err)
+
+		configPath, _ = opts["--config"].(string)
+		profile, _ = opts["--profile"].(string)
+		err = ApplyConfig(opts, configPath, profile, argv)
+		bail(err)
+
+		resuming = true
+	}
+
+	if index, _ := opts.Bool("index"); index {
+		to, err := opts.String("--to")
+		bail(err)
+
+		dbDir, err := DatabaseDir(to)
+		bail(err)
+
+		hashName, err := opts.String("--hash")
+		bail(err)
+
+		metricName, err := opts.String("--sharpness-metric")
+		bail(err)
+
+		logLevelName, err := opts.String("--log-level")
+		bail(err)
+
+		// index doesn't cluster or copy, so is validated like copy, with its copy-workers unused
+		bopts := NewCopyOpts(SplitGlobs(opts["--from"].([]string)), to, dbDir)
+		bopts.fromDirs = opts["--from-dir"].([]string)
+		bopts.excludes = opts["--exclude"].([]string)
+		bopts.fromLists = opts["--from-list"].([]string)
+		bopts.null, _ = opts.Bool("--null")
+		bopts.args = argv
+		bopts.yes = true
+		bopts.quiet, _ = opts.Bool("--quiet")
+		bopts.logPath, _ = opts["--log"].(string)
+		bopts.copyWorkers = 1
+
+		bopts.hashAlgorithm, err = ParseHashAlgorithm(hashName)
+		bail(err)
+
+		bopts.sharpnessMetric, err = ParseSharpnessMetric(metricName)
+		bail(err)
+
+		bopts.logLevel, err = ParseLogLevel(logLevelName)
+		bail(err)
+
+		err = MapExtensions(opts["--map-ext"].([]string))
+		bail(err)
+
+		bopts.gradeMaxEdge = GradeMaxEdge
+		if fullResolution, _ := opts.Bool("--full-resolution"); fullResolution {
+			bopts.gradeMaxEdge = 0
+		}
+
+		bopts.loadWorkers = runtime.NumCPU()
+		if _, ok := opts["--load-workers"].(string); ok {
+			bopts.loadWorkers, err = opts.Int("--load-workers")
+			bail(err)
+		}
+
+		bopts.blurWorkers = runtime.NumCPU()
+		if _, ok := opts["--blur-workers"].(string); ok {
+			bopts.blurWorkers, err = opts.Int("--blur-workers")
+			bail(err)
+		}
+
+		err = ValidateOpts(&bopts)
+		bail(err)
+
+		os.Exit(Index(&bopts))
+	}
+
+	if importing, _ := opts.Bool("import"); importing {
+		to, err := opts.String("--to")
+		bail(err)
+
+		port, _ := opts["--port"].(string)
+		staging, _ := opts["--staging"].(string)
+		yes, _ := opts.Bool("--yes")
+
+		os.Exit(ImportCamera(to, port, staging, configPath, profile, yes))
+	}
+
+	if watch, _ := opts.Bool("watch"); watch {
+		to, err := opts.String("--to")
+		bail(err)
+
+		debounce, err := opts.Float64("--debounce")
+		bail(err)
+
+		if debounce <= 0 {
+			bail(fmt.Errorf("badger: --debounce must be greater than zero, but was %v", debounce))
+		}
+
+		os.Exit(Watch(opts["--from-dir"].([]string)[0], to, time.Duration(debounce*float64(time.Second)), configPath, profile))
+	}
+
+	if verify, _ := opts.Bool("verify"); verify {
+		dbDir, err := opts.String("--db")
+		bail(err)
+
+		filter := RunFilter{}
+		if runId, ok := opts["--run"].(string); ok {
+			filter.runId = runId
+		}
+
+		os.Exit(Verify(dbDir, filter, runtime.NumCPU()))
+	}
+
+	if dupes, _ := opts.Bool("dupes"); dupes {
+		dbDir, err := opts.String("--db")
+		bail(err)
+
+		distance, err := opts.Int("--distance")
+		bail(err)
+
+		os.Exit(Dupes(dbDir, distance))
+	}
+
+	if stats, _ := opts.Bool("stats"); stats {
+		dbDir, err := opts.String("--db")
+		bail(err)
+
+		asJson, _ := opts.Bool("--json")
+
+		os.Exit(Stats(dbDir, asJson))
+	}
+
+	if export, _ := opts.Bool("export"); export {
+		dbDir, err := opts.String("--db")
+		bail(err)
+
+		name, err := opts.String("--format")
+		bail(err)
+
+		format, err := ParseExportFormat(name)
+		bail(err)
+
+		os.Exit(Export(dbDir, format))
+	}
+
+	if merge, _ := opts.Bool("merge"); merge {
+		out, err := opts.String("--out")
+		bail(err)
+
+		os.Exit(Merge(opts["<dir>"].([]string), out))
+	}
+
+	if query, _ := opts.Bool("query"); query {
+		dbDir, err := opts.String("--db")
+		bail(err)
+
+		canned := []string{"--blurriest", "--largest-clusters", "--errors"}
+		bail(ExclusiveFlags(opts, append(canned, "<sql>")...))
+
+		text, _ := opts["<sql>"].(string)
+		selected := ""
+		for _, flag := range canned {
+			if set, _ := opts.Bool(flag); set {
+				selected = flag
+			}
+		}
+
+		limit, err := opts.Int("--limit")
+		bail(err)
+
+		asJson, _ := opts.Bool("--json")
+
+		os.Exit(Query(dbDir, text, selected, limit, asJson))
+	}
+
+	if runs, _ := opts.Bool("runs"); runs {
+		dbDir, err := opts.String("--db")
+		bail(err)
+
+		os.Exit(Runs(dbDir))
+	}
+
+	if undo, _ := opts.Bool("undo"); undo {
+		dbDir, err := opts.String("--db")
+		bail(err)
+
+		filter := RunFilter{}
+		if runId, ok := opts["--run"].(string); ok {
+			filter.runId = runId
+		}
+
+		if text, ok := opts["--since"].(string); ok {
+			filter.since, err = ParseSince(text)
+			bail(err)
+		}
+
+		unchangedOnly, _ := opts.Bool("--unchanged-only")
+		yes, _ := opts.Bool("--yes")
+
+		os.Exit(Undo(dbDir, filter, unchangedOnly, yes))
+	}
+
 	if cluster, _ := opts.Bool("cluster"); cluster {
+		from := SplitGlobs(opts["--from"].([]string))
+		fromDirs := opts["--from-dir"].([]string)
+		excludes := opts["--exclude"].([]string)
+		fromLists := opts["--from-list"].([]string)
+		null, _ := opts.Bool("--null")
+
+		to, err := opts.String("--to")
+		bail(err)
+
+		dbDir, err := DatabaseDir(to)
+		bail(err)
+
 		yes, _ := opts.Bool("--yes")
+		quiet, _ := opts.Bool("--quiet")
+		tui, _ := opts.Bool("--tui")
+		jsonPlan, _ := opts.Bool("--json-plan")
+		dryRun, _ := opts.Bool("--dry-run")
+		jsonLines, _ := opts.Bool("--json")
+
+		// keep stdout to the plan, or JSON lines, alone
+		if jsonPlan || jsonLines {
+			quiet = true
+		}
+
+		maxSecondsText, err := opts.String("--max-seconds-diff")
+		bail(err)
+
+		maxSecondsDiff, err := ParseSeconds(maxSecondsText)
+		bail(err)
+
+		autoEps, _ := opts.Bool("--auto-eps")
+
+		minPoints, err := opts.Int("--min-points")
+		bail(err)
+
+		noiseName, err := opts.String("--noise")
+		bail(err)
+
+		noise, err := ParseNoisePolicy(noiseName)
+		bail(err)
+
+		if dropNoise, _ := opts.Bool("--drop-noise"); dropNoise {
+			noise = SKIP_NOISE
+		}
+
+		minBlur, err := opts.Float64("--min-blur")
+		bail(err)
+
+		rejectBelow, err := opts.Float64("--reject-below")
+		bail(err)
+
+		normalizeBlur, _ := opts.Bool("--normalize-blur")
+
+		pairingName, err := opts.String("--pairing")
+		bail(err)
+
+		pairing, err := ParsePairingPolicy(pairingName)
+		bail(err)
+
+		onExistsName, err := opts.String("--on-exists")
+		bail(err)
+
+		onExists, err := ParseExistsPolicy(onExistsName)
+		bail(err)
+
+		// an interrupted run may have left half-written copies behind; replace them
+		if resuming {
+			onExists = OVERWRITE
+		}
+
+		incremental, _ := opts.Bool("--incremental")
+		skipSameContent, _ := opts.Bool("--skip-same-content")
+		scanTo, _ := opts.Bool("--scan-to")
+		dedupBursts, _ := opts.Bool("--dedup-bursts")
+
+		burstWindow, err := opts.Float64("--burst-window")
+		bail(err)
+
+		groupDuplicates, _ := opts.Bool("--group-duplicates")
+
+		duplicateDistance, err := opts.Int("--distance")
+		bail(err)
+
+		countFaces, _ := opts.Bool("--count-faces")
+
+		minFaces, err := opts.Int("--min-faces")
+		bail(err)
+
+		maxClipped, err := opts.Float64("--max-clipped")
+		bail(err)
+
+		// alternatives are checked here, rather than in the usage, as docopt slows sharply with each alternative
+		for _, flags := range ExclusiveGroups {
+			bail(ExclusiveFlags(opts, flags...))
+		}
+
+		preserve := PreserveAttrs{times: true}
+		if noPreserveTimes, _ := opts.Bool("--no-preserve-times"); noPreserveTimes {
+			preserve.times = false
+		}
+
+		if text, ok := opts["--preserve"].(string); ok {
+			preserve, err = ParsePreserve(text)
+			bail(err)
+		}
+		link := NO_LINK
+		if symlink, _ := opts.Bool("--symlink"); symlink {
+			link = SYMLINK
+		}
+
+		if name, ok := opts["--link"].(string); ok {
+			link, err = ParseLinkMode(name)
+			bail(err)
+		}
+		move, _ := opts.Bool("--move")
+		verify, _ := opts.Bool("--verify")
+		flatten, _ := opts.Bool("--flatten")
+
+		layout := ""
+		if text, ok := opts["--layout"].(string); ok {
+			layout, err = ParseLayout(text)
+			bail(err)
+		}
+		thumbnails, _ := opts.Bool("--thumbnails")
+		ignoreOrientation, _ := opts.Bool("--ignore-orientation")
+		geocode, _ := opts.Bool("--geocode")
+
+		geoCluster, _ := opts.Bool("--geo-cluster")
+
+		clusterBy, err := opts.String("--cluster-by")
+		bail(err)
+
+		clusterByGps, err := ParseClusterDimensions(clusterBy)
+		bail(err)
+
+		geoCluster = geoCluster || clusterByGps
+
+		geoDistanceKm, err := opts.Float64("--geo-distance")
+		bail(err)
+
+		hashName, err := opts.String("--hash")
+		bail(err)
+
+		hashAlgorithm, err := ParseHashAlgorithm(hashName)
+		bail(err)
 
-		maxSecondsDiff, err := opts.Float64("--max-seconds-diff")
+		metricName, err := opts.String("--sharpness-metric")
 		bail(err)
 
+		sharpnessMetric, err := ParseSharpnessMetric(metricName)
+		bail(err)
+
+		gradeMaxEdge := GradeMaxEdge
+		if fullResolution, _ := opts.Bool("--full-resolution"); fullResolution {
+			gradeMaxEdge = 0
+		}
+
+		err = MapExtensions(opts["--map-ext"].([]string))
+		bail(err)
+
+		loadWorkers := runtime.NumCPU()
+		if _, ok := opts["--load-workers"].(string); ok {
+			loadWorkers, err = opts.Int("--load-workers")
+			bail(err)
+		}
+
+		copyWorkers, err := opts.Int("--copy-workers")
+		bail(err)
+
+		adaptiveWorkers, _ := opts.Bool("--adaptive-workers")
+
+		minCopyWorkers, err := opts.Int("--min-copy-workers")
+		bail(err)
+
+		maxCopyWorkers, err := opts.Int("--max-copy-workers")
+		bail(err)
+
+		// leave a CPU free for copying & the database, unless there's only one
+		blurWorkers := runtime.NumCPU() - 1
+		if blurWorkers < 1 {
+			blurWorkers = 1
+		}
+		if _, ok := opts["--blur-workers"].(string); ok {
+			blurWorkers, err = opts.Int("--blur-workers")
+			bail(err)
+		}
+
+		retries, err := opts.Int("--retries")
+		bail(err)
+
+		maxClusterSize := 0
+		if _, ok := opts["--max-cluster-size"].(string); ok {
+			maxClusterSize, err = opts.Int("--max-cluster-size")
+			bail(err)
+		}
+
+		sample := 0
+		if _, ok := opts["--sample"].(string); ok {
+			sample, err = opts.Int("--sample")
+			bail(err)
+		}
+
+		seed, err := opts.Int("--seed")
+		bail(err)
+
+		since := 0
+		if text, ok := opts["--since"].(string); ok {
+			sinceTime, _, err := ParseDate(text)
+			bail(err)
+
+			since = int(sinceTime.Unix())
+		}
+
+		until := 0
+		if text, ok := opts["--until"].(string); ok {
+			until, err = ParseUntil(text)
+			bail(err)
+		}
+
+		afterSince, beforeUntil, err := ParseCaptureRange(opts, time.Now())
+		bail(err)
+
+		var filter *FilterExpression
+		if text, ok := opts["--filter"].(string); ok {
+			filter, err = ParseFilterExpression(text)
+			bail(err)
+		}
+
+		if afterSince > 0 {
+			since = afterSince
+		}
+
+		if beforeUntil > 0 {
+			until = beforeUntil
+		}
+
+		logPath, _ := opts["--log"].(string)
+		progressJson, _ := opts["--progress-json"].(string)
+
+		logLevelName, err := opts.String("--log-level")
+		bail(err)
+
+		logLevel, err := ParseLogLevel(logLevelName)
+		bail(err)
+
+		var nameTemplate *template.Template
+		if text, ok := opts["--name-template"].(string); ok {
+			nameTemplate, err = ParseNameTemplate(text)
+			bail(err)
+		}
+
 		bopts := BadgerOpts{
-			from:           from,
-			to:             to,
-			maxSecondsDiff: maxSecondsDiff,
-			yes:            yes,
-			copyWorkers:    10,
-			blurWorkers:    runtime.NumCPU() - 1,
+			from:              from,
+			fromDirs:          fromDirs,
+			excludes:          excludes,
+			fromLists:         fromLists,
+			null:              null,
+			to:                to,
+			dbDir:             dbDir,
+			maxSecondsDiff:    maxSecondsDiff,
+			autoEps:           autoEps,
+			minPoints:         minPoints,
+			noise:             noise,
+			maxClusterSize:    maxClusterSize,
+			sample:            sample,
+			seed:              int64(seed),
+			since:             since,
+			until:             until,
+			minBlur:           minBlur,
+			rejectBelow:       rejectBelow,
+			normalizeBlur:     normalizeBlur,
+			pairing:           pairing,
+			onExists:          onExists,
+			resume:            resuming,
+			args:              argv,
+			incremental:       incremental,
+			skipSameContent:   skipSameContent,
+			scanTo:            scanTo,
+			dedupBursts:       dedupBursts,
+			burstWindow:       burstWindow,
+			groupDuplicates:   groupDuplicates,
+			duplicateDistance: duplicateDistance,
+			countFaces:        countFaces || minFaces > 0,
+			minFaces:          minFaces,
+			maxClipped:        maxClipped,
+			filter:            filter,
+			preserve:          preserve,
+			link:              link,
+			move:              move,
+			verify:            verify,
+			nameTemplate:      nameTemplate,
+			hashAlgorithm:     hashAlgorithm,
+			sharpnessMetric:   sharpnessMetric,
+			gradeMaxEdge:      gradeMaxEdge,
+			flatten:           flatten,
+			layout:            layout,
+			thumbnails:        thumbnails,
+			ignoreOrientation: ignoreOrientation,
+			geocode:           geocode,
+			geoCluster:        geoCluster,
+			geoDistanceKm:     geoDistanceKm,
+			yes:               yes,
+			jsonPlan:          jsonPlan,
+			json:              jsonLines,
+			dryRun:            dryRun,
+			quiet:             quiet,
+			tui:               tui,
+			loadWorkers:       loadWorkers,
+			retries:           retries,
+			logPath:           logPath,
+			progressJson:      progressJson,
+			logLevel:          logLevel,
+			runId:             NewRunId(time.Now()),
+			copyWorkers:       copyWorkers,
+			adaptiveWorkers:   adaptiveWorkers,
+			minCopyWorkers:    minCopyWorkers,
+			maxCopyWorkers:    maxCopyWorkers,
+			blurWorkers:       blurWorkers,
 		}
 
 		err = ValidateOpts(&bopts)
@@ -287,6 +1355,109 @@ func main() {
 	}
 
 	if copy, _ := opts.Bool("copy"); copy {
-		os.Exit(1)
+		from := SplitGlobs(opts["--from"].([]string))
+
+		to, err := opts.String("--to")
+		bail(err)
+
+		dbDir, err := DatabaseDir(to)
+		bail(err)
+
+		bopts := NewCopyOpts(from, to, dbDir)
+		bopts.fromDirs = opts["--from-dir"].([]string)
+		bopts.excludes = opts["--exclude"].([]string)
+		bopts.fromLists = opts["--from-list"].([]string)
+		bopts.null, _ = opts.Bool("--null")
+		bopts.args = argv
+
+		if resuming {
+			bopts.resume = true
+			bopts.onExists = OVERWRITE
+		}
+
+		bopts.yes, _ = opts.Bool("--yes")
+		bopts.quiet, _ = opts.Bool("--quiet")
+		bopts.json, _ = opts.Bool("--json")
+
+		if bopts.json {
+			bopts.quiet = true
+		}
+		bopts.logPath, _ = opts["--log"].(string)
+		bopts.progressJson, _ = opts["--progress-json"].(string)
+
+		logLevelName, err := opts.String("--log-level")
+		bail(err)
+
+		bopts.logLevel, err = ParseLogLevel(logLevelName)
+		bail(err)
+		bopts.loadWorkers = runtime.NumCPU()
+		bopts.blurWorkers = 1
+
+		hashName, err := opts.String("--hash")
+		bail(err)
+
+		bopts.hashAlgorithm, err = ParseHashAlgorithm(hashName)
+		bail(err)
+
+		err = MapExtensions(opts["--map-ext"].([]string))
+		bail(err)
+
+		bopts.copyWorkers, err = opts.Int("--copy-workers")
+		bail(err)
+
+		bopts.retries, err = opts.Int("--retries")
+		bail(err)
+
+		mediaName, err := opts.String("--media")
+		bail(err)
+
+		filter := MediaFilter{}
+
+		filter.kind, err = ParseMediaKind(mediaName)
+		bail(err)
+
+		if _, ok := opts["--max-iso"].(string); ok {
+			filter.maxIso, err = opts.Float64("--max-iso")
+			bail(err)
+		}
+
+		if text, ok := opts["--min-shutter-speed"].(string); ok {
+			filter.maxExposureTime, err = ParseShutterSpeed(text)
+			bail(err)
+		}
+
+		filter.minBlur, err = opts.Float64("--min-blur")
+		bail(err)
+
+		bopts.since, bopts.until, err = ParseCaptureRange(opts, time.Now())
+		bail(err)
+
+		if text, ok := opts["--filter"].(string); ok {
+			bopts.filter, err = ParseFilterExpression(text)
+			bail(err)
+		}
+
+		if text, ok := opts["--preserve"].(string); ok {
+			bopts.preserve, err = ParsePreserve(text)
+			bail(err)
+		}
+
+		bopts.verify, _ = opts.Bool("--verify")
+		bopts.skipSameContent, _ = opts.Bool("--skip-same-content")
+		bopts.scanTo, _ = opts.Bool("--scan-to")
+
+		if _, ok := opts["--max-blur"].(string); ok {
+			filter.maxBlur, err = opts.Float64("--max-blur")
+			bail(err)
+		}
+
+		// graded like cluster's defaults, so scores stored by earlier runs can be reused
+		bopts.sharpnessMetric = LAPLACIAN
+		bopts.gradeMaxEdge = GradeMaxEdge
+
+		err = ValidateOpts(&bopts)
+		bail(err)
+
+		os.Exit(Copy(&bopts, filter))
 	}
 }
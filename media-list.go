@@ -2,7 +2,13 @@ package main
 
 import (
 	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 )
 
 /*
@@ -10,6 +16,10 @@ import (
  */
 type MediaList struct {
 	library []*Media
+	pairing PairingPolicy
+
+	// how many listed files --exclude left out
+	excluded int
 }
 
 /*
@@ -43,44 +53,499 @@ func (library *MediaList) GetByPrefix(media *Media) []*Media {
 	return matches
 }
 
+/*
+ * Load and memoise the size, times, hash and exif information of all media with a pool of workers.
+ * Each media is loaded by exactly one worker, and loading completes before this returns, so
+ * memoised fields are never written concurrently.
+ */
+func (library *MediaList) LoadInformation(procCount int, quiet bool) error {
+	counter := NewProgressCounter("Reading capture times", library.Size(), quiet)
+	defer counter.Done()
+
+	jobs := make(chan *Media, library.Size())
+	errs := make(chan error, library.Size())
+	var wg sync.WaitGroup
+
+	for pid := 0; pid < procCount; pid++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for media := range jobs {
+				if err := media.LoadInformation(); err != nil {
+					errs <- fmt.Errorf("badger: failed to load information for %v: %v", media.source, err)
+				}
+
+				counter.Increment()
+			}
+		}()
+	}
+
+	for _, media := range library.Values() {
+		jobs <- media
+	}
+
+	close(jobs)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		return err
+	}
+
+	return nil
+}
+
+/*
+ * Does this media have a photo with the same prefix? e.g a jpeg for a raw image
+ */
+func (library *MediaList) HasPhotoSibling(media *Media) bool {
+	for _, sibling := range library.GetByPrefix(media) {
+		if sibling.GetType() == PHOTO {
+			return true
+		}
+	}
+
+	return false
+}
+
 /*
  *
  */
 func NewMediaList(library []*Media) *MediaList {
-	return &MediaList{library}
+	return &MediaList{library: library, pairing: FOLLOW_JPEG}
+}
+
+/*
+ * Split comma-separated --from values into individual globs
+ */
+func SplitGlobs(values []string) []string {
+	globs := []string{}
+
+	for _, value := range values {
+		for _, glob := range strings.Split(value, ",") {
+			if len(glob) > 0 {
+				globs = append(globs, glob)
+			}
+		}
+	}
+
+	return globs
+}
+
+// The files listed by the --from globs, --from-dir folders and --from-list files, and the input that listed each
+type SourceListing struct {
+	files  []string
+	inputs map[string]string
+}
+
+/*
+ * Add files listed by an input. Files listed by several inputs, even by different relative paths,
+ * are only listed once, and attributed to the first input that listed them
+ */
+func (listing *SourceListing) Add(input string, files []string, seen map[string]bool) error {
+	for _, fpath := range files {
+		abs, err := filepath.Abs(fpath)
+		if err != nil {
+			return err
+		}
+
+		if seen[abs] {
+			continue
+		}
+
+		seen[abs] = true
+		listing.files = append(listing.files, fpath)
+		listing.inputs[fpath] = input
+	}
+
+	return nil
+}
+
+/*
+ * Walk a --from-dir recursively, listing media with a known extension and their sidecars. Hidden
+ * folders, like a previous run's thumbnails or a card's trash, aren't searched
+ */
+func WalkSourceDir(dir string) ([]string, error) {
+	files := []string{}
+
+	err := filepath.WalkDir(dir, func(fpath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			if fpath != dir && strings.HasPrefix(entry.Name(), ".") {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		_, known := ExtensionTypes[strings.ToLower(filepath.Ext(fpath))]
+		if entry.Type().IsRegular() && (known || IsSidecar(fpath)) {
+			files = append(files, fpath)
+		}
+
+		return nil
+	})
+
+	return files, err
+}
+
+/*
+ * Read a --from-list of paths, one per line or, with --null, NUL-delimited as printed by find -print0.
+ * Blank entries are ignored, as are entries that aren't files, like folders
+ */
+func ReadSourceList(reader io.Reader, null bool) ([]string, error) {
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	separator := "\n"
+	if null {
+		separator = "\x00"
+	}
+
+	files := []string{}
+	for _, entry := range strings.Split(string(content), separator) {
+		if !null {
+			entry = strings.TrimSuffix(entry, "\r")
+		}
+
+		if len(entry) == 0 {
+			continue
+		}
+
+		stat, err := os.Stat(entry)
+		if err != nil {
+			return nil, fmt.Errorf("badger: --from-list named %v, which can't be read: %w", entry, err)
+		}
+
+		if stat.Mode().IsRegular() {
+			files = append(files, entry)
+		}
+	}
+
+	return files, nil
+}
+
+/*
+ * Read a --from-list from a file, or from stdin if it's -
+ */
+func ReadSourceListFile(list string, null bool) ([]string, error) {
+	if list == "-" {
+		return ReadSourceList(os.Stdin, null)
+	}
+
+	file, err := os.Open(list)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ReadSourceList(file, null)
+}
+
+/*
+ * Expand each --from glob, walk each --from-dir, and read each --from-list, and union the files they list
+ */
+func ExpandSources(globs []string, dirs []string, lists []string, null bool) (*SourceListing, error) {
+	listing := &SourceListing{files: []string{}, inputs: make(map[string]string)}
+	seen := make(map[string]bool)
+
+	for _, glob := range globs {
+		matches, err := filepath.Glob(glob)
+		if err != nil {
+			return listing, err
+		}
+
+		if err := listing.Add(glob, matches, seen); err != nil {
+			return listing, err
+		}
+	}
+
+	for _, dir := range dirs {
+		walked, err := WalkSourceDir(dir)
+		if err != nil {
+			return listing, err
+		}
+
+		if err := listing.Add(dir, walked, seen); err != nil {
+			return listing, err
+		}
+	}
+
+	for _, list := range lists {
+		listed, err := ReadSourceListFile(list, null)
+		if err != nil {
+			return listing, err
+		}
+
+		input := list
+		if list == "-" {
+			input = "stdin"
+		}
+
+		if err := listing.Add(input, listed, seen); err != nil {
+			return listing, err
+		}
+	}
+
+	return listing, nil
+}
+
+/*
+ * Is a file excluded by any --exclude glob? Globs are matched against the file's name and its path,
+ * ignoring case, since cards name files inconsistently
+ */
+func IsExcluded(fpath string, excludes []string) bool {
+	name := strings.ToLower(filepath.Base(fpath))
+	full := strings.ToLower(fpath)
+
+	for _, exclude := range excludes {
+		pattern := strings.ToLower(exclude)
+
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return true
+		}
+
+		if matched, _ := filepath.Match(pattern, full); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+ * Get each source glob, treating a --from-dir as a glob of its contents; e.g to check the destination
+ * is outside every source
+ */
+func SourceGlobs(globs []string, dirs []string) []string {
+	sources := append([]string{}, globs...)
+
+	for _, dir := range dirs {
+		sources = append(sources, filepath.Join(dir, "*"))
+	}
+
+	return sources
+}
+
+/*
+ * Get the directory a glob searches beneath; the path up to its first wildcard
+ */
+func GlobRoot(glob string) string {
+	parts := strings.Split(filepath.Clean(glob), string(filepath.Separator))
+	root := []string{}
+
+	for _, part := range parts {
+		if strings.ContainsAny(part, `*?[\`) {
+			break
+		}
+
+		root = append(root, part)
+	}
+
+	// a glob without wildcards names a file, so search its directory
+	if len(root) == len(parts) {
+		return filepath.Dir(filepath.Clean(glob))
+	}
+
+	if len(root) == 1 && root[0] == "" {
+		return string(filepath.Separator)
+	}
+
+	if len(root) == 0 {
+		return "."
+	}
+
+	return strings.Join(root, string(filepath.Separator))
+}
+
+/*
+ * Get the absolute path of a file, with symlinks resolved. Paths that don't exist yet are
+ * resolved from their nearest existing parent
+ */
+func ResolvePath(fpath string) (string, error) {
+	abs, err := filepath.Abs(fpath)
+	if err != nil {
+		return "", err
+	}
+
+	missing := []string{}
+	current := abs
+
+	for {
+		resolved, err := filepath.EvalSymlinks(current)
+		if err == nil {
+			for idx := len(missing) - 1; idx >= 0; idx-- {
+				resolved = filepath.Join(resolved, missing[idx])
+			}
+
+			return resolved, nil
+		}
+
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+
+		parent := filepath.Dir(current)
+		if parent == current {
+			return abs, nil
+		}
+
+		missing = append(missing, filepath.Base(current))
+		current = parent
+	}
+}
+
+/*
+ * Is a path the same as, or beneath, a directory?
+ */
+func IsWithin(dir string, fpath string) bool {
+	rel, err := filepath.Rel(dir, fpath)
+	if err != nil {
+		return false
+	}
+
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+/*
+ * Check the destination isn't beneath a source glob; otherwise re-runs would re-import copied media
+ */
+func CheckDestinationOutsideSources(globs []string, to string) error {
+	dest, err := ResolvePath(to)
+	if err != nil {
+		return err
+	}
+
+	for _, glob := range globs {
+		root, err := ResolvePath(GlobRoot(glob))
+		if err != nil {
+			return err
+		}
+
+		if IsWithin(root, dest) {
+			return fmt.Errorf("badger: --to %v is inside --from %v, so copied media would be read again as sources; choose a destination outside %v", to, glob, root)
+		}
+	}
+
+	return nil
+}
+
+/*
+ * Check no source file is beneath the destination. Unlike globs, --from-list files are only known
+ * once the list is read, which can only be done once for stdin
+ */
+func CheckFilesOutsideDestination(files []string, to string) error {
+	dest, err := ResolvePath(to)
+	if err != nil {
+		return err
+	}
+
+	for _, fpath := range files {
+		resolved, err := ResolvePath(fpath)
+		if err != nil {
+			return err
+		}
+
+		if IsWithin(dest, resolved) {
+			return fmt.Errorf("badger: the source %v is inside --to %v, so copied media would be read again as sources; leave it out of the sources", fpath, to)
+		}
+	}
+
+	return nil
 }
 
 /*
  *
  */
 func (opts *BadgerOpts) ListMedia() (*MediaList, error) {
-	files, err := filepath.Glob(opts.from)
+	listing, err := ExpandSources(opts.from, opts.fromDirs, opts.fromLists, opts.null)
 
 	// double-check listed files
 	if err != nil {
 		return NewMediaList([]*Media{}), err
 	}
 
-	if len(files) == 0 {
-		return NewMediaList([]*Media{}), errors.New("badger: the '--from' glob you provided didn't match any files; is your device connected, and the glob valid and not just a directory path?")
+	if len(opts.to) > 0 && !IsRemoteDestination(opts.to) {
+		if err := CheckFilesOutsideDestination(listing.files, opts.to); err != nil {
+			return NewMediaList([]*Media{}), err
+		}
 	}
 
-	if len(files) == 1 {
-		return NewMediaList([]*Media{}), errors.New("badger: the '--from' glob only matched one file; is your device connected, and the glob valid and not just a directory path?")
+	// sidecars are attached to their images, rather than clustered themselves
+	files := []string{}
+	excluded := 0
+
+	for _, fpath := range listing.files {
+		if IsSidecar(fpath) {
+			continue
+		}
+
+		if IsExcluded(fpath, opts.excludes) {
+			excluded += 1
+			continue
+		}
+
+		files = append(files, fpath)
+	}
+
+	// try out settings on a subset of shots
+	if opts.sample > 0 {
+		files = SampleByPrefix(files, opts.sample, opts.seed)
+	}
+
+	if len(files) == 0 && excluded > 0 {
+		return NewMediaList([]*Media{}), fmt.Errorf("badger: --exclude left out all %v of the listed files; are the --exclude globs right?", excluded)
+	}
+
+	if len(files) == 0 {
+		return NewMediaList([]*Media{}), errors.New("badger: the '--from', '--from-dir' and '--from-list' sources you provided didn't match any files; is your device connected, and the glob valid and not just a directory path?")
 	}
 
 	// construct media objects for each file
 	library := make([]*Media, len(files))
+	names := NewNameRegistry()
 
 	for idx, fpath := range files {
+		// sources are recorded absolute, so they're found again from another working directory
+		source, err := filepath.Abs(fpath)
+		if err != nil {
+			return NewMediaList([]*Media{}), err
+		}
+
 		media := Media{
-			source: fpath,
-			dstDir: opts.to,
-			id:     idx,
+			source:      source,
+			sourceInput: listing.inputs[fpath],
+			dstDir:      opts.dstDir,
+			id:          idx,
+
+			hashAlgorithm:   opts.hashAlgorithm,
+			sharpnessMetric: opts.sharpnessMetric,
+			gradeMaxEdge:    opts.gradeMaxEdge,
+			countFaces:      opts.countFaces,
+			runId:           opts.runId,
+
+			flatten:      opts.flatten,
+			nameTemplate: opts.nameTemplate,
+			names:        names,
+
+			ignoreOrientation: opts.ignoreOrientation,
+			destination:       opts.destination,
 		}
 
 		library[idx] = &media
 	}
 
-	return NewMediaList(library), nil
+	mediaList := NewMediaList(library)
+	mediaList.pairing = opts.pairing
+	mediaList.excluded = excluded
+	mediaList.AttachSidecars()
+
+	return mediaList, nil
 }
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckDestinationOutsideSources(t *testing.T) {
+	root := t.TempDir()
+
+	for _, dir := range []string{"photos/sorted", "a/b", "a/bc", "elsewhere"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.Symlink(filepath.Join(root, "photos"), filepath.Join(root, "linked")); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		globs   []string
+		to      string
+		invalid bool
+	}{
+		{"nested", []string{"photos/**"}, "photos/sorted", true},
+		{"nested and not yet created", []string{"photos/*.jpg"}, "photos/new/sorted", true},
+		{"equal", []string{"photos/*"}, "photos", true},
+		{"glob without wildcards", []string{"photos/IMG_0001.jpg"}, "photos", true},
+		{"sibling sharing a prefix", []string{"a/b/*"}, "a/bc", false},
+		{"parent of the source", []string{"a/b/*"}, "a", false},
+		{"outside", []string{"photos/*"}, "elsewhere", false},
+		{"symlinked source", []string{"linked/*"}, "photos/sorted", true},
+		{"symlinked destination", []string{"photos/*"}, "linked/sorted", true},
+		{"several sources, one nested", []string{"elsewhere/*", "photos/*"}, "photos/sorted", true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			globs := make([]string, len(tc.globs))
+			for idx, glob := range tc.globs {
+				globs[idx] = filepath.Join(root, glob)
+			}
+
+			err := CheckDestinationOutsideSources(globs, filepath.Join(root, tc.to))
+
+			if tc.invalid && err == nil {
+				t.Errorf("expected --to %v to be rejected as inside %v", tc.to, tc.globs)
+			}
+
+			if !tc.invalid && err != nil {
+				t.Errorf("expected --to %v to be allowed with %v, got %v", tc.to, tc.globs, err)
+			}
+		})
+	}
+}
+
+func TestCheckFilesOutsideDestination(t *testing.T) {
+	root := t.TempDir()
+
+	WriteTestFile(t, filepath.Join(root, "photos/IMG_0001.jpg"), "photo")
+	WriteTestFile(t, filepath.Join(root, "photos/sorted/0/IMG_0001.jpg"), "copied photo")
+	WriteTestFile(t, filepath.Join(root, "photos/sortedness/IMG_0002.jpg"), "photo")
+
+	if err := os.Symlink(filepath.Join(root, "photos/sorted"), filepath.Join(root, "linked")); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name    string
+		file    string
+		invalid bool
+	}{
+		{"outside", "photos/IMG_0001.jpg", false},
+		{"sibling sharing a prefix", "photos/sortedness/IMG_0002.jpg", false},
+		{"inside", "photos/sorted/0/IMG_0001.jpg", true},
+		{"inside through a symlink", "linked/0/IMG_0001.jpg", true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := CheckFilesOutsideDestination([]string{filepath.Join(root, tc.file)}, filepath.Join(root, "photos/sorted"))
+
+			if tc.invalid && err == nil {
+				t.Errorf("expected %v to be rejected as inside --to", tc.file)
+			}
+
+			if !tc.invalid && err != nil {
+				t.Errorf("expected %v to be allowed, got %v", tc.file, err)
+			}
+		})
+	}
+}
+
+/*
+ * --from-list sources aren't known until the list is read, so are checked as media are listed
+ */
+func TestListMediaRejectsListedFilesInsideDestination(t *testing.T) {
+	root := t.TempDir()
+	to := filepath.Join(root, "sorted")
+
+	WriteTestFile(t, filepath.Join(root, "card/IMG_0001.jpg"), "photo")
+	WriteTestFile(t, filepath.Join(root, "card/IMG_0002.jpg"), "photo")
+	WriteTestFile(t, filepath.Join(to, "0/IMG_0001.jpg"), "copied photo")
+
+	card := filepath.Join(root, "card/IMG_0001.jpg") + "\n" + filepath.Join(root, "card/IMG_0002.jpg") + "\n"
+
+	list := filepath.Join(root, "list.txt")
+	WriteTestFile(t, list, card+filepath.Join(to, "0/IMG_0001.jpg")+"\n")
+
+	opts := BadgerOpts{fromLists: []string{list}, to: to}
+
+	if _, err := opts.ListMedia(); err == nil {
+		t.Error("expected a listed file inside --to to be rejected")
+	}
+
+	WriteTestFile(t, list, card)
+
+	if _, err := opts.ListMedia(); err != nil {
+		t.Errorf("expected listed files outside --to to be allowed, got %v", err)
+	}
+}
+
+/*
+ * Only clustering needs two media, so a single file can be listed to copy or index
+ */
+func TestListMediaAcceptsOneFile(t *testing.T) {
+	root := t.TempDir()
+
+	WriteTestFile(t, filepath.Join(root, "IMG_0001.jpg"), "photo")
+	WriteTestFile(t, filepath.Join(root, "IMG_0002.jpg"), "photo")
+
+	opts := BadgerOpts{from: []string{filepath.Join(root, "IMG_0001.jpg")}}
+
+	if library, err := opts.ListMedia(); err != nil || library.Size() != 1 {
+		t.Errorf("expected one file to be listed, got %v", err)
+	}
+
+	opts = BadgerOpts{from: []string{filepath.Join(root, "*.jpg")}, excludes: []string{"IMG_0002.jpg"}}
+
+	library, err := opts.ListMedia()
+	if err != nil || library.Size() != 1 {
+		t.Fatalf("expected --exclude to leave one file listed, got %v", err)
+	}
+
+	if library.excluded != 1 {
+		t.Errorf("expected one file to be excluded, but %v were", library.excluded)
+	}
+
+	opts.excludes = []string{"*.jpg"}
+
+	if _, err := opts.ListMedia(); err == nil {
+		t.Error("expected --exclude leaving out every file to be rejected")
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The media type of each (lowercase) file-extension; anything else is UNKNOWN. Extended with --map-ext
+var ExtensionTypes = map[string]MediaType{
+	// photos badger can decode & grade
+	".jpg":  PHOTO,
+	".jpeg": PHOTO,
+	".png":  PHOTO,
+	".heic": PHOTO,
+	".heif": PHOTO,
+
+	// raw images; graded from their embedded preview where it can be read, otherwise copied as-is
+	".rw2": RAW,
+	".raw": RAW,
+	".dng": RAW,
+	".cr2": RAW,
+	".cr3": RAW,
+	".crw": RAW,
+	".nef": RAW,
+	".nrw": RAW,
+	".arw": RAW,
+	".srf": RAW,
+	".sr2": RAW,
+	".orf": RAW,
+	".raf": RAW,
+	".pef": RAW,
+	".srw": RAW,
+	".rwl": RAW,
+	".x3f": RAW,
+	".3fr": RAW,
+	".iiq": RAW,
+	".erf": RAW,
+	".kdc": RAW,
+	".dcr": RAW,
+	".mrw": RAW,
+
+	// videos
+	".mp4":  VIDEO,
+	".m4v":  VIDEO,
+	".mov":  VIDEO,
+	".avi":  VIDEO,
+	".mts":  VIDEO,
+	".m2ts": VIDEO,
+	".mkv":  VIDEO,
+	".webm": VIDEO,
+	".3gp":  VIDEO,
+	".mpg":  VIDEO,
+	".mpeg": VIDEO,
+	".wmv":  VIDEO,
+}
+
+/*
+ * Parse a --map-ext mapping like '.cr3=raw' into an extension and media type
+ */
+func ParseExtensionMapping(text string) (string, MediaType, error) {
+	parts := strings.SplitN(text, "=", 2)
+	if len(parts) != 2 || len(parts[0]) == 0 {
+		return "", "", fmt.Errorf("badger: could not parse --map-ext '%v'; expected an extension and type, like '.cr3=raw'", text)
+	}
+
+	ext := strings.ToLower(parts[0])
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+
+	switch kind := MediaType(strings.ToLower(parts[1])); kind {
+	case PHOTO, RAW, VIDEO, UNKNOWN:
+		return ext, kind, nil
+	}
+
+	return "", "", fmt.Errorf("badger: unsupported type in --map-ext '%v'; expected photo, raw, video or unknown", text)
+}
+
+/*
+ * Add --map-ext mappings to the extension table, overriding the defaults
+ */
+func MapExtensions(mappings []string) error {
+	for _, mapping := range mappings {
+		ext, kind, err := ParseExtensionMapping(mapping)
+		if err != nil {
+			return err
+		}
+
+		ExtensionTypes[ext] = kind
+	}
+
+	return nil
+}
@@ -3,29 +3,71 @@ package main
 import (
 	"errors"
 	"fmt"
-	"math"
+	"image"
 	"os"
 	"path"
 	"path/filepath"
 	"strings"
+	"text/template"
+	"time"
 
-	ed "github.com/Ernyoke/Imger/edgedetection"
 	"github.com/Ernyoke/Imger/imgio"
-	"github.com/Ernyoke/Imger/padding"
 	"github.com/rwcarlsen/goexif/exif"
 )
 
 type Media struct {
-	source    string
-	dstDir    string
-	blur      int
-	size      int64
-	mtime     int
-	clusterId int
-	id        int
-	copied    bool
-	exifData  *PhotoInformation
-	hash      string
+	source        string
+	dstDir        string
+	blur          int
+	rawBlur       int
+	size          int64
+	mtime         int
+	ctime         int
+	clusterId     int
+	clusterLabel  string
+	id            int
+	copied        bool
+	linked        bool
+	moved         bool
+	skipped       bool
+	skipReason    SkipReason
+	indexed       bool
+	rejected      bool
+	exifData      *PhotoInformation
+	exif          *exif.Exif
+	exifErr       error
+	exifLoaded    bool
+	hash          string
+	hashAlgorithm HashAlgorithm
+	sidecars      []string
+	runId         string
+	thumbnail     string
+	phash         string
+	// the --from glob, --from-dir folder or --from-list file that listed the media, to tell several cards apart
+	sourceInput string
+	// numbers the group of near-duplicates this photo belongs to within its cluster; zero if none
+	duplicateGroup int
+	// the number of faces found in the photo, with --count-faces; only meaningful if counted
+	faces        int
+	facesCounted bool
+	// how much of the photo is clipped or crushed; nil until graded
+	exposure *Exposure
+	// the metric photos are graded for sharpness by; the laplacian if unset
+	sharpnessMetric SharpnessMetric
+	// photos are shrunk to this long-edge before grading; zero grades them at full resolution
+	gradeMaxEdge int
+	// faces are counted while the photo is decoded for grading, with --count-faces
+	countFaces bool
+	// whether the photo was decoded and graded, so bursts, duplicates, faces and blur share one decode
+	graded bool
+
+	flatten      bool
+	nameTemplate *template.Template
+	names        *NameRegistry
+
+	ignoreOrientation bool
+	destination       Destination
+	dstPath           string
 }
 
 type MediaType string
@@ -41,7 +83,14 @@ const (
 func (media *Media) LoadInformation() error {
 	// memoised
 	media.GetMtime()
-	_, err := media.GetHash()
+	media.GetCreationTime()
+
+	_, err := media.Size()
+	if err != nil {
+		return err
+	}
+
+	_, err = media.GetHash()
 	if err != nil {
 		return err
 	}
@@ -51,6 +100,9 @@ func (media *Media) LoadInformation() error {
 		return err
 	}
 
+	// everything needed from the exif is memoised, so release it; raw images' can be large
+	media.exif, media.exifErr, media.exifLoaded = nil, nil, false
+
 	return nil
 }
 
@@ -58,15 +110,8 @@ func (media *Media) LoadInformation() error {
  * Get the media type based on file-extensions
  */
 func (media *Media) GetType() MediaType {
-	ext := strings.ToLower(media.GetExt())
-
-	switch ext {
-	case ".jpg", ".jpeg", ".png":
-		return PHOTO
-	case ".rw2", ".raw":
-		return RAW
-	case ".mp4":
-		return VIDEO
+	if kind, ok := ExtensionTypes[strings.ToLower(media.GetExt())]; ok {
+		return kind
 	}
 
 	return UNKNOWN
@@ -81,29 +126,143 @@ func (media *Media) GetExt() string {
 }
 
 /*
- * Get the target filename for the copied media
+ * Get the name of the cluster-folder this media is copied into
+ */
+func (media *Media) GetClusterLabel() string {
+	if len(media.clusterLabel) > 0 {
+		return media.clusterLabel
+	}
+
+	return fmt.Sprint(media.clusterId)
+}
+
+/*
+ * Get the fields available to --name-template
+ */
+func (media *Media) GetNameFields() NameFields {
+	return NameFields{
+		Blur:           media.blur,
+		Id:             media.id,
+		Ext:            media.GetExt(),
+		ClusterLabel:   media.GetClusterLabel(),
+		CaptureDate:    time.Unix(int64(media.GetCreationTime()), 0),
+		OriginalBase:   filepath.Base(media.GetPrefix()),
+		DuplicateGroup: media.duplicateGroup,
+		Faces:          media.faces,
+		Exposure:       media.GetExposureScore(),
+	}
+}
+
+/*
+ * Get the metric this media is graded for sharpness by
+ */
+func (media *Media) GetSharpnessMetric() SharpnessMetric {
+	if len(media.sharpnessMetric) == 0 {
+		return LAPLACIAN
+	}
+
+	return media.sharpnessMetric
+}
+
+/*
+ * Get the photo's exposure score, from 0 to 100; -1 if it wasn't graded
+ */
+func (media *Media) GetExposureScore() int {
+	if media.exposure == nil {
+		return -1
+	}
+
+	return media.exposure.Score()
+}
+
+/*
+ * Name the media with its --name-template
+ */
+func (media *Media) GetTemplatedName() (string, error) {
+	name, err := ExecuteNameTemplate(media.nameTemplate, media.GetNameFields())
+	if err != nil {
+		return "", fmt.Errorf("badger: could not name %v with --name-template: %v", media.source, err)
+	}
+
+	return name, nil
+}
+
+/*
+ * Get the target filename for the copied media, from the --name-template if provided
+ */
+func (media *Media) GetDestinationName() string {
+	// media the template can't name fail before they're copied, in ClaimTemplatedNames
+	if media.nameTemplate != nil {
+		if name, err := media.GetTemplatedName(); err == nil {
+			return name
+		}
+	}
+
+	name := fmt.Sprint(media.id)
+
+	// everything shares one folder when flattened, so include the original name too
+	if media.flatten {
+		name += "_" + filepath.Base(media.GetPrefix())
+	}
+
+	if media.blur != -1 {
+		name = fmt.Sprint(media.blur) + "_" + name
+	}
+
+	// near-duplicates share a prefix, so they sort next to each other
+	if media.duplicateGroup > 0 {
+		name = fmt.Sprintf("dup%d_", media.duplicateGroup) + name
+	}
+
+	return name + media.GetExt()
+}
+
+/*
+ * Get the target filepath for the copied media
  */
 func (media *Media) GetDestinationPath() string {
-	blur := media.blur
+	// set when the media is renamed to keep an existing file
+	if len(media.dstPath) > 0 {
+		return media.dstPath
+	}
 
-	name := ""
-	root := filepath.Join(media.dstDir, fmt.Sprint(media.clusterId))
+	root := filepath.Join(media.dstDir, media.GetClusterLabel())
+	if media.flatten {
+		root = media.dstDir
+	}
 
-	if blur == -1 {
-		name = fmt.Sprint(media.id) + media.GetExt()
-	} else {
-		name = fmt.Sprint(blur) + "_" + fmt.Sprint(media.id) + media.GetExt()
+	// rejected photos are set aside, in the same cluster-folder beneath the rejects folder
+	if media.rejected {
+		rel, _ := filepath.Rel(media.dstDir, root)
+		root = filepath.Join(media.dstDir, RejectsLabel, rel)
+	}
+
+	name := media.GetDestinationName()
+
+	if media.names != nil {
+		return media.names.Claim(media.source, root, name)
 	}
 
 	return filepath.Join(root, name)
 }
 
+/*
+ * Get where the media is copied to; the local filesystem, unless a remote destination was given
+ */
+func (media *Media) GetDestination() Destination {
+	if media.destination == nil {
+		return LocalDestination{}
+	}
+
+	return media.destination
+}
+
 /*
  * Check whether the destination file exists
  */
 func (media *Media) DestinationExists() (bool, error) {
 	dest := media.GetDestinationPath()
-	_, err := os.Stat(dest)
+	_, err := media.GetDestination().Stat(dest)
 
 	if err != nil {
 		if !errors.Is(err, os.ErrNotExist) {
@@ -117,7 +276,13 @@ func (media *Media) DestinationExists() (bool, error) {
 }
 
 func (media *Media) DestinationHash() (string, error) {
-	return GetHash(media.GetDestinationPath())
+	file, err := media.GetDestination().Open(media.GetDestinationPath())
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	return HashReader(file, media.hashAlgorithm)
 }
 
 func (media *Media) Size() (int64, error) {
@@ -154,15 +319,43 @@ func (media *Media) GetMtime() int {
 	return media.mtime
 }
 
-func (media *Media) GetExifCreateTime() (int, error) {
-	conn, err := os.Open(media.source)
-	defer conn.Close()
+/*
+ * Open and decode a file's exif metadata
+ */
+func LoadExif(fpath string) (*exif.Exif, error) {
+	// HEIF containers store exif as an item, rather than in a segment
+	if IsHeif(fpath) {
+		return LoadHeifExif(fpath)
+	}
 
+	conn, err := os.Open(fpath)
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+	defer conn.Close()
+
+	return exif.Decode(conn)
+}
+
+/*
+ * Get the media's exif metadata, decoding it at most once; a missing or corrupt exif
+ * is remembered, rather than re-read
+ */
+func (media *Media) GetExif() (*exif.Exif, error) {
+	if !media.exifLoaded {
+		if media.GetType() == RAW {
+			media.exif, media.exifErr = LoadRawExif(media.source)
+		} else {
+			media.exif, media.exifErr = LoadExif(media.source)
+		}
+		media.exifLoaded = true
 	}
 
-	metaData, err := exif.Decode(conn)
+	return media.exif, media.exifErr
+}
+
+func (media *Media) GetExifCreateTime() (int, error) {
+	metaData, err := media.GetExif()
 	if err != nil {
 		return 0, err
 	}
@@ -178,19 +371,43 @@ func (media *Media) GetExifCreateTime() (int, error) {
 }
 
 func (media *Media) GetCreationTime() int {
-	ctime, err := media.GetExifCreateTime()
+	if media.ctime > 0 {
+		return media.ctime
+	}
+
+	var ctime int
+	var err error
+
+	// videos record their capture time in their container, rather than in exif
+	if media.GetType() == VIDEO {
+		ctime, err = ReadVideoCreationTime(media.source)
+	} else {
+		ctime, err = media.GetExifCreateTime()
+	}
 
 	if err != nil {
-		return media.GetMtime()
+		media.ctime = media.GetMtime()
 	} else {
-		return ctime
+		media.ctime = ctime
 	}
+
+	return media.ctime
 }
 
 type PhotoInformation struct {
-	Iso          string
-	Aperture     string
-	ShutterSpeed string
+	Iso            string
+	Aperture       string
+	ShutterSpeed   string
+	IsoValue       float64
+	ApertureFStop  float64
+	ShutterSeconds float64
+	HasLocation    bool
+	Latitude       float64
+	Longitude      float64
+	HasAltitude    bool
+	Altitude       float64
+	Orientation    int
+	Tags           ExifTags
 }
 
 func (media *Media) GetInformation() (*PhotoInformation, error) {
@@ -198,54 +415,67 @@ func (media *Media) GetInformation() (*PhotoInformation, error) {
 		return media.exifData, nil
 	}
 
-	if media.GetType() != PHOTO {
+	kind := media.GetType()
+	if kind != PHOTO && kind != RAW {
 		return &PhotoInformation{}, nil
 	}
 
-	conn, err := os.Open(media.source)
-	defer conn.Close()
-
+	// photos without readable exif are still copied, just without exposure or location information
+	metaData, err := media.GetExif()
 	if err != nil {
-		return &PhotoInformation{}, err
+		media.exifData = &PhotoInformation{}
+		return media.exifData, nil
 	}
 
-	metaData, err := exif.Decode(conn)
-
-	if err != nil {
-		return &PhotoInformation{}, err
+	// raw images store their orientation in their own exif, rather than their previews'
+	if kind == RAW {
+		media.exifData = &PhotoInformation{Orientation: ReadOrientation(metaData), Tags: ReadExifTags(metaData)}
+		return media.exifData, nil
 	}
 
-	// attempt to extract and store exif information
-	fstop := ""
-	iso := ""
-	shutter := ""
-
-	fstopTag, err := metaData.Get(exif.FocalLength)
-	if err == nil {
-		fstop, _ = fstopTag.StringVal()
-	}
+	// attempt to extract and store exif information, as both strings and numbers
+	iso, isoValue := ReadIso(metaData)
+	fstop, fstopValue := ReadApertureFStop(metaData)
+	shutter, shutterSeconds := ReadShutterSeconds(metaData)
 
-	isoTag, err := metaData.Get(exif.ISOSpeedRatings)
-	if err == nil {
-		iso, _ = isoTag.StringVal()
+	info := PhotoInformation{
+		Iso:            iso,
+		Aperture:       fstop,
+		ShutterSpeed:   shutter,
+		IsoValue:       isoValue,
+		ApertureFStop:  fstopValue,
+		ShutterSeconds: shutterSeconds,
+		Orientation:    ReadOrientation(metaData),
+		Tags:           ReadExifTags(metaData),
 	}
 
-	shutterTag, err := metaData.Get(exif.ShutterSpeedValue)
+	lat, lng, err := metaData.LatLong()
 	if err == nil {
-		shutter, _ = shutterTag.StringVal()
+		info.HasLocation = true
+		info.Latitude = lat
+		info.Longitude = lng
 	}
 
-	info := PhotoInformation{
-		Iso:          iso,
-		Aperture:     fstop,
-		ShutterSpeed: shutter,
-	}
+	info.Altitude, info.HasAltitude = ReadAltitude(metaData)
 
 	media.exifData = &info
 
 	return &info, nil
 }
 
+/*
+ * Get the GPS coordinates a photo was taken at, if they were recorded
+ */
+func (media *Media) GetLocation() (float64, float64, bool) {
+	info, err := media.GetInformation()
+
+	if err != nil || !info.HasLocation {
+		return 0, 0, false
+	}
+
+	return info.Latitude, info.Longitude, true
+}
+
 /*
  * Get and cache a file hash
  */
@@ -254,7 +484,7 @@ func (media *Media) GetHash() (string, error) {
 		return media.hash, nil
 	}
 
-	hashSum, err := GetHash(media.source)
+	hashSum, err := GetHash(media.source, media.hashAlgorithm)
 	if err != nil {
 		return "", err
 	}
@@ -264,41 +494,131 @@ func (media *Media) GetHash() (string, error) {
 	return hashSum, nil
 }
 
+/*
+ * Read the media as a grayscale image; raw images are read from their embedded preview
+ */
+func (media *Media) ReadGray() (*image.Gray, error) {
+	var img *image.Gray
+	var err error
+
+	if media.GetType() == RAW {
+		img, err = ReadRawPreviewGray(media.source)
+	} else if IsHeif(media.source) {
+		img, err = ReadHeifGray(media.source)
+	} else {
+		img, err = imgio.ImreadGray(media.source)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return OrientGray(img, media.GetOrientation()), nil
+}
+
+/*
+ * Read an image, or a RAW file's embedded preview, in colour
+ */
+func (media *Media) ReadRGBA() (*image.RGBA, error) {
+	var img *image.RGBA
+	var err error
+
+	if media.GetType() == RAW {
+		img, err = ReadRawPreviewRGBA(media.source)
+	} else if IsHeif(media.source) {
+		img, err = ReadHeifRGBA(media.source)
+	} else {
+		img, err = imgio.ImreadRGBA(media.source)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return OrientRGBA(img, media.GetOrientation()), nil
+}
+
+/*
+ * Get the EXIF orientation to turn the image upright with; one (upright) when orientation is ignored
+ */
+func (media *Media) GetOrientation() int {
+	if media.ignoreOrientation {
+		return 1
+	}
+
+	info, err := media.GetInformation()
+	if err != nil || info.Orientation == 0 {
+		return 1
+	}
+
+	return info.Orientation
+}
+
 func (media *Media) GetBlur() (float64, error) {
 	if media.blur > 0 {
 		return float64(media.blur), nil
 	}
 
-	img, err := imgio.ImreadGray(media.source)
+	return media.Grade()
+}
 
-	if err != nil {
-		panic(err)
+/*
+ * Get a perceptual hash of the image; similar images have hashes a small hamming-distance apart
+ */
+func (media *Media) GetPerceptualHash() (string, error) {
+	if len(media.phash) > 0 {
+		return media.phash, nil
 	}
 
-	laplacian, err := ed.LaplacianGray(img, padding.BorderConstant, ed.K4)
-	if err != nil {
-		return 0, err
+	_, err := media.Grade()
+	return media.phash, err
+}
+
+/*
+ * Decode an image once, to compute its blur-score, perceptual hash, exposure and, with --count-faces,
+ * its faces. Returns the blur; later calls return it without decoding the image again
+ */
+func (media *Media) Grade() (float64, error) {
+	if media.graded {
+		return float64(media.rawBlur), nil
 	}
 
-	pixSum := 0.0
-	for _, pix := range laplacian.Pix {
-		pixSum += float64(pix)
+	img, err := media.ReadGray()
+
+	if err != nil {
+		return 0, fmt.Errorf("badger: failed to decode %v: %w", media.source, err)
 	}
 
-	mean := pixSum / float64(len(laplacian.Pix))
+	// faces are found at their own resolution, so they're counted before shrinking for grading
+	if media.countFaces && !media.facesCounted {
+		faces, err := CountFaces(img)
+		if err != nil {
+			return 0, err
+		}
 
-	diffs := make([]float64, len(laplacian.Pix))
+		media.faces = faces
+		media.facesCounted = true
+	}
 
-	for idx, pix := range laplacian.Pix {
-		diffs[idx] = math.Pow(float64(pix)-mean, 2)
+	if media.gradeMaxEdge > 0 {
+		img, err = ScaleGrayToFit(img, media.gradeMaxEdge)
+		if err != nil {
+			return 0, err
+		}
 	}
 
-	variance := 0.0
-	for _, diff := range diffs {
-		variance += float64(diff)
+	media.phash = FormatPerceptualHash(DifferenceHash(img))
+
+	exposure := GrayExposure(img)
+	media.exposure = &exposure
+
+	blur, err := NewScorer(media.sharpnessMetric).Score(img)
+	if err != nil {
+		return 0, err
 	}
 
-	variance = variance / float64(len(laplacian.Pix))
+	media.rawBlur = int(blur)
+	media.graded = true
 
-	return math.Ceil(variance * 10), nil
+	return blur, nil
 }
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// How many of a merged database's media were added to the merged index
+type MergeCounts struct {
+	media  int64
+	merged int64
+}
+
+/*
+ * List a table's columns, so rows can be copied between databases by name whichever
+ * order their columns were added in
+ */
+func (conn *BadgerDb) TableColumns(table string) ([]string, error) {
+	rows, err := conn.db.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := []string{}
+
+	for rows.Next() {
+		var name string
+
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+
+		columns = append(columns, name)
+	}
+
+	return columns, rows.Err()
+}
+
+/*
+ * Add another metadata database's media, runs and cached grades to this one. Media are deduplicated
+ * by content hash; media already in this database are kept, and of several copies of the same content
+ * the first copied (rather than skipped) one is added. Media are keyed by source and content, so a
+ * source path already indexed with other content, like a second card mounted at the same path, is added
+ * alongside it
+ */
+func (conn *BadgerDb) MergeDatabase(dbPath string) (MergeCounts, error) {
+	counts := MergeCounts{}
+
+	mediaColumns, err := conn.TableColumns("mediaData")
+	if err != nil {
+		return counts, err
+	}
+
+	gradeColumns, err := conn.TableColumns("gradeCache")
+	if err != nil {
+		return counts, err
+	}
+
+	// attached databases are only visible to the connection that attached them
+	conn.db.SetMaxOpenConns(1)
+
+	if _, err := conn.db.Exec(`ATTACH DATABASE ? AS merged`, dbPath); err != nil {
+		return counts, err
+	}
+	defer conn.db.Exec(`DETACH DATABASE merged`)
+
+	tx, err := conn.db.Begin()
+	if err != nil {
+		return counts, err
+	}
+	defer tx.Rollback()
+
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM merged.mediaData`).Scan(&counts.media); err != nil {
+		return counts, err
+	}
+
+	// the first copy of each content not yet indexed
+	candidates := `(
+		SELECT * FROM (
+			SELECT *, ROW_NUMBER() OVER (
+				PARTITION BY hash, IFNULL(hashAlgorithm, '') ORDER BY skipped, rowid
+			) AS copyNumber
+			FROM merged.mediaData
+		) AS copies
+		WHERE copyNumber = 1 AND NOT EXISTS (
+			SELECT 1 FROM main.mediaData AS indexed
+			WHERE indexed.hash = copies.hash AND IFNULL(indexed.hashAlgorithm, '') = IFNULL(copies.hashAlgorithm, '')
+		)
+	) AS candidates`
+
+	columns := strings.Join(mediaColumns, ", ")
+
+	result, err := tx.Exec(`INSERT INTO main.mediaData (` + columns + `)
+	SELECT ` + columns + ` FROM ` + candidates)
+
+	if err != nil {
+		return counts, err
+	}
+
+	if counts.merged, err = result.RowsAffected(); err != nil {
+		return counts, err
+	}
+
+	_, err = tx.Exec(`INSERT OR IGNORE INTO main.runs (runId, sources, destination, args)
+	SELECT runId, sources, destination, args FROM merged.runs`)
+
+	if err != nil {
+		return counts, err
+	}
+
+	columns = strings.Join(gradeColumns, ", ")
+
+	_, err = tx.Exec(`INSERT OR IGNORE INTO main.gradeCache (` + columns + `) SELECT ` + columns + ` FROM merged.gradeCache`)
+
+	if err != nil {
+		return counts, err
+	}
+
+	return counts, tx.Commit()
+}
+
+/*
+ * Bring a database being merged up to the latest schema, so its columns match the merged database's
+ */
+func MigrateDatabase(dir string) error {
+	conn, err := NewSqliteDB(dir)
+	if err != nil {
+		return err
+	}
+
+	db := BadgerDb{conn}
+	defer db.Close()
+
+	return db.CreateTables()
+}
+
+/*
+ * Copy a database being merged into a temporary directory, and migrate the copy instead. The
+ * databases being merged are only read, so merging never changes their schema. The caller removes
+ * the returned directory
+ */
+func MigratedCopy(dir string) (string, error) {
+	db, err := OpenReadOnlyDb(dir)
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+
+	tmp, err := os.MkdirTemp("", "badger-merge-")
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := db.db.Exec(`VACUUM INTO ?`, filepath.Join(tmp, ".badger_metadata.sqlite")); err != nil {
+		os.RemoveAll(tmp)
+		return "", err
+	}
+
+	if err := MigrateDatabase(tmp); err != nil {
+		os.RemoveAll(tmp)
+		return "", err
+	}
+
+	return tmp, nil
+}
+
+/*
+ * Merge the metadata databases of several destination libraries, like an archive spread across drives,
+ * into a single index in another directory. Media are deduplicated by content hash
+ */
+func Merge(dirs []string, out string) int {
+	outPath, err := filepath.Abs(filepath.Join(out, ".badger_metadata.sqlite"))
+	bail(err)
+
+	dbPaths := make([]string, len(dirs))
+
+	for idx, dir := range dirs {
+		dbPaths[idx], err = filepath.Abs(filepath.Join(dir, ".badger_metadata.sqlite"))
+		bail(err)
+
+		// fail before creating the merged database, rather than merging only some
+		if _, err := os.Stat(dbPaths[idx]); err != nil {
+			bail(fmt.Errorf("badger: %v doesn't contain a badger metadata database", dir))
+		}
+
+		if dbPaths[idx] == outPath {
+			bail(errors.New("badger: --out must differ from the databases being merged"))
+		}
+	}
+
+	err = os.MkdirAll(out, 0755)
+	bail(err)
+
+	conn, err := NewSqliteDB(out)
+	bail(err)
+
+	db := BadgerDb{conn}
+	defer db.Close()
+
+	err = db.CreateTables()
+	bail(err)
+
+	for _, dir := range dirs {
+		copyDir, err := MigratedCopy(dir)
+		if err != nil {
+			bail(fmt.Errorf("badger: failed to read %v: %v", dir, err))
+		}
+
+		counts, err := db.MergeDatabase(filepath.Join(copyDir, ".badger_metadata.sqlite"))
+		os.RemoveAll(copyDir)
+
+		if err != nil {
+			bail(fmt.Errorf("badger: failed to merge %v: %v", dir, err))
+		}
+
+		fmt.Printf("badger: merged %v of %v media from %v; %v were already indexed\n", counts.merged, counts.media, dir, counts.media-counts.merged)
+	}
+
+	return 0
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+/*
+ * Create a library's database, recording media as (source, hash) pairs
+ */
+func NewTestLibraryDb(t *testing.T, dir string, media [][2]string) {
+	t.Helper()
+
+	db := NewTestRunDb(t, dir, "run", dir)
+
+	for _, pair := range media {
+		InsertTestRow(t, db, pair[0], filepath.Join(dir, filepath.Base(pair[0])), pair[1])
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMergeDatabaseDeduplicatesByHash(t *testing.T) {
+	first := t.TempDir()
+	second := t.TempDir()
+
+	NewTestLibraryDb(t, first, [][2]string{
+		{"/media/card/a.jpg", "aaaa"},
+		{"/media/card/b.jpg", "bbbb"},
+	})
+
+	// the same content from another mount-point, a second card mounted at the same path, and new content
+	NewTestLibraryDb(t, second, [][2]string{
+		{"/mnt/sd/a.jpg", "aaaa"},
+		{"/media/card/b.jpg", "cccc"},
+		{"/media/card/d.jpg", "dddd"},
+	})
+
+	out := t.TempDir()
+	db := NewTestRunDb(t, out, "", "")
+
+	if _, err := db.MergeDatabase(filepath.Join(first, ".badger_metadata.sqlite")); err != nil {
+		t.Fatal(err)
+	}
+
+	counts, err := db.MergeDatabase(filepath.Join(second, ".badger_metadata.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if counts.media != 3 || counts.merged != 2 {
+		t.Errorf("expected two of three media to be merged, got %v of %v", counts.merged, counts.media)
+	}
+
+	if rows := CountMediaRows(t, db, "1 = 1"); rows != 4 {
+		t.Errorf("expected four media in the merged index, got %v", rows)
+	}
+
+	// each card's content is kept under the shared source path
+	if kept := CountMediaRows(t, db, "src = ?", "/media/card/b.jpg"); kept != 2 {
+		t.Errorf("expected both cards' media to be kept, got %v", kept)
+	}
+}
+
+/*
+ * Databases written by older versions of badger are merged without being migrated themselves
+ */
+func TestMergeDoesntMigrateInputs(t *testing.T) {
+	first := t.TempDir()
+	NewTestLibraryDb(t, first, [][2]string{{"/media/card/a.jpg", "aaaa"}})
+
+	// roll the database back to the schema before media were keyed by content
+	db := OpenTestDb(t, first)
+	for _, statement := range []string{
+		`DROP INDEX mediaDataSrcHash`,
+		`CREATE UNIQUE INDEX mediaDataSrc ON mediaData (src)`,
+		`DELETE FROM schema_version WHERE version = 6`,
+	} {
+		if _, err := db.db.Exec(statement); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	out := t.TempDir()
+	if code := Merge([]string{first}, out); code != 0 {
+		t.Fatalf("expected merging to succeed, got exit code %v", code)
+	}
+
+	if rows := CountMediaRows(t, OpenTestDb(t, out), "1 = 1"); rows != 1 {
+		t.Errorf("expected the media to be merged, got %v rows", rows)
+	}
+
+	readonly, err := OpenReadOnlyDb(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer readonly.Close()
+
+	var version int
+	if err := readonly.db.QueryRow(`SELECT MAX(version) FROM schema_version`).Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+
+	if version != 5 {
+		t.Errorf("expected the merged database to stay at schema version 5, got %v", version)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// A step upgrading the database schema to the next version
+type Migration struct {
+	version     int
+	description string
+	apply       func(tx *sql.Tx) error
+}
+
+// Every schema version, in order. Append new steps rather than changing released ones, since
+// existing databases have already applied them
+var Migrations = []Migration{
+	{1, "create the initial tables", CreateInitialSchema},
+	{2, "declare mediaData.id as an INTEGER", FixMediaIdType},
+	{3, "add GPS latitude, longitude & altitude columns", AddLocationColumns},
+	{4, "add an exif column of every decoded tag", AddExifColumn},
+	{5, "add an indexed column, for media recorded without being copied", AddIndexedColumn},
+	{6, "key media by source and content hash, rather than source alone", KeyMediaBySourceAndHash},
+}
+
+/*
+ * Get the schema version of a database; zero for databases older than schema versioning
+ */
+func SchemaVersion(tx *sql.Tx) (int, error) {
+	_, err := tx.Exec(`CREATE TABLE IF NOT EXISTS schema_version (
+			version         INTEGER NOT NULL,
+			description     TEXT NOT NULL,
+			appliedAt       TEXT NOT NULL
+	)`)
+
+	if err != nil {
+		return 0, err
+	}
+
+	var version int
+	err = tx.QueryRow(`SELECT IFNULL(MAX(version), 0) FROM schema_version`).Scan(&version)
+
+	return version, err
+}
+
+/*
+ * Apply every migration the database hasn't, in order, within a single transaction; a failed
+ * step leaves the database as it was
+ */
+func (conn *BadgerDb) Migrate() error {
+	tx, err := conn.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	version, err := SchemaVersion(tx)
+	if err != nil {
+		return err
+	}
+
+	latest := Migrations[len(Migrations)-1].version
+	if version > latest {
+		return fmt.Errorf("badger: the database is at schema version %v, but this version of badger only knows up to %v; upgrade badger", version, latest)
+	}
+
+	for _, migration := range Migrations {
+		if migration.version <= version {
+			continue
+		}
+
+		if err := migration.apply(tx); err != nil {
+			return fmt.Errorf("badger: failed to migrate the database to schema version %v (%v): %w", migration.version, migration.description, err)
+		}
+
+		_, err = tx.Exec(`INSERT INTO schema_version (version, description, appliedAt) VALUES (?, ?, datetime('now'))`, migration.version, migration.description)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+/*
+ * Schema version 2; mediaData.id was declared as INTEEGR. SQLite can't change a column's type, so
+ * the table is rebuilt and its rows copied across
+ */
+func FixMediaIdType(tx *sql.Tx) error {
+	columns := `src, dst, hash, hashAlgorithm, id, clusterId, blur, mediaType, iso, aperture, shutterSpeed, mtime,
+		duplicateGroup, skipped, linked, moved, runId, thumbnail, phash, rawBlur, size, faces, clippedHighlights,
+		crushedShadows, sharpnessMetric, gradeEdge, sourceInput`
+
+	statements := []string{
+		`CREATE TABLE mediaDataV2 (
+			src             TEXT NOT NULL,
+			dst             TEXT NOT NULL,
+			hash            TEXT NOT NULL,
+			hashAlgorithm   TEXT,
+			id              INTEGER NOT NULL,
+			clusterId       INTEGER NOT NULL,
+			blur            INTEGER,
+			mediaType       TEXT NOT NULL,
+			iso             TEXT,
+			aperture        TEXT,
+			shutterSpeed    TEXT,
+			mtime           TEXT,
+			duplicateGroup  INTEGER NOT NULL DEFAULT 0,
+			skipped         INTEGER NOT NULL DEFAULT 0,
+			linked          INTEGER NOT NULL DEFAULT 0,
+			moved           INTEGER NOT NULL DEFAULT 0,
+			runId           TEXT,
+			thumbnail       TEXT,
+			phash           TEXT,
+			rawBlur         INTEGER,
+			size            INTEGER,
+			faces           INTEGER,
+			clippedHighlights REAL,
+			crushedShadows  REAL,
+			sharpnessMetric TEXT,
+			gradeEdge       INTEGER,
+			sourceInput     TEXT
+		)`,
+		`INSERT INTO mediaDataV2 (` + columns + `) SELECT ` + columns + ` FROM mediaData`,
+		`DROP TABLE mediaData`,
+		`ALTER TABLE mediaDataV2 RENAME TO mediaData`,
+		`CREATE UNIQUE INDEX mediaDataSrc ON mediaData (src)`,
+		`CREATE INDEX mediaDataHash ON mediaData (hash)`,
+	}
+
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+ * Schema version 3; store where photos were taken, so they can be queried by location without
+ * re-reading their exif
+ */
+func AddLocationColumns(tx *sql.Tx) error {
+	for _, column := range []string{"latitude", "longitude", "altitude"} {
+		if err := AddMissingColumn(tx, "mediaData", column, "REAL"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+ * Schema version 4; store every decoded exif tag as JSON, since reading them again from raw
+ * images is slow
+ */
+func AddExifColumn(tx *sql.Tx) error {
+	return AddMissingColumn(tx, "mediaData", "exif", "TEXT")
+}
+
+/*
+ * Schema version 5; mark media 'badger index' recorded without copying, which later runs shouldn't
+ * treat as imported
+ */
+func AddIndexedColumn(tx *sql.Tx) error {
+	return AddMissingColumn(tx, "mediaData", "indexed", "INTEGER NOT NULL DEFAULT 0")
+}
+
+/*
+ * Schema version 6; key media by their source and content, so a second card mounted at the same
+ * path, or a later run skipping a source, doesn't replace what an earlier run recorded copying
+ */
+func KeyMediaBySourceAndHash(tx *sql.Tx) error {
+	statements := []string{
+		`DROP INDEX IF EXISTS mediaDataSrc`,
+		`CREATE UNIQUE INDEX mediaDataSrcHash ON mediaData (src, hash)`,
+	}
+
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+/*
+ * Does a file at the destination have the content of a local file?
+ */
+func SameFile(fpath string, destination Destination, dstPath string, algorithm HashAlgorithm) (bool, error) {
+	hash, err := GetHash(fpath, algorithm)
+	if err != nil {
+		return false, err
+	}
+
+	file, err := destination.Open(dstPath)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	dstHash, err := HashReader(file, algorithm)
+	if err != nil {
+		return false, err
+	}
+
+	return hash == dstHash, nil
+}
+
+/*
+ * Rename a media and its sidecars into place, for destinations on the same filesystem as the source.
+ * If anything can't be renamed, the sidecars already renamed are renamed back
+ */
+func RenameMedia(media *Media) error {
+	dst := media.GetDestinationPath()
+	renamed := []string{}
+
+	undo := func() {
+		for _, sidecar := range renamed {
+			os.Rename(media.GetSidecarDestination(sidecar, dst), sidecar)
+		}
+	}
+
+	for _, sidecar := range media.sidecars {
+		if err := os.Rename(sidecar, media.GetSidecarDestination(sidecar, dst)); err != nil {
+			undo()
+			return err
+		}
+
+		renamed = append(renamed, sidecar)
+	}
+
+	if err := os.Rename(media.source, dst); err != nil {
+		undo()
+		return err
+	}
+
+	return nil
+}
+
+/*
+ * Move a media, and its sidecars, to its destination. Media are renamed when the destination is
+ * on the same filesystem. Otherwise they're copied, and the source is only removed once the copy's
+ * hash matches it. The hash and size recorded for the media must already be memoised
+ */
+func MoveFile(media *Media, preserve PreserveAttrs) error {
+	destination := media.GetDestination()
+
+	if _, local := destination.(LocalDestination); local {
+		err := RenameMedia(media)
+		if err == nil {
+			media.moved = true
+			return nil
+		}
+
+		if !errors.Is(err, syscall.EXDEV) {
+			return err
+		}
+	}
+
+	if err := CopyFile(media, preserve, NO_LINK); err != nil {
+		return err
+	}
+
+	dst := media.GetDestinationPath()
+
+	same, err := media.SameAsDestination()
+	if err != nil {
+		return err
+	}
+
+	if !same {
+		return fmt.Errorf("badger: the copy of %v doesn't match the source; keeping the source", media.source)
+	}
+
+	for _, sidecar := range media.sidecars {
+		same, err := SameFile(sidecar, destination, media.GetSidecarDestination(sidecar, dst), media.hashAlgorithm)
+		if err != nil {
+			return err
+		}
+
+		if !same {
+			return fmt.Errorf("badger: the copy of %v doesn't match the source; keeping the source", sidecar)
+		}
+	}
+
+	// only remove sources once every copy is known to match
+	for _, sidecar := range media.sidecars {
+		if err := os.Remove(sidecar); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Remove(media.source); err != nil {
+		return err
+	}
+
+	media.moved = true
+	return nil
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Fields available to --name-template
+type NameFields struct {
+	Blur         int
+	Id           int
+	Ext          string
+	ClusterLabel string
+	CaptureDate  time.Time
+	OriginalBase string
+	// the photo's group of near-duplicates within its cluster, with --group-duplicates; zero if none
+	DuplicateGroup int
+	// the number of faces in the photo, with --count-faces; zero if not counted
+	Faces int
+	// the percentage of the photo neither clipped to white nor crushed to black; -1 if not graded
+	Exposure int
+}
+
+/*
+ * Parse a --name-template, and execute it against sample fields so that typos
+ * fail at startup rather than mid-copy
+ */
+func ParseNameTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("name").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("badger: could not parse --name-template: %v", err)
+	}
+
+	sample := NameFields{
+		Blur:           100,
+		Id:             1,
+		Ext:            ".jpg",
+		ClusterLabel:   "0",
+		CaptureDate:    time.Now(),
+		OriginalBase:   "IMG_0001",
+		DuplicateGroup: 1,
+		Faces:          1,
+		Exposure:       100,
+	}
+
+	if _, err := ExecuteNameTemplate(tmpl, sample); err != nil {
+		return nil, fmt.Errorf("badger: could not execute --name-template: %v", err)
+	}
+
+	return tmpl, nil
+}
+
+/*
+ * Execute a --name-template against a media's fields. A name is a single file-name, so it can't be
+ * empty, contain a path separator, or walk out of its folder with '..'
+ */
+func ExecuteNameTemplate(tmpl *template.Template, fields NameFields) (string, error) {
+	var name bytes.Buffer
+
+	if err := tmpl.Execute(&name, fields); err != nil {
+		return "", err
+	}
+
+	text := name.String()
+	if len(strings.TrimSpace(text)) == 0 || strings.ContainsAny(text, `/\`) || strings.Contains(text, "..") {
+		return "", fmt.Errorf("'%v' isn't a file-name; names can't be empty, or contain '/', '\\' or '..'", text)
+	}
+
+	return text, nil
+}
+
+/*
+ * Wait for every media to be graded, since names may use blur-scores, then claim templated names in
+ * order of capture time and then source, so colliding names are numbered the same way on every run.
+ * Media the template can't name fail, rather than being copied under another name
+ */
+func ClaimTemplatedNames(graded chan Either[Media]) chan Either[Media] {
+	results := make(chan Either[Media])
+
+	go func() {
+		defer close(results)
+
+		pending := []Either[Media]{}
+		for pair := range graded {
+			pending = append(pending, pair)
+		}
+
+		sort.SliceStable(pending, func(i, j int) bool {
+			first, second := &pending[i].Value, &pending[j].Value
+
+			if first.GetCreationTime() != second.GetCreationTime() {
+				return first.GetCreationTime() < second.GetCreationTime()
+			}
+
+			return first.source < second.source
+		})
+
+		// names claimed before blur-scores were known are given up, so they're claimed in order
+		for idx := range pending {
+			pending[idx].Value.names.Release(pending[idx].Value.source)
+		}
+
+		for _, pair := range pending {
+			media := pair.Value
+
+			if pair.Error == nil && !media.skipped && media.nameTemplate != nil {
+				if _, err := media.GetTemplatedName(); err != nil {
+					pair.Error = err
+				} else {
+					media.GetDestinationPath()
+				}
+			}
+
+			results <- pair
+		}
+	}()
+
+	return results
+}
+
+// Tracks which source file owns each destination path, so that
+// templated names stay unique within a folder
+type NameRegistry struct {
+	lock   sync.Mutex
+	owners map[string]string
+	claims map[string]string
+}
+
+/*
+ * Construct a name-registry
+ */
+func NewNameRegistry() *NameRegistry {
+	return &NameRegistry{
+		owners: make(map[string]string),
+		claims: make(map[string]string),
+	}
+}
+
+/*
+ * Give up the destination path a source file claimed, if any
+ */
+func (names *NameRegistry) Release(source string) {
+	if names == nil {
+		return
+	}
+
+	names.lock.Lock()
+	defer names.lock.Unlock()
+
+	if previous, ok := names.claims[source]; ok {
+		delete(names.owners, previous)
+		delete(names.claims, source)
+	}
+}
+
+/*
+ * Claim a destination path for a source file; a counter is appended to the name
+ * when another source already owns that path
+ */
+func (names *NameRegistry) Claim(source string, root string, name string) string {
+	names.lock.Lock()
+	defer names.lock.Unlock()
+
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	candidate := filepath.Join(root, name)
+
+	for count := 1; ; count++ {
+		owner, taken := names.owners[candidate]
+		if !taken || owner == source {
+			break
+		}
+
+		candidate = filepath.Join(root, fmt.Sprintf("%s_%d%s", base, count, ext))
+	}
+
+	// release any path this source previously held (e.g. before its blur was known)
+	if previous, ok := names.claims[source]; ok && previous != candidate {
+		delete(names.owners, previous)
+	}
+
+	names.owners[candidate] = source
+	names.claims[source] = candidate
+
+	return candidate
+}
+
+/*
+ * Claim the first numbered variant of a path (e.g IMG_01_1.JPG) that no other source owns, and
+ * that `taken` reports free. A nil registry only checks `taken`
+ */
+func (names *NameRegistry) ClaimFree(source string, fpath string, taken func(string) bool) string {
+	if names != nil {
+		names.lock.Lock()
+		defer names.lock.Unlock()
+	}
+
+	ext := path.Ext(fpath)
+	base := strings.TrimSuffix(fpath, ext)
+	candidate := fpath
+
+	for count := 1; ; count++ {
+		candidate = fmt.Sprintf("%s_%d%s", base, count, ext)
+
+		if names != nil {
+			if owner, owned := names.owners[candidate]; owned && owner != source {
+				continue
+			}
+		}
+
+		if !taken(candidate) {
+			break
+		}
+	}
+
+	if names != nil {
+		names.owners[candidate] = source
+		names.claims[source] = candidate
+	}
+
+	return candidate
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestParseNameTemplateRejectsPaths(t *testing.T) {
+	for _, text := range []string{
+		"{{.ClusterLabel}}/{{.OriginalBase}}{{.Ext}}",
+		"../{{.OriginalBase}}{{.Ext}}",
+		"..{{.Ext}}",
+		`{{.ClusterLabel}}\{{.OriginalBase}}{{.Ext}}`,
+		" ",
+	} {
+		if _, err := ParseNameTemplate(text); err == nil {
+			t.Errorf("expected --name-template %q to be rejected", text)
+		}
+	}
+
+	if _, err := ParseNameTemplate("{{.ClusterLabel}}_{{.OriginalBase}}{{.Ext}}"); err != nil {
+		t.Errorf("expected a template naming a file to parse, got %v", err)
+	}
+}
+
+/*
+ * Construct media named by a template into one folder, captured at the given times
+ */
+func NewTestTemplatedMedia(t *testing.T, text string, captured map[string]int) []Media {
+	t.Helper()
+
+	tmpl, err := template.New("name").Parse(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := NewNameRegistry()
+	media := []Media{}
+
+	for source, ctime := range captured {
+		media = append(media, Media{
+			source:       source,
+			dstDir:       "/dst",
+			ctime:        ctime,
+			flatten:      true,
+			nameTemplate: tmpl,
+			names:        names,
+		})
+	}
+
+	return media
+}
+
+/*
+ * Claim templated names for media arriving in some order, returning each source's destination
+ */
+func ClaimTestNames(t *testing.T, media []Media) map[string]string {
+	t.Helper()
+
+	graded := make(chan Either[Media], len(media))
+	for _, entry := range media {
+		graded <- Either[Media]{entry, nil}
+	}
+	close(graded)
+
+	paths := map[string]string{}
+	for pair := range ClaimTemplatedNames(graded) {
+		if pair.Error != nil {
+			t.Fatal(pair.Error)
+		}
+
+		paths[pair.Value.source] = pair.Value.GetDestinationPath()
+	}
+
+	return paths
+}
+
+/*
+ * Colliding names are numbered by capture time, then source, however the media arrive from grading
+ */
+func TestClaimTemplatedNamesInCaptureOrder(t *testing.T) {
+	captured := map[string]int{"/src/c.jpg": 1, "/src/b.jpg": 2, "/src/a.jpg": 2}
+
+	expected := map[string]string{
+		"/src/c.jpg": filepath.Join("/dst", "photo.jpg"),
+		"/src/a.jpg": filepath.Join("/dst", "photo_1.jpg"),
+		"/src/b.jpg": filepath.Join("/dst", "photo_2.jpg"),
+	}
+
+	for attempt := 0; attempt < 5; attempt++ {
+		media := NewTestTemplatedMedia(t, "photo{{.Ext}}", captured)
+
+		// a name claimed before grading, out of order, is given up
+		media[attempt%len(media)].GetDestinationPath()
+
+		for source, fpath := range ClaimTestNames(t, media) {
+			if fpath != expected[source] {
+				t.Errorf("expected %v to be named %v, got %v", source, expected[source], fpath)
+			}
+		}
+	}
+}
+
+/*
+ * Media the template fails to name fail, rather than being copied under a fallback name
+ */
+func TestClaimTemplatedNamesFailsUnnameableMedia(t *testing.T) {
+	media := NewTestTemplatedMedia(t, "{{slice .OriginalBase 0 8}}{{.Ext}}", map[string]int{
+		"/src/IMG_0001.jpg": 1,
+		"/src/IMG_1.jpg":    2,
+	})
+
+	graded := make(chan Either[Media], len(media))
+	for _, entry := range media {
+		graded <- Either[Media]{entry, nil}
+	}
+	close(graded)
+
+	for pair := range ClaimTemplatedNames(graded) {
+		failed := pair.Value.source == "/src/IMG_1.jpg"
+
+		if failed && (pair.Error == nil || !strings.Contains(pair.Error.Error(), "slice")) {
+			t.Errorf("expected %v to fail with the template's error, got %v", pair.Value.source, pair.Error)
+		}
+
+		if !failed && pair.Error != nil {
+			t.Errorf("expected %v to be named, got %v", pair.Value.source, pair.Error)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// What's done with media DBSCAN can't cluster, as they're too far from any others
+type NoisePolicy string
+
+const (
+	// copy them into their own 'unclustered' folder
+	OWN_FOLDER NoisePolicy = "own-folder"
+	// add each to the cluster of the nearest clustered media
+	ASSIGN_NEAREST = "assign-nearest"
+	// don't copy them
+	SKIP_NOISE = "skip"
+)
+
+/*
+ * Parse a --noise policy
+ */
+func ParseNoisePolicy(name string) (NoisePolicy, error) {
+	switch NoisePolicy(name) {
+	case OWN_FOLDER, ASSIGN_NEAREST, SKIP_NOISE:
+		return NoisePolicy(name), nil
+	}
+
+	return "", fmt.Errorf("badger: unsupported --noise policy '%v'; expected assign-nearest, own-folder or skip", name)
+}
+
+/*
+ * Find the cluster of the clustered point nearest to a point, measured in the same space DBSCAN
+ * clustered them in. Returns the noise cluster-id if nothing was clustered
+ */
+func NearestCluster(point []float64, clustered [][]float64, clusterIds []int) int {
+	nearest := NoiseClusterId
+	best := math.Inf(1)
+
+	for idx, other := range clustered {
+		if distance := PointDistance(point, other); distance < best {
+			best = distance
+			nearest = clusterIds[idx]
+		}
+	}
+
+	return nearest
+}
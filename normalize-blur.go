@@ -0,0 +1,134 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+/*
+ * Rank blur-scores as percentiles within a library; 0 is the blurriest score, and 100 the
+ * sharpest. Tied scores share the lower rank
+ */
+func BlurPercentiles(scores []int) map[int]int {
+	sorted := append([]int{}, scores...)
+	sort.Ints(sorted)
+
+	ranks := make(map[int]int)
+
+	for idx, score := range sorted {
+		if _, ok := ranks[score]; ok {
+			continue
+		}
+
+		if len(sorted) == 1 {
+			ranks[score] = 100
+			continue
+		}
+
+		ranks[score] = int(math.Round(100 * float64(idx) / float64(len(sorted)-1)))
+	}
+
+	return ranks
+}
+
+/*
+ * Wait for every media to be graded, then replace each blur-score with its percentile within the
+ * library. Media with a percentile below `minBlur` are skipped, those below `rejectBelow` are set aside,
+ * and thumbnails are written only once blur-scores (and so destination names) are final
+ */
+func NormalizeBlur(procCount int, minBlur float64, rejectBelow float64, thumbnails bool, library *MediaList, graded chan Either[Media]) chan Either[Media] {
+	results := make(chan Either[Media], library.Size())
+
+	go func() {
+		defer close(results)
+
+		pairs := []Either[Media]{}
+		scores := []int{}
+
+		for pair := range graded {
+			pairs = append(pairs, pair)
+
+			if pair.Error == nil && pair.Value.blur >= 0 && library.IsGraded(&pair.Value) {
+				scores = append(scores, pair.Value.blur)
+			}
+		}
+
+		ranks := BlurPercentiles(scores)
+
+		for idx := range pairs {
+			media := &pairs[idx].Value
+			kind := media.GetType()
+
+			// videos aren't graded, and undecodable raw images have no blur
+			if pairs[idx].Error != nil || (kind != PHOTO && kind != RAW) || media.blur < 0 {
+				continue
+			}
+
+			media.blur = ranks[media.blur]
+			if !media.skipped && minBlur > 0 && float64(media.blur) < minBlur {
+				media.skipped = true
+				media.skipReason = BELOW_MIN_BLUR
+			}
+
+			media.rejected = !media.skipped && rejectBelow > 0 && float64(media.blur) < rejectBelow
+		}
+
+		if thumbnails {
+			ThumbnailMedia(procCount, pairs, library)
+		}
+
+		for _, pair := range pairs {
+			results <- pair
+		}
+	}()
+
+	return results
+}
+
+/*
+ * Write thumbnails for graded media with a pool of workers; raw images share their photo's
+ * thumbnail. Failing to thumbnail leaves the thumbnail path empty
+ */
+func ThumbnailMedia(procCount int, pairs []Either[Media], library *MediaList) {
+	jobs := make(chan int, len(pairs))
+	var wg sync.WaitGroup
+
+	for pid := 0; pid < procCount; pid++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for idx := range jobs {
+				media := &pairs[idx].Value
+				media.thumbnail, _ = MakeThumbnail(media)
+			}
+		}()
+	}
+
+	for idx, pair := range pairs {
+		if pair.Error == nil && !pair.Value.skipped && library.IsGraded(&pair.Value) {
+			jobs <- idx
+		}
+	}
+
+	close(jobs)
+	wg.Wait()
+
+	thumbnails := make(map[string]string)
+
+	for _, pair := range pairs {
+		if len(pair.Value.thumbnail) > 0 {
+			thumbnails[pair.Value.GetPrefix()] = pair.Value.thumbnail
+		}
+	}
+
+	for idx := range pairs {
+		media := &pairs[idx].Value
+
+		if len(media.thumbnail) == 0 && !media.skipped && media.GetType() == RAW {
+			media.thumbnail = thumbnails[media.GetPrefix()]
+		}
+	}
+}
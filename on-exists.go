@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// What to do when a media's destination already exists
+type ExistsPolicy string
+
+const (
+	// leave the existing file, and don't copy
+	SKIP_EXISTING ExistsPolicy = "skip"
+	// recopy, replacing the existing file unless its content is identical
+	OVERWRITE = "overwrite"
+	// copy alongside the existing file, with a numeric suffix
+	RENAME = "rename"
+)
+
+/*
+ * Parse an --on-exists policy
+ */
+func ParseExistsPolicy(name string) (ExistsPolicy, error) {
+	switch ExistsPolicy(name) {
+	case SKIP_EXISTING, OVERWRITE, RENAME:
+		return ExistsPolicy(name), nil
+	}
+
+	return "", fmt.Errorf("badger: unsupported --on-exists policy '%v'; expected skip, overwrite or rename", name)
+}
+
+/*
+ * Does the existing destination file have the same content as the media?
+ */
+func (media *Media) SameAsDestination() (bool, error) {
+	hash, err := media.GetHash()
+	if err != nil {
+		return false, err
+	}
+
+	dstHash, err := media.DestinationHash()
+	if err != nil {
+		return false, err
+	}
+
+	return hash == dstHash, nil
+}
+
+/*
+ * Move the media's destination to the first numbered variant of its name that doesn't exist yet,
+ * so the existing file is kept
+ */
+func (media *Media) RenameDestination() {
+	destination := media.GetDestination()
+
+	media.dstPath = media.names.ClaimFree(media.source, media.GetDestinationPath(), func(candidate string) bool {
+		_, err := destination.Stat(candidate)
+		return !errors.Is(err, os.ErrNotExist)
+	})
+}
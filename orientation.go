@@ -0,0 +1,85 @@
+package main
+
+import (
+	"image"
+)
+
+/*
+ * Map a pixel in the upright image back to the stored image, for an EXIF orientation from 1 to 8.
+ * `width` & `height` are the stored image's dimensions
+ */
+func OrientedSource(orientation int, width int, height int, x int, y int) (int, int) {
+	switch orientation {
+	case 2:
+		return width - 1 - x, y
+	case 3:
+		return width - 1 - x, height - 1 - y
+	case 4:
+		return x, height - 1 - y
+	case 5:
+		return y, x
+	case 6:
+		return y, height - 1 - x
+	case 7:
+		return width - 1 - y, height - 1 - x
+	case 8:
+		return width - 1 - y, x
+	}
+
+	return x, y
+}
+
+/*
+ * Rotate & flip a buffer of pixels, each `depth` bytes wide, upright. Returns the pixels and their new dimensions
+ */
+func OrientPixels(pix []uint8, stride int, depth int, width int, height int, orientation int) ([]uint8, int, int) {
+	outWidth, outHeight := width, height
+
+	// orientations five to eight swap the image's width and height
+	if orientation >= 5 && orientation <= 8 {
+		outWidth, outHeight = height, width
+	}
+
+	out := make([]uint8, outWidth*outHeight*depth)
+
+	for y := 0; y < outHeight; y++ {
+		for x := 0; x < outWidth; x++ {
+			sx, sy := OrientedSource(orientation, width, height, x, y)
+
+			src := sy*stride + sx*depth
+			dst := (y*outWidth + x) * depth
+
+			copy(out[dst:dst+depth], pix[src:src+depth])
+		}
+	}
+
+	return out, outWidth, outHeight
+}
+
+/*
+ * Rotate & flip a grayscale image upright, according to its EXIF orientation
+ */
+func OrientGray(img *image.Gray, orientation int) *image.Gray {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	pix, width, height := OrientPixels(img.Pix[img.PixOffset(bounds.Min.X, bounds.Min.Y):], img.Stride, 1, bounds.Dx(), bounds.Dy(), orientation)
+
+	return &image.Gray{Pix: pix, Stride: width, Rect: image.Rect(0, 0, width, height)}
+}
+
+/*
+ * Rotate & flip a colour image upright, according to its EXIF orientation
+ */
+func OrientRGBA(img *image.RGBA, orientation int) *image.RGBA {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	pix, width, height := OrientPixels(img.Pix[img.PixOffset(bounds.Min.X, bounds.Min.Y):], img.Stride, 4, bounds.Dx(), bounds.Dy(), orientation)
+
+	return &image.RGBA{Pix: pix, Stride: width * 4, Rect: image.Rect(0, 0, width, height)}
+}
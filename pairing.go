@@ -0,0 +1,78 @@
+package main
+
+import "fmt"
+
+// How RAW images paired with a photo (e.g IMG_01.RW2 and IMG_01.JPG) are graded and filtered
+type PairingPolicy string
+
+const (
+	// the photo is graded, and its outcome decides whether the whole pair is copied
+	FOLLOW_JPEG PairingPolicy = "follow-jpeg"
+	// each image is graded and filtered on its own
+	INDEPENDENT = "independent"
+)
+
+/*
+ * Parse a --pairing policy
+ */
+func ParsePairingPolicy(name string) (PairingPolicy, error) {
+	switch PairingPolicy(name) {
+	case FOLLOW_JPEG, INDEPENDENT:
+		return PairingPolicy(name), nil
+	}
+
+	return "", fmt.Errorf("badger: unsupported pairing policy '%v'; expected follow-jpeg or independent", name)
+}
+
+/*
+ * Is this media graded itself, rather than sharing a photo's grade? Photos are, as are raw
+ * images without a photo, or all raw images when paired independently
+ */
+func (library *MediaList) IsGraded(media *Media) bool {
+	switch media.GetType() {
+	case PHOTO:
+		return true
+	case RAW:
+		return library.pairing == INDEPENDENT || !library.HasPhotoSibling(media)
+	}
+
+	return false
+}
+
+/*
+ * Get the media graded to decide this media's fate; a raw image following its photo is graded
+ * through the photo, and everything else through itself
+ */
+func (library *MediaList) GradingSource(media *Media) *Media {
+	if media.GetType() != RAW || library.IsGraded(media) {
+		return media
+	}
+
+	for _, sibling := range library.GetByPrefix(media) {
+		if sibling.GetType() == PHOTO {
+			return sibling
+		}
+	}
+
+	return media
+}
+
+/*
+ * Get the media whose fate is decided along with this media; its prefix-siblings when following
+ * the photo, or just the media itself when paired independently
+ */
+func (library *MediaList) GetPaired(media *Media) []*Media {
+	siblings := library.GetByPrefix(media)
+
+	if library.pairing != INDEPENDENT {
+		return siblings
+	}
+
+	for _, sibling := range siblings {
+		if sibling.source == media.source {
+			return []*Media{sibling}
+		}
+	}
+
+	return siblings
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+/*
+ * Write a RAW+JPEG pair, a lone RAW and a lone JPEG; the paired JPEG is blurry. The RAW images can't
+ * be decoded, so can't be graded themselves
+ */
+func NewTestPairedLibrary(t *testing.T, pairing PairingPolicy) (*MediaList, *MediaCluster) {
+	t.Helper()
+	dir := t.TempDir()
+
+	WriteTestImage(t, filepath.Join(dir, "IMG_0001.png"), false, 1)
+	WriteTestFile(t, filepath.Join(dir, "IMG_0001.rw2"), "not really a raw image")
+	WriteTestFile(t, filepath.Join(dir, "IMG_0002.rw2"), "not really a raw image either")
+	WriteTestImage(t, filepath.Join(dir, "IMG_0003.png"), true, 3)
+
+	names := []string{"IMG_0001.png", "IMG_0001.rw2", "IMG_0002.rw2", "IMG_0003.png"}
+	media := make([]*Media, len(names))
+	entries := make([]Media, len(names))
+
+	for idx, name := range names {
+		media[idx] = &Media{
+			source:          filepath.Join(dir, name),
+			id:              idx,
+			hashAlgorithm:   MD5,
+			sharpnessMetric: LAPLACIAN,
+		}
+		entries[idx] = *media[idx]
+	}
+
+	library := NewMediaList(media)
+	library.pairing = pairing
+
+	return library, &MediaCluster{entries: entries}
+}
+
+/*
+ * Grade a library, skipping photos below a blur-score, and report whether each media was skipped
+ */
+func GradeTestLibrary(t *testing.T, library *MediaList, clusters *MediaCluster) map[string]bool {
+	t.Helper()
+
+	conn, err := NewSqliteDB(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := BadgerDb{conn}
+	defer db.db.Close()
+
+	if err := db.CreateTables(); err != nil {
+		t.Fatal(err)
+	}
+
+	skipped := make(map[string]bool)
+
+	for pair := range CalcuateBlur(2, 10, 0, 100, false, &db, library, clusters, nil) {
+		if pair.Error != nil {
+			t.Fatal(pair.Error)
+		}
+
+		if _, seen := skipped[filepath.Base(pair.Value.source)]; seen {
+			t.Errorf("expected %v to be graded once", pair.Value.source)
+		}
+
+		skipped[filepath.Base(pair.Value.source)] = pair.Value.skipped
+	}
+
+	return skipped
+}
+
+func TestFollowJpegPairing(t *testing.T) {
+	library, clusters := NewTestPairedLibrary(t, FOLLOW_JPEG)
+
+	// the RAW is skipped with its blurry JPEG; unpaired media are graded on their own
+	expected := map[string]bool{
+		"IMG_0001.png": true,
+		"IMG_0001.rw2": true,
+		"IMG_0002.rw2": false,
+		"IMG_0003.png": false,
+	}
+
+	for name, skip := range GradeTestLibrary(t, library, clusters) {
+		if skip != expected[name] {
+			t.Errorf("expected %v to be skipped: %v, but was %v", name, expected[name], skip)
+		}
+	}
+
+	if library.IsGraded(library.Values()[1]) {
+		t.Error("expected the paired RAW to follow its JPEG's grade, rather than be graded")
+	}
+
+	if !library.IsGraded(library.Values()[2]) {
+		t.Error("expected the unpaired RAW to be graded")
+	}
+}
+
+func TestIndependentPairing(t *testing.T) {
+	library, clusters := NewTestPairedLibrary(t, INDEPENDENT)
+
+	// the RAW can't be decoded, so is copied as-is, whatever its JPEG's grade
+	expected := map[string]bool{
+		"IMG_0001.png": true,
+		"IMG_0001.rw2": false,
+		"IMG_0002.rw2": false,
+		"IMG_0003.png": false,
+	}
+
+	graded := GradeTestLibrary(t, library, clusters)
+	if len(graded) != len(expected) {
+		t.Errorf("expected %v media to be graded, got %v", len(expected), graded)
+	}
+
+	for name, skip := range graded {
+		if skip != expected[name] {
+			t.Errorf("expected %v to be skipped: %v, but was %v", name, expected[name], skip)
+		}
+	}
+
+	for _, media := range library.Values() {
+		if media.GetType() == RAW && !library.IsGraded(media) {
+			t.Errorf("expected %v to be graded on its own", media.source)
+		}
+	}
+}
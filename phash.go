@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"math/bits"
+	"strconv"
+)
+
+// A difference-hash compares neighbouring cells of a (PerceptualHashSize + 1) x PerceptualHashSize grid
+const PerceptualHashSize = 8
+
+/*
+ * Compute a difference-hash of a grayscale image; average the image down to a 9x8 grid, and set
+ * a bit for each cell brighter than its right-hand neighbour. Re-encoding or resizing an image
+ * barely changes its hash
+ */
+func DifferenceHash(img *image.Gray) uint64 {
+	bounds := img.Bounds()
+	cols := PerceptualHashSize + 1
+	rows := PerceptualHashSize
+
+	sums := make([]float64, cols*rows)
+	counts := make([]float64, cols*rows)
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		row := (y - bounds.Min.Y) * rows / bounds.Dy()
+
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			col := (x - bounds.Min.X) * cols / bounds.Dx()
+
+			sums[row*cols+col] += float64(img.GrayAt(x, y).Y)
+			counts[row*cols+col] += 1
+		}
+	}
+
+	cell := func(row int, col int) float64 {
+		if counts[row*cols+col] == 0 {
+			return 0
+		}
+
+		return sums[row*cols+col] / counts[row*cols+col]
+	}
+
+	var hash uint64
+
+	for row := 0; row < rows; row++ {
+		for col := 0; col < cols-1; col++ {
+			hash <<= 1
+
+			if cell(row, col) > cell(row, col+1) {
+				hash |= 1
+			}
+		}
+	}
+
+	return hash
+}
+
+/*
+ * Format a perceptual hash as fixed-width hex
+ */
+func FormatPerceptualHash(hash uint64) string {
+	return fmt.Sprintf("%016x", hash)
+}
+
+/*
+ * Parse a perceptual hash formatted by FormatPerceptualHash
+ */
+func ParsePerceptualHash(text string) (uint64, error) {
+	return strconv.ParseUint(text, 16, 64)
+}
+
+/*
+ * Count the bits that differ between two perceptual hashes
+ */
+func HammingDistance(first uint64, second uint64) int {
+	return bits.OnesCount64(first ^ second)
+}
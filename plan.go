@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// A media in the --json-plan output
+type PlanMember struct {
+	Source      string    `json:"source"`
+	CaptureTime string    `json:"captureTime"`
+	Type        MediaType `json:"type"`
+	Size        int64     `json:"size"`
+}
+
+// A cluster-folder in the --json-plan output; unclustered media have the noise cluster-id
+type PlanCluster struct {
+	Id      int          `json:"id"`
+	Label   string       `json:"label"`
+	Members []PlanMember `json:"members"`
+}
+
+// The clustering plan, printed by --json-plan instead of copying
+type Plan struct {
+	Facts    *Facts        `json:"facts,omitempty"`
+	Clusters []PlanCluster `json:"clusters"`
+}
+
+/*
+ * Describe each cluster and its members, ordered by cluster-id and then capture time
+ */
+func NewPlan(clusters *MediaCluster, facts *Facts) *Plan {
+	byCluster := make(map[int][]*Media)
+	ids := []int{}
+
+	for idx := range clusters.entries {
+		media := &clusters.entries[idx]
+
+		if _, ok := byCluster[media.clusterId]; !ok {
+			ids = append(ids, media.clusterId)
+		}
+
+		byCluster[media.clusterId] = append(byCluster[media.clusterId], media)
+	}
+
+	sort.Ints(ids)
+
+	plan := &Plan{Facts: facts, Clusters: []PlanCluster{}}
+
+	for _, clusterId := range ids {
+		members := byCluster[clusterId]
+
+		sort.SliceStable(members, func(i, j int) bool {
+			return members[i].GetCreationTime() < members[j].GetCreationTime()
+		})
+
+		cluster := PlanCluster{
+			Id:      clusterId,
+			Label:   members[0].GetClusterLabel(),
+			Members: make([]PlanMember, len(members)),
+		}
+
+		for idx, media := range members {
+			size, _ := media.Size()
+
+			cluster.Members[idx] = PlanMember{
+				Source:      media.source,
+				CaptureTime: time.Unix(int64(media.GetCreationTime()), 0).Format(time.RFC3339),
+				Type:        media.GetType(),
+				Size:        size,
+			}
+		}
+
+		plan.Clusters = append(plan.Clusters, cluster)
+	}
+
+	return plan
+}
+
+/*
+ * Print the clustering plan as an indented JSON document
+ */
+func PrintPlan(clusters *MediaCluster, facts *Facts) error {
+	content, err := json.MarshalIndent(NewPlan(clusters, facts), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(content))
+
+	return nil
+}
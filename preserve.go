@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// Which of a file's attributes are copied onto its destination, with --preserve
+type PreserveAttrs struct {
+	times  bool
+	mode   bool
+	xattrs bool
+}
+
+/*
+ * Parse a --preserve list, like times,mode; times, mode and xattrs can be given, or all or none
+ */
+func ParsePreserve(text string) (PreserveAttrs, error) {
+	attrs := PreserveAttrs{}
+
+	for _, name := range strings.Split(text, ",") {
+		switch strings.TrimSpace(name) {
+		case "times":
+			attrs.times = true
+		case "mode":
+			attrs.mode = true
+		case "xattrs":
+			attrs.xattrs = true
+		case "all":
+			attrs = PreserveAttrs{true, true, true}
+		case "none":
+		default:
+			return attrs, fmt.Errorf("badger: unsupported --preserve '%v'; expected a list of times, mode or xattrs, or all or none", name)
+		}
+	}
+
+	return attrs, nil
+}
+
+/*
+ * Copy a source's preserved attributes onto its copy. Extended attributes are copied first, since a
+ * read-only mode may forbid setting them, and times last, since the other changes could touch them
+ */
+func PreserveAttributes(destination Destination, source string, stat os.FileInfo, fpath string, attrs PreserveAttrs) error {
+	if attrs.xattrs {
+		if err := CopyXattrs(source, fpath); err != nil {
+			return err
+		}
+	}
+
+	if attrs.mode {
+		if err := destination.Chmod(fpath, stat.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+
+	if attrs.times {
+		return destination.Chtimes(fpath, GetAtime(stat), stat.ModTime())
+	}
+
+	return nil
+}
+
+/*
+ * Copy each extended attribute of a local file onto another. Filesystems without extended attributes
+ * have none to copy, or can't hold them; either way, nothing is copied
+ */
+func CopyXattrs(source string, fpath string) error {
+	size, err := unix.Listxattr(source, nil)
+	if errors.Is(err, unix.ENOTSUP) || size == 0 {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	buffer := make([]byte, size)
+	size, err = unix.Listxattr(source, buffer)
+	if err != nil {
+		return err
+	}
+
+	// names are null-terminated
+	for _, name := range strings.Split(strings.TrimRight(string(buffer[:size]), "\x00"), "\x00") {
+		valueSize, err := unix.Getxattr(source, name, nil)
+		if err != nil {
+			return err
+		}
+
+		value := make([]byte, valueSize)
+		if _, err = unix.Getxattr(source, name, value); err != nil {
+			return err
+		}
+
+		err = unix.Setxattr(fpath, name, value, 0)
+		if errors.Is(err, unix.ENOTSUP) {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("badger: failed to copy extended attribute %v onto %v: %w", name, fpath, err)
+		}
+	}
+
+	return nil
+}
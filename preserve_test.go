@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCopyFilePreservesModificationTime(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "IMG_0001.jpg")
+	dst := filepath.Join(t.TempDir(), "IMG_0001.jpg")
+
+	WriteTestFile(t, src, "not really a jpeg")
+
+	mtime := time.Date(2019, time.July, 4, 15, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(src, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	media := Media{source: src, dstPath: dst}
+
+	if err := CopyFile(&media, PreserveAttrs{times: true}, NO_LINK); err != nil {
+		t.Fatal(err)
+	}
+
+	stat, err := os.Stat(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := stat.ModTime().Sub(mtime); diff > time.Second || diff < -time.Second {
+		t.Errorf("expected the copy's mtime to be %v, got %v", mtime, stat.ModTime())
+	}
+}
+
+func TestCopyFileWithoutPreserveUsesCurrentTime(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "IMG_0001.jpg")
+	dst := filepath.Join(t.TempDir(), "IMG_0001.jpg")
+
+	WriteTestFile(t, src, "not really a jpeg")
+
+	mtime := time.Date(2019, time.July, 4, 15, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(src, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	media := Media{source: src, dstPath: dst}
+
+	if err := CopyFile(&media, PreserveAttrs{}, NO_LINK); err != nil {
+		t.Fatal(err)
+	}
+
+	stat, err := os.Stat(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stat.ModTime().Equal(mtime) {
+		t.Error("expected the copy's mtime not to be preserved")
+	}
+}
@@ -3,159 +3,350 @@ package main
 import (
 	"errors"
 	"fmt"
+	_ "github.com/mattn/go-sqlite3"
 	"io"
 	"os"
 	"path/filepath"
-	_ "github.com/mattn/go-sqlite3"
+	"sync"
+	"sync/atomic"
 )
 
+// Returned once a run has copied what it could, when some media failed to copy even after retrying
+var ErrCopyFailures = errors.New("some media couldn't be copied")
+
 /*
- * Make directories for each cluster
+ * Make each cluster folder, or just the root folder when flattening
  */
-func (clust *MediaCluster) MakeClusterDirs(dst string) error {
-	for idx := range clust.entries {
-		cluster_dir := filepath.Join(dst, fmt.Sprint(idx))
-		err := os.MkdirAll(cluster_dir, os.ModePerm)
+func MakeFolders(destination Destination, to string, clusters *MediaCluster, flatten bool) error {
+	if flatten {
+		return destination.MkdirAll(to)
+	}
+
+	for idx := 0; idx < clusters.clusters; idx++ {
+		cluster_dir := filepath.Join(to, clusters.GetLabel(idx))
+		err := destination.MkdirAll(cluster_dir)
 
 		if err != nil {
 			return err
 		}
 	}
 
+	if clusters.NoiseSize() > 0 {
+		return destination.MkdirAll(filepath.Join(to, UnclusteredLabel))
+	}
+
 	return nil
 }
 
 /*
- * Make each cluster folder
+ * Copy a single media item to its destination, removing any partially-written copy on failure.
+ * In a link mode, link to the source rather than copying it
  */
-func MakeFolders(to string, clusters int) error {
-	for idx := 0; idx < clusters; idx++ {
-		cluster_dir := filepath.Join(to, fmt.Sprint(idx))
-		err := os.MkdirAll(cluster_dir, os.ModePerm)
+func CopyFile(media *Media, preserve PreserveAttrs, link LinkMode) error {
+	destination := media.GetDestination()
+
+	// does the file exist?
+	sourceFileStat, err := os.Stat(media.source)
+	if err != nil {
+		return err
+	}
+
+	// is it a plain old file?
+	if !sourceFileStat.Mode().IsRegular() {
+		return fmt.Errorf("%v: %w", media.source, ErrNotRegularFile)
+	}
 
+	// link to the absolute source path, so the link works wherever it's read from
+	if link == SYMLINK {
+		target, err := filepath.Abs(media.source)
 		if err != nil {
 			return err
 		}
+
+		linkPath := media.GetDestinationPath()
+
+		err = destination.Symlink(target, linkPath)
+		if err != nil {
+			return err
+		}
+
+		media.linked = true
+		return CopySidecars(media, linkPath, link)
 	}
 
-	return nil
+	if link == HARD_LINK || link == REFLINK {
+		linkPath := media.GetDestinationPath()
+
+		err = LinkFile(link, media.source, linkPath)
+		if err != nil {
+			return err
+		}
+
+		// hard links share their source's attributes, but reflinks are new files
+		if link == REFLINK {
+			err = PreserveAttributes(destination, media.source, sourceFileStat, linkPath, preserve)
+			if err != nil {
+				return err
+			}
+		}
+
+		media.linked = true
+		return CopySidecars(media, linkPath, link)
+	}
+
+	// open the media source
+	source, err := os.Open(media.source)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	// blur will be present in pipeline
+	blurPath := media.GetDestinationPath()
+
+	dest, err := destination.Create(blurPath)
+	if err != nil {
+		return err
+	}
+
+	// does not exist' copy from source to destination file
+	_, err = io.Copy(dest, source)
+	if err != nil {
+		dest.Close()
+		destination.Remove(blurPath)
+		return err
+	}
+
+	// copied; close the destination file
+	err = dest.Close()
+	if err != nil {
+		destination.Remove(blurPath)
+		return err
+	}
+
+	// stamp the destination with the source's times, permissions and extended attributes, as chosen
+	err = PreserveAttributes(destination, media.source, sourceFileStat, blurPath, preserve)
+	if err != nil {
+		return err
+	}
+
+	// bring along any develop-settings
+	return CopySidecars(media, blurPath, NO_LINK)
 }
 
 /*
- * Copy files and emit error|media sumtypes to the output channel
+ * Copy files, retrying transient failures, and emit error|media sumtypes to the output channel. Once the
+ * destination runs out of space, the remaining jobs are drained without being copied. Between
+ * `workers.min` and `workers.max` files are copied at once, tuned to the destination's throughput.
+ * Media an `imported` check accepts (e.g those recorded by an earlier run) aren't copied again
  */
-func CopyFiles(procCount int, db *BadgerDb, copyChan chan Either[Media]) chan Either[Media] {
-	results := make(chan Either[Media], procCount)
+func CopyFiles(workers WorkerBounds, preserve PreserveAttrs, link LinkMode, move bool, verify bool, onExists ExistsPolicy, retries int, imported func(media *Media) (bool, error), content *ContentIndex, db *BadgerDb, log *EventLog, space *SpaceMonitor, copyChan chan Either[Media]) chan Either[Media] {
+	results := make(chan Either[Media], workers.max)
+	var wg sync.WaitGroup
+	var outOfSpace int32
 
-	// start several goroutines that write to results
-	for pid := 0; pid < procCount; pid++ {
-		go func() {
-			// enumerate over copy-chan; first to grab will win
-			for pair := range copyChan {
-				media := pair.Value
-				err := pair.Error
+	limiter := NewWorkerLimiter(workers)
 
-				// pipeline any existing errors
-				if err != nil {
-					results <- Either[Media]{media, err}
-					continue
-				}
+	// copy a single media, reporting whether there's a result to emit
+	copyMedia := func(pair Either[Media]) (Either[Media], bool) {
+		media := pair.Value
+		err := pair.Error
 
-				exists, err := media.DestinationExists()
-				if exists {
-					media.copied = true
-					results <- Either[Media]{media, nil}
-					continue
-				}
+		// stop copying once the destination is full
+		if atomic.LoadInt32(&outOfSpace) == 1 {
+			return pair, false
+		}
 
-				err = media.LoadInformation()
-				if err != nil {
-					results <- Either[Media]{media, err}
-					continue
-				}
+		// pipeline any existing errors
+		if err != nil {
+			return Either[Media]{media, err}, true
+		}
 
-				// does the file exist?
-				sourceFileStat, err := os.Stat(media.source)
-				if err != nil {
-					results <- Either[Media]{media, err}
-					continue
+		// skipped media is recorded, but not copied
+		if media.skipped {
+			log.Skipped("copy", &media, media.skipReason)
+			space.Done(&media)
+			return Either[Media]{media, nil}, true
+		}
+
+		err = media.LoadInformation()
+		if err != nil {
+			log.Failed("copy", &media, err)
+			return Either[Media]{media, err}, true
+		}
+
+		if imported != nil {
+			found, err := imported(&media)
+			if err != nil {
+				log.Failed("copy", &media, err)
+				return Either[Media]{media, err}, true
+			}
+
+			if found {
+				media.skipped = true
+				media.skipReason = ALREADY_IMPORTED
+				log.Skipped("copy", &media, ALREADY_IMPORTED)
+				space.Done(&media)
+				return Either[Media]{media, nil}, true
+			}
+		}
+
+		// the same content may already be copied under another name, by an earlier run or this one
+		claimed := ""
+		if content != nil {
+			existing, err := content.Claim(&media)
+			if err != nil {
+				log.Failed("copy", &media, err)
+				return Either[Media]{media, err}, true
+			}
+
+			// an earlier run wrote this destination, so this run doesn't claim it
+			if existing == media.GetDestinationPath() {
+				media.skipped = true
+				media.skipReason = ALREADY_EXISTS
+				log.Skipped("copy", &media, ALREADY_EXISTS)
+				space.Done(&media)
+				return Either[Media]{media, nil}, true
+			}
+
+			if len(existing) > 0 {
+				media.skipped = true
+				media.skipReason = SAME_CONTENT
+				log.Skipped("copy", &media, SAME_CONTENT)
+				space.Done(&media)
+				return Either[Media]{media, nil}, true
+			}
+
+			claimed = media.GetDestinationPath()
+		}
+
+		exists, _ := media.DestinationExists()
+		if exists && onExists == RENAME {
+			media.RenameDestination()
+		} else if exists {
+			// overwrite only when the content differs; an unreadable destination is overwritten too
+			same := onExists == SKIP_EXISTING
+			if !same {
+				same, _ = media.SameAsDestination()
+			}
+
+			// the existing file wasn't written by this run, so undoing the run mustn't remove it
+			if same {
+				media.skipped = true
+				media.skipReason = ALREADY_EXISTS
+				log.Skipped("copy", &media, ALREADY_EXISTS)
+				space.Done(&media)
+				return Either[Media]{media, nil}, true
+			}
+
+			// links can't be created over an existing file
+			if link != NO_LINK {
+				media.GetDestination().Remove(media.GetDestinationPath())
+			}
+		}
+
+		log.Started(&media)
+
+		attempts := 0
+		err = space.Check()
+
+		// reject-folders are only made for clusters with rejects
+		if err == nil && media.rejected {
+			err = media.GetDestination().MkdirAll(filepath.Dir(media.GetDestinationPath()))
+		}
+
+		if err == nil {
+			attempts, err = Retry(retries, func() error {
+				if move {
+					return MoveFile(&media, preserve)
 				}
 
-				// is it a plain old file?
-				if !sourceFileStat.Mode().IsRegular() {
-					err := errors.New(media.source + " is not a regular file")
-					results <- Either[Media]{media, err}
-					continue
+				if err := CopyFile(&media, preserve, link); err != nil {
+					return err
 				}
 
-				// open the media source
-				source, err := os.Open(media.source)
-				if err != nil {
-					results <- Either[Media]{media, err}
-					return
+				// links share the source's content, so only copies are re-read
+				if verify && link == NO_LINK {
+					return media.VerifyCopy()
 				}
 
-				// blur will be present in pipeline
-				blurPath := media.GetDestinationPath()
+				return nil
+			})
+		}
 
-				dest, err := os.Create(blurPath)
+		if IsOutOfSpace(err) {
+			atomic.StoreInt32(&outOfSpace, 1)
+		}
 
-				if err != nil {
-					results <- Either[Media]{media, err}
-				}
+		if err != nil {
+			if len(claimed) > 0 {
+				content.Release(media.hash, claimed)
+			}
 
-				// does not exist' copy from source to destination file
-				_, err = io.Copy(dest, source)
+			err = fmt.Errorf("badger: failed to copy %v after %v attempt(s): %w", media.source, attempts, err)
+			log.Failed("copy", &media, err)
+			return Either[Media]{media, err}, true
+		}
 
-				if err != nil {
-					results <- Either[Media]{media, err}
-					continue
-				}
+		if attempts > 1 {
+			log.Retried(&media, attempts)
+		}
 
-				// copied; close the source
-				err = source.Close()
+		media.copied = true
+		log.Copied(&media)
+		space.Done(&media)
+		limiter.Copied(media.size)
 
-				if err != nil {
-					results <- Either[Media]{media, err}
-					continue
-				}
+		return Either[Media]{media, nil}, true
+	}
 
-				// copied; close the destination file
-				err = dest.Close()
+	// start the most goroutines that might be needed; the limiter decides how many copy at once
+	for pid := 0; pid < workers.max; pid++ {
+		wg.Add(1)
 
-				if err != nil {
-					results <- Either[Media]{media, err}
-					continue
-				}
+		go func() {
+			defer wg.Done()
 
-				media.copied = true
+			// enumerate over copy-chan; first to grab will win
+			for pair := range copyChan {
+				limiter.Acquire()
+				result, ok := copyMedia(pair)
+				limiter.Release()
 
-        err = db.InsertMedia(&media)
-				if err != nil {
-					results <- Either[Media]{media, err}
-					continue
+				if ok {
+					results <- result
 				}
-
-				results <- Either[Media]{media, nil}
 			}
 		}()
 	}
 
+	// close results once every worker has drained copy-chan
+	go func() {
+		wg.Wait()
+		limiter.Stop()
+		close(results)
+	}()
+
 	return results
 }
 
 /*
  * Calculate the blur for each image, and start copy-jobs afterwards
  */
-func CalcuateBlur(procCount int, db *BadgerDb, library *MediaList, clusters *MediaCluster) chan Either[Media] {
+func CalcuateBlur(procCount int, minBlur float64, rejectBelow float64, maxClipped float64, thumbnails bool, db *BadgerDb, library *MediaList, clusters *MediaCluster, log *EventLog) chan Either[Media] {
 	results := make(chan Either[Media], len(clusters.entries))
+	var wg sync.WaitGroup
 
 	// a local channel, to distibute media input over
 	mediaChan := make(chan Media, len(clusters.entries))
 	defer close(mediaChan)
 
 	for pid := 0; pid < procCount; pid++ {
+		wg.Add(1)
+
 		go func(pid int) {
+			defer wg.Done()
+
 			for media := range mediaChan {
 				mediaType := media.GetType()
 
@@ -165,39 +356,124 @@ func CalcuateBlur(procCount int, db *BadgerDb, library *MediaList, clusters *Med
 					continue
 				}
 
-				// assume all raw files have a corresponding jpeg
-				// for the moment, so skip non-photos
-
-				if mediaType != PHOTO {
+				// raw files with a corresponding jpeg are graded and copied alongside it,
+				// so only grade raw files directly when they stand alone (or are paired independently)
+				if !library.IsGraded(&media) {
 					continue
 				}
 
-        row, err := db.GetMedia(&media)
+				// a dry-run grades without a database
+				row := &GetMediaRow{}
+				var err error
+
+				if db != nil {
+					row, err = db.GetMedia(&media)
+				}
+
 				if err != nil {
+					log.Failed("grade", &media, err)
 					results <- Either[Media]{media, err}
 					continue
 				}
 
-        blur := row.blur
+				blur := row.blur
+
+				// bursts, duplicates or faces may have already graded the photo this run; the stored
+				// grade mustn't blank out what they found
+				if len(row.phash) > 0 && !media.graded {
+					media.phash = row.phash
+				}
+
+				if row.exposure != nil && !media.graded {
+					media.exposure = row.exposure
+				}
+
+				// skip grading if the blur, perceptual hash and exposure are already stored, and the blur
+				// was scored by the same metric at the same resolution
+				regrade := row.metric != media.GetSharpnessMetric() || row.gradeEdge != media.gradeMaxEdge
+				stale := row.blur <= 0 || len(row.phash) == 0 || row.exposure == nil || regrade
+
+				if media.graded {
+					blur = media.rawBlur
+					stale = false
+				}
+
+				// the same photo may have been graded from another path, like a card mounted elsewhere
+				if stale && db != nil {
+					if cached, ok, err := db.GetCachedGrade(&media); err == nil && ok {
+						blur = cached.blur
+						media.phash = cached.phash
+						media.exposure = cached.exposure
+						stale = false
+					}
+				}
+
+				if stale {
+					tmp, err := media.Grade()
+
+					// copy raw files we can't decode as-is, without a blur-value
+					if err != nil && mediaType == RAW {
+						tmp, err = -1, nil
+					}
 
-				// skip blur calculation if it's already stored
-				if row.blur <= 0 {
-					tmp, err := media.GetBlur()
 					blur = int(tmp)
 
 					if err != nil {
+						log.Failed("grade", &media, err)
 						results <- Either[Media]{media, err}
 						continue
 					}
 				}
 
 				media.blur = int(blur)
+				media.rawBlur = int(blur)
+				log.Graded(&media)
 
-				// look up files with the same prefix, copy blur and prefix
-				for _, shared := range library.GetByPrefix(&media) {
+				// images below the sharpness cutoff, or discarded burst frames, are recorded but not copied
+				skipped := media.skipped
+				skipReason := media.skipReason
+
+				if !skipped && minBlur > 0 && blur >= 0 && float64(blur) < minBlur {
+					skipped = true
+					skipReason = BELOW_MIN_BLUR
+				}
+
+				if !skipped && maxClipped < 100 && media.exposure != nil && media.exposure.Exceeds(maxClipped) {
+					skipped = true
+					skipReason = BADLY_EXPOSED
+				}
+
+				// soft images above the cutoff are still copied, but set aside with --reject-below
+				rejected := !skipped && rejectBelow > 0 && blur >= 0 && float64(blur) < rejectBelow
+				media.rejected = rejected
+
+				// preview images that will be copied; failing to thumbnail shouldn't fail the copy
+				thumbnail := ""
+				if thumbnails && !skipped {
+					thumbnail, _ = MakeThumbnail(&media)
+				}
+
+				// look up files paired with this one, copy blur and prefix
+				for _, shared := range library.GetPaired(&media) {
 					shared.id = media.id
 					shared.clusterId = media.clusterId
+					shared.clusterLabel = media.clusterLabel
 					shared.blur = int(blur)
+					shared.rawBlur = int(blur)
+					shared.skipped = skipped
+					shared.skipReason = skipReason
+					shared.rejected = rejected
+					shared.thumbnail = thumbnail
+					shared.duplicateGroup = media.duplicateGroup
+					shared.faces = media.faces
+					shared.exposure = media.exposure
+					shared.facesCounted = media.facesCounted
+
+					// siblings are the same shot, so only the graded image is hashed
+					if shared.source == media.source {
+						shared.phash = media.phash
+						shared.hash = media.hash
+					}
 
 					results <- Either[Media]{*shared, nil}
 				}
@@ -210,26 +486,248 @@ func CalcuateBlur(procCount int, db *BadgerDb, library *MediaList, clusters *Med
 		mediaChan <- media
 	}
 
+	// close results once every worker has drained media-chan
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	return results
+}
+
+/*
+ * Send each media on to be copied as-is, without grading it
+ */
+func Ungraded(clusters *MediaCluster) chan Either[Media] {
+	results := make(chan Either[Media], len(clusters.entries))
+
+	for _, media := range clusters.entries {
+		results <- Either[Media]{media, nil}
+	}
+
+	close(results)
+
 	return results
 }
 
+/*
+ * Keep only the sharpest photo in each burst; the other frames are marked as skipped
+ */
+func DedupBursts(procCount int, window float64, clusters *MediaCluster) error {
+	bursts := clusters.GetBursts(window)
+
+	jobs := make(chan int, len(clusters.entries))
+	errs := make(chan error, len(clusters.entries))
+	var wg sync.WaitGroup
+
+	// score every frame of a multi-frame burst; the blur is memoised for later
+	for pid := 0; pid < procCount; pid++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for idx := range jobs {
+				media := &clusters.entries[idx]
+
+				blur, err := media.GetBlur()
+				if err != nil {
+					errs <- err
+					continue
+				}
+
+				media.blur = int(blur)
+			}
+		}()
+	}
+
+	for _, burst := range bursts {
+		// a burst of one is always kept as-is
+		if len(burst) < 2 {
+			continue
+		}
+
+		for _, idx := range burst {
+			jobs <- idx
+		}
+	}
+
+	close(jobs)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		return err
+	}
+
+	for _, burst := range bursts {
+		if len(burst) < 2 {
+			continue
+		}
+
+		sharpest := burst[0]
+		for _, idx := range burst[1:] {
+			if clusters.entries[idx].blur > clusters.entries[sharpest].blur {
+				sharpest = idx
+			}
+		}
+
+		for _, idx := range burst {
+			if idx != sharpest {
+				clusters.entries[idx].skipped = true
+				clusters.entries[idx].skipReason = BURST_DUPLICATE
+			}
+		}
+	}
+
+	return nil
+}
+
+/*
+ * Number groups of near-duplicate photos within each cluster, by their perceptual hashes, so
+ * they're named with a shared prefix. Photos in no group are left unnumbered
+ */
+func GroupDuplicates(procCount int, distance int, clusters *MediaCluster) error {
+	byCluster := clusters.GetPhotosByCluster()
+
+	jobs := make(chan int, len(clusters.entries))
+	errs := make(chan error, len(clusters.entries))
+	var wg sync.WaitGroup
+
+	// hash every photo; the blur is computed alongside, and memoised for later
+	for pid := 0; pid < procCount; pid++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for idx := range jobs {
+				media := &clusters.entries[idx]
+
+				blur, err := media.Grade()
+				if err != nil {
+					errs <- err
+					continue
+				}
+
+				media.blur = int(blur)
+			}
+		}()
+	}
+
+	for _, indices := range byCluster {
+		for _, idx := range indices {
+			jobs <- idx
+		}
+	}
+
+	close(jobs)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		return err
+	}
+
+	for _, indices := range byCluster {
+		hashes := make([]uint64, len(indices))
+
+		for idx, entry := range indices {
+			hash, err := ParsePerceptualHash(clusters.entries[entry].phash)
+			if err != nil {
+				return err
+			}
+
+			hashes[idx] = hash
+		}
+
+		for group, members := range GroupNearDuplicates(hashes, distance) {
+			for _, member := range members {
+				clusters.entries[indices[member]].duplicateGroup = group + 1
+			}
+		}
+	}
+
+	return nil
+}
+
+/*
+ * Count the faces in each photo, so portraits can be named or filtered. Photos with fewer than
+ * `minFaces` faces are recorded but not copied
+ */
+func DetectFaces(procCount int, minFaces int, clusters *MediaCluster) error {
+	byCluster := clusters.GetPhotosByCluster()
+
+	jobs := make(chan int, len(clusters.entries))
+	errs := make(chan error, len(clusters.entries))
+	var wg sync.WaitGroup
+
+	for pid := 0; pid < procCount; pid++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for idx := range jobs {
+				media := &clusters.entries[idx]
+
+				faces, err := media.CountFaces()
+				if err != nil {
+					errs <- err
+					continue
+				}
+
+				media.faces = faces
+				media.facesCounted = true
+
+				if !media.skipped && faces < minFaces {
+					media.skipped = true
+					media.skipReason = TOO_FEW_FACES
+				}
+			}
+		}()
+	}
+
+	for _, indices := range byCluster {
+		for _, idx := range indices {
+			jobs <- idx
+		}
+	}
+
+	close(jobs)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		return err
+	}
+
+	return nil
+}
+
 /*
  * Compute blur, and copy files across
  */
 func ProcessLibrary(opts *BadgerOpts, clusters *MediaCluster, facts *Facts, library *MediaList) error {
 	// construct folders for each cluster, and the root folder
-	err := MakeFolders(opts.to, clusters.clusters)
+	err := MakeFolders(opts.destination, opts.dstDir, clusters, opts.flatten)
+	if err != nil {
+		return err
+	}
+
+	// remote destinations keep their database locally, in a folder that may not exist yet
+	err = os.MkdirAll(opts.dbDir, os.ModePerm)
 	if err != nil {
 		return err
 	}
 
-	conn, err := NewSqliteDB(opts)
+	conn, err := NewSqliteDB(opts.dbDir)
 
 	if err != nil {
 		return err
 	}
 
-  db := BadgerDb{conn}
+	db := BadgerDb{conn}
 	defer db.db.Close()
 	err = db.CreateTables()
 
@@ -237,14 +735,74 @@ func ProcessLibrary(opts *BadgerOpts, clusters *MediaCluster, facts *Facts, libr
 		return err
 	}
 
-	bar := NewProgressBar(int64(facts.Size), facts)
+	err = db.InsertRun(opts.runId, SourceGlobs(opts.from, opts.fromDirs), opts.to, opts.args)
+
+	if err != nil {
+		return err
+	}
+
+	if opts.dedupBursts {
+		err = DedupBursts(opts.blurWorkers, opts.burstWindow, clusters)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.groupDuplicates {
+		err = GroupDuplicates(opts.blurWorkers, opts.duplicateDistance, clusters)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.countFaces {
+		err = DetectFaces(opts.blurWorkers, opts.minFaces, clusters)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	var bar ProgressReporter
+
+	if opts.tui {
+		tui := NewTUI(facts)
+		tui.Start()
+
+		bar = tui
+	} else {
+		bar = NewProgressBar(facts, opts.quiet, opts.json)
+	}
+
+	// restore the terminal, even if copying fails
+	defer bar.Done()
+
+	opts.progress.Start(facts)
 
 	copyJobs := make(chan Either[Media], len(clusters.entries))
 
 	// iterate over media, and either write directly to copyjobs (video, etc) or calculate blur and then
 	// write to blur-jobs. Start this before starting copy-job so it's set up to receive
+	var graded chan Either[Media]
+
+	// normalised blur-scores, and so names and blur-cutoffs, are only known once everything is graded
+	if opts.copyOnly {
+		graded = Ungraded(clusters)
+	} else if opts.normalizeBlur {
+		raw := CalcuateBlur(opts.blurWorkers, 0, 0, opts.maxClipped, false, &db, library, clusters, opts.log)
+		graded = NormalizeBlur(opts.blurWorkers, opts.minBlur, opts.rejectBelow, opts.thumbnails, library, raw)
+	} else {
+		graded = CalcuateBlur(opts.blurWorkers, opts.minBlur, opts.rejectBelow, opts.maxClipped, opts.thumbnails, &db, library, clusters, opts.log)
+	}
+
+	if opts.nameTemplate != nil {
+		graded = ClaimTemplatedNames(graded)
+	}
+
 	go func() {
-		for blurRes := range CalcuateBlur(opts.blurWorkers, &db, library, clusters) {
+		for blurRes := range graded {
 			copyJobs <- blurRes
 		}
 
@@ -252,23 +810,179 @@ func ProcessLibrary(opts *BadgerOpts, clusters *MediaCluster, facts *Facts, libr
 		close(copyJobs)
 	}()
 
-	// range over copied file results
-	for copyRes := range CopyFiles(opts.copyWorkers, &db, copyJobs) {
-		err := copyRes.Error
-		media := copyRes.Value
+	skippedCount := 0
+	copiedCount := 0
+	importedCount := 0
+	skipReasons := map[SkipReason]int{}
+	rejectedCount := 0
+	thumbnailFailures := 0
+
+	// a file that can't be copied doesn't stop the run; its failure is reported at the end
+	failures := []string{}
 
+	// a full destination stops the run, but media copied before then are still recorded
+	var spaceErr error
+	space := NewSpaceMonitor(opts.destination, opts.dstDir, int64(facts.Size))
+
+	// links take up next to no space
+	if opts.link != NO_LINK {
+		space = nil
+	}
+
+	// media already copied are still recorded if the run stops early
+	writer := db.StartMediaWriter(MediaBatchSize, opts.log)
+	defer writer.Close()
+
+	// range over copied file results; each media is recorded exactly once, here, after its
+	// blur and copy-state are settled
+	// copy with a fixed number of workers, unless asked to adapt to the destination
+	copyWorkers := WorkerBounds{opts.copyWorkers, opts.copyWorkers}
+	if opts.adaptiveWorkers {
+		copyWorkers = WorkerBounds{opts.minCopyWorkers, opts.maxCopyWorkers}
+	}
+
+	// a resumed run trusts only copies whose content still matches what was recorded
+	var imported func(media *Media) (bool, error)
+	if opts.resume {
+		imported = db.WasCopied
+	} else if opts.incremental {
+		imported = db.WasImported
+	}
+
+	var content *ContentIndex
+	if opts.skipSameContent {
+		content, err = NewContentIndex(&db, opts.destination, opts.dstDir, opts.scanTo)
 		if err != nil {
 			return err
+		}
+	}
+
+	for copyRes := range CopyFiles(copyWorkers, opts.preserve, opts.link, opts.move, opts.verify, opts.onExists, opts.retries, imported, content, &db, opts.log, space, copyJobs) {
+		err := copyRes.Error
+		media := copyRes.Value
+
+		// stop once media can't be recorded
+		if writeErr := writer.Err(); writeErr != nil {
+			return writeErr
+		}
+
+		if IsOutOfSpace(err) {
+			if spaceErr == nil {
+				spaceErr = err
+			}
+		} else if err != nil {
+			failures = append(failures, err.Error())
+		} else if media.skipReason == ALREADY_IMPORTED {
+			// keep the earlier run's record of where this media was copied
+			importedCount += 1
+		} else if media.skipReason == ALREADY_EXISTS {
+			skippedCount += 1
+			skipReasons[ALREADY_EXISTS] += 1
+
+			// likewise keep an earlier run's record; otherwise note the media was skipped
+			_, recorded, err := db.GetMediaBySource(media.source, opts.runId)
+			if err != nil {
+				return err
+			}
+
+			if !recorded {
+				writer.Write(&media)
+			}
+		} else if media.skipped {
+			skippedCount += 1
+			skipReasons[media.skipReason] += 1
+
+			writer.Write(&media)
 		} else if !media.copied {
-			panic("bailed!")
+			err := fmt.Errorf("badger: %v was neither copied nor skipped", media.source)
+			opts.log.Failed("record", &media, err)
+			return err
 		} else {
 			bar.Update(&media)
+			opts.progress.Update(&media)
+			copiedCount += 1
 
-			if err := db.InsertMedia(&media); err != nil {
-				return err
+			if media.rejected {
+				rejectedCount += 1
 			}
+
+			kind := media.GetType()
+			if opts.thumbnails && (kind == PHOTO || kind == RAW) && len(media.thumbnail) == 0 {
+				thumbnailFailures += 1
+			}
+
+			writer.Write(&media)
 		}
 	}
 
-	return nil
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	// so later runs into any destination know where these media are
+	if err := RecordArchive(&db, opts.runId, opts.to); err != nil {
+		return err
+	}
+
+	bar.Done()
+
+	if spaceErr != nil {
+		return fmt.Errorf("badger: the destination ran out of space after copying %v files; free up space and re-run badger to copy the rest: %w", copiedCount, spaceErr)
+	}
+
+	summary := RunSummary{
+		RunId:             opts.runId,
+		Copied:            copiedCount,
+		Skipped:           skippedCount,
+		SkipReasons:       skipReasons,
+		Imported:          importedCount,
+		ThumbnailFailures: thumbnailFailures,
+		Failed:            len(failures),
+		Failures:          failures,
+	}
+
+	opts.progress.Write(SUMMARY_LINE, summary)
+
+	var failed error
+	if len(failures) > 0 {
+		failed = fmt.Errorf("badger: failed to copy %v media; re-run badger to retry them: %w", len(failures), ErrCopyFailures)
+	}
+
+	if opts.json {
+		if err := PrintJsonLine(SUMMARY_LINE, summary); err != nil {
+			return err
+		}
+
+		return failed
+	}
+
+	for _, skip := range SkipDescriptions {
+		if count := skipReasons[skip.reason]; count > 0 {
+			fmt.Printf("badger: skipped %v %v\n", count, skip.description)
+		}
+	}
+
+	if opts.resume {
+		fmt.Printf("badger: skipped %v media already copied before the run was interrupted\n", importedCount)
+	} else if opts.incremental {
+		fmt.Printf("badger: skipped %v media imported by earlier runs\n", importedCount)
+	}
+
+	if opts.rejectBelow > 0 {
+		fmt.Printf("badger: set aside %v blurry photos in %v\n", rejectedCount, filepath.Join(opts.to, RejectsLabel))
+	}
+
+	if thumbnailFailures > 0 {
+		fmt.Printf("badger: failed to create %v thumbnails\n", thumbnailFailures)
+	}
+
+	if !opts.quiet {
+		fmt.Printf("badger: recorded this run as %v; undo it with 'badger undo --db=%v --run %v'\n", opts.runId, opts.dbDir, opts.runId)
+	}
+
+	for _, failure := range failures {
+		fmt.Println(failure)
+	}
+
+	return failed
 }
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+/*
+ * Each copied media is recorded exactly once, however often the library is copied again
+ */
+func TestProcessLibraryRecordsMediaOnce(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+
+	count := 5
+	for idx := 0; idx < count; idx++ {
+		WriteTestImage(t, filepath.Join(src, fmt.Sprintf("IMG_%04d.png", idx)), true, idx)
+	}
+
+	for _, onExists := range []ExistsPolicy{SKIP_EXISTING, SKIP_EXISTING, OVERWRITE, RENAME} {
+		opts := NewTestCopyOpts(t, []string{filepath.Join(src, "*.png")}, dst)
+		opts.onExists = onExists
+
+		if code := Copy(opts, MediaFilter{kind: "all"}); code != 0 {
+			t.Fatalf("expected copying with --on-exists %v to succeed, got exit code %v", onExists, code)
+		}
+
+		db := OpenTestDb(t, dst)
+
+		if rows := CountMediaRows(t, db, "1 = 1"); rows != count {
+			t.Errorf("expected %v rows after copying with --on-exists %v, got %v", count, onExists, rows)
+		}
+
+		db.Close()
+	}
+}
+
+/*
+ * The summary counts skipped media by why they were skipped
+ */
+func TestProcessLibrarySummarisesSkipReasons(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+
+	for idx := 0; idx < 3; idx++ {
+		WriteTestImage(t, filepath.Join(src, fmt.Sprintf("IMG_%04d.png", idx)), true, idx)
+	}
+
+	copyLibrary := func() string {
+		opts := NewTestCopyOpts(t, []string{filepath.Join(src, "*.png")}, dst)
+		opts.skipSameContent = true
+
+		return CaptureStdout(t, func() {
+			if code := Copy(opts, MediaFilter{kind: "all"}); code != 0 {
+				t.Fatalf("expected copying to succeed, got exit code %v", code)
+			}
+		})
+	}
+
+	if first := copyLibrary(); strings.Contains(first, "badger: skipped") {
+		t.Errorf("expected nothing to be skipped, got:\n%v", first)
+	}
+
+	// a renamed copy of a photo already copied
+	WriteTestImage(t, filepath.Join(src, "IMG_0009.png"), true, 0)
+
+	second := copyLibrary()
+
+	for _, line := range []string{
+		"badger: skipped 3 media already in the destination\n",
+		"badger: skipped 1 media whose content was already copied\n",
+	} {
+		if !strings.Contains(second, line) {
+			t.Errorf("expected the summary to include %q, got:\n%v", line, second)
+		}
+	}
+}
+
+/*
+ * Photos graded to find duplicates and faces aren't decoded again to grade their blur, and a
+ * stored row without a perceptual hash doesn't blank out the one they computed
+ */
+func TestGradingDecodesPhotosOnce(t *testing.T) {
+	src := t.TempDir()
+	db := NewTestRunDb(t, t.TempDir(), "", "")
+
+	names := []string{"IMG_0001.png", "IMG_0002.png"}
+	media := make([]*Media, len(names))
+	entries := make([]Media, len(names))
+
+	for idx, name := range names {
+		fpath := filepath.Join(src, name)
+		WriteTestImage(t, fpath, idx == 0, idx)
+		InsertTestRow(t, db, fpath, "", fmt.Sprint(idx))
+
+		media[idx] = &Media{
+			source:          fpath,
+			id:              idx,
+			hashAlgorithm:   MD5,
+			sharpnessMetric: LAPLACIAN,
+			countFaces:      true,
+		}
+		entries[idx] = *media[idx]
+	}
+
+	library := NewMediaList(media)
+	clusters := &MediaCluster{entries: entries}
+
+	if err := GroupDuplicates(2, 0, clusters); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := DetectFaces(2, 0, clusters); err != nil {
+		t.Fatal(err)
+	}
+
+	graded := make(map[string]Media)
+	for _, entry := range clusters.entries {
+		if len(entry.phash) == 0 || !entry.facesCounted {
+			t.Fatalf("expected %v to be hashed and have its faces counted", entry.source)
+		}
+
+		graded[entry.source] = entry
+	}
+
+	// any further decode would fail
+	for _, name := range names {
+		if err := os.Remove(filepath.Join(src, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for pair := range CalcuateBlur(2, 0, 0, 100, false, db, library, clusters, nil) {
+		if pair.Error != nil {
+			t.Fatalf("expected %v to be graded without decoding it again: %v", pair.Value.source, pair.Error)
+		}
+
+		expected := graded[pair.Value.source]
+
+		if pair.Value.phash != expected.phash {
+			t.Errorf("expected %v to keep its perceptual hash %q, got %q", pair.Value.source, expected.phash, pair.Value.phash)
+		}
+
+		if pair.Value.blur != expected.rawBlur {
+			t.Errorf("expected %v to keep its blur-score %v, got %v", pair.Value.source, expected.rawBlur, pair.Value.blur)
+		}
+	}
+}
+
+/*
+ * A file that can't be processed doesn't stop the rest being copied, but is reported and fails the run
+ */
+func TestProcessLibraryContinuesPastFailures(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+
+	for idx := 0; idx < 3; idx++ {
+		WriteTestImage(t, filepath.Join(src, fmt.Sprintf("IMG_%04d.png", idx)), true, idx)
+	}
+
+	WriteTestImage(t, filepath.Join(src, "IMG_0009.png"), true, 9)
+
+	// a folder in the way of a photo's copy can't be overwritten, however often it's retried
+	WriteTestFile(t, filepath.Join(dst, "3_IMG_0009.png", "keep.txt"), "not a photo")
+
+	opts := NewTestCopyOpts(t, []string{filepath.Join(src, "*.png")}, dst)
+	opts.onExists = OVERWRITE
+	opts.retries = 1
+
+	output := CaptureStdout(t, func() {
+		if code := Copy(opts, MediaFilter{kind: "all"}); code == 0 {
+			t.Error("expected copying to fail when a file couldn't be copied")
+		}
+	})
+
+	if !strings.Contains(output, "failed to copy 1 media") || !strings.Contains(output, "IMG_0009.png after 2 attempt(s)") {
+		t.Errorf("expected the summary to report the failed file, got:\n%v", output)
+	}
+
+	copies, err := filepath.Glob(filepath.Join(dst, "*.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	copied := 0
+	for _, fpath := range copies {
+		if info, err := os.Stat(fpath); err == nil && info.Mode().IsRegular() {
+			copied += 1
+		}
+	}
+
+	if copied != 3 {
+		t.Errorf("expected the other 3 photos to be copied, got %v", copies)
+	}
+
+	if rows := CountMediaRows(t, OpenTestDb(t, dst), "skipped = 0"); rows != 3 {
+		t.Errorf("expected the other 3 photos to be recorded, got %v", rows)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Lines queued for a slow reader. Once the queue is full further lines are dropped, so a reader
+// that stops reading can't stall the run
+const ProgressStreamBuffer = 1024
+
+// How long closing the stream waits for a reader to take the lines still queued, like the summary
+const ProgressStreamCloseTimeout = 2 * time.Second
+
+// Streams what a run is doing as --json style lines to a file descriptor or UNIX socket, with
+// --progress-json, so GUIs and scripts wrapping badger can show their own progress. A nil stream
+// streams nothing
+type ProgressStream struct {
+	writer io.WriteCloser
+	stats  *ProgressStats
+	lock   sync.Mutex
+	lines  chan []byte
+	closed bool
+	// closed once every queued line is written
+	drained chan struct{}
+}
+
+/*
+ * Stream lines to a writer. Lines are written by a single goroutine, in the order they're queued
+ */
+func NewProgressStream(writer io.WriteCloser) *ProgressStream {
+	stream := &ProgressStream{
+		writer:  writer,
+		lines:   make(chan []byte, ProgressStreamBuffer),
+		drained: make(chan struct{}),
+	}
+
+	go func() {
+		defer close(stream.drained)
+
+		for line := range stream.lines {
+			stream.writer.Write(line)
+		}
+	}()
+
+	return stream
+}
+
+/*
+ * Open a --progress-json target; fd:<n> for an inherited file descriptor, or unix:<path> for a
+ * listening UNIX socket. Returns a nil stream if there's no target
+ */
+func OpenProgressStream(target string) (*ProgressStream, error) {
+	if len(target) == 0 {
+		return nil, nil
+	}
+
+	if strings.HasPrefix(target, "fd:") {
+		fd, err := strconv.Atoi(strings.TrimPrefix(target, "fd:"))
+		if err != nil || fd < 0 {
+			return nil, fmt.Errorf("badger: unsupported --progress-json '%v'; expected fd:<n> or unix:<path>", target)
+		}
+
+		file := os.NewFile(uintptr(fd), target)
+		if _, err := file.Stat(); err != nil {
+			return nil, fmt.Errorf("badger: --progress-json file descriptor %v isn't open: %v", fd, err)
+		}
+
+		return NewProgressStream(file), nil
+	}
+
+	if path := strings.TrimPrefix(target, "unix:"); path != target && len(path) > 0 {
+		conn, err := net.Dial("unix", path)
+		if err != nil {
+			return nil, fmt.Errorf("badger: failed to connect to --progress-json socket %v: %v", path, err)
+		}
+
+		return NewProgressStream(conn), nil
+	}
+
+	return nil, fmt.Errorf("badger: unsupported --progress-json '%v'; expected fd:<n> or unix:<path>", target)
+}
+
+/*
+ * Queue a single line to write. A reader that goes away or falls behind shouldn't stop the run, so
+ * failures are ignored, and lines are dropped while the queue is full
+ */
+func (stream *ProgressStream) Write(kind JsonLineKind, value any) {
+	if stream == nil {
+		return
+	}
+
+	line, err := JsonLine(kind, value)
+	if err != nil {
+		return
+	}
+
+	stream.lock.Lock()
+	defer stream.lock.Unlock()
+
+	if stream.closed {
+		return
+	}
+
+	select {
+	case stream.lines <- append(line, '\n'):
+	default:
+	}
+}
+
+/*
+ * Start counting the bytes copied, out of everything to be copied
+ */
+func (stream *ProgressStream) Start(facts *Facts) {
+	if stream == nil {
+		return
+	}
+
+	stream.stats = NewProgressStats(facts)
+}
+
+/*
+ * Count a copied media, and write the overall progress
+ */
+func (stream *ProgressStream) Update(media *Media) {
+	if stream == nil || stream.stats == nil {
+		return
+	}
+
+	stream.lock.Lock()
+	stream.stats.Add(media)
+	progress := stream.stats.Progress()
+	stream.lock.Unlock()
+
+	stream.Write(PROGRESS_LINE, progress)
+}
+
+/*
+ * Stop streaming, giving the reader a moment to take the lines still queued
+ */
+func (stream *ProgressStream) Close() error {
+	if stream == nil {
+		return nil
+	}
+
+	stream.lock.Lock()
+	if !stream.closed {
+		stream.closed = true
+		close(stream.lines)
+	}
+	stream.lock.Unlock()
+
+	select {
+	case <-stream.drained:
+	case <-time.After(ProgressStreamCloseTimeout):
+	}
+
+	return stream.writer.Close()
+}
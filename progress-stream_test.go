@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+/*
+ * A writer whose reader never reads; writes block until it's closed
+ */
+type StalledWriter struct {
+	closed chan struct{}
+	once   sync.Once
+}
+
+func (writer *StalledWriter) Write(line []byte) (int, error) {
+	<-writer.closed
+	return 0, nil
+}
+
+func (writer *StalledWriter) Close() error {
+	writer.once.Do(func() { close(writer.closed) })
+	return nil
+}
+
+/*
+ * A writer that keeps every line
+ */
+type RecordingWriter struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (writer *RecordingWriter) Write(line []byte) (int, error) {
+	writer.lock.Lock()
+	defer writer.lock.Unlock()
+
+	return writer.buf.Write(line)
+}
+
+func (writer *RecordingWriter) Close() error {
+	return nil
+}
+
+/*
+ * A reader that stops reading drops lines rather than stalling the run, and doesn't hang the exit
+ */
+func TestProgressStreamDoesntBlockOnStalledReader(t *testing.T) {
+	stream := NewProgressStream(&StalledWriter{closed: make(chan struct{})})
+
+	written := make(chan struct{})
+	go func() {
+		for idx := 0; idx < ProgressStreamBuffer*4; idx++ {
+			stream.Write(EVENT_LINE, map[string]int{"idx": idx})
+		}
+		close(written)
+	}()
+
+	select {
+	case <-written:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected writes to return while the reader is stalled")
+	}
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- stream.Close()
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(ProgressStreamCloseTimeout + 5*time.Second):
+		t.Fatal("expected closing to return while the reader is stalled")
+	}
+}
+
+/*
+ * Lines are written in order, and closing flushes the ones still queued
+ */
+func TestProgressStreamWritesInOrder(t *testing.T) {
+	writer := &RecordingWriter{}
+	stream := NewProgressStream(writer)
+
+	for idx := 0; idx < 10; idx++ {
+		stream.Write(EVENT_LINE, map[string]int{"idx": idx})
+	}
+	stream.Write(SUMMARY_LINE, RunSummary{RunId: "abc"})
+
+	if err := stream.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// writes after closing are ignored
+	stream.Write(EVENT_LINE, map[string]int{"idx": 10})
+
+	lines := strings.Split(strings.TrimSpace(writer.buf.String()), "\n")
+	if len(lines) != 11 {
+		t.Fatalf("expected 11 lines, got %v", len(lines))
+	}
+
+	for idx, line := range lines[:10] {
+		expected, err := JsonLine(EVENT_LINE, map[string]int{"idx": idx})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if line != string(expected) {
+			t.Errorf("expected line %v to be %v, got %v", idx, string(expected), line)
+		}
+	}
+
+	if !strings.Contains(lines[10], `"abc"`) {
+		t.Errorf("expected the summary to be written last, got %v", lines[10])
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Redraw a progress counter at most this often
+const ProgressInterval = 100 * time.Millisecond
+
+// In quiet mode, emit a progress line after this many files are copied
+const QuietProgressEvery = 50
+
+// Reports progress as media are copied
+type ProgressReporter interface {
+	Update(media *Media)
+	Done()
+}
+
+// A single, self-overwriting progress line like "Reading capture times 3402/41000"
+type ProgressCounter struct {
+	label     string
+	total     int
+	count     int
+	quiet     bool
+	lastPrint time.Time
+	lock      sync.Mutex
+}
+
+/*
+ * Construct a progress counter. Quiet counters print nothing
+ */
+func NewProgressCounter(label string, total int, quiet bool) *ProgressCounter {
+	return &ProgressCounter{
+		label: label,
+		total: total,
+		quiet: quiet,
+	}
+}
+
+/*
+ * Count one more item, and redraw the counter if enough time has passed
+ */
+func (counter *ProgressCounter) Increment() {
+	counter.lock.Lock()
+	defer counter.lock.Unlock()
+
+	counter.count += 1
+
+	if counter.quiet {
+		return
+	}
+
+	if counter.count == counter.total || time.Since(counter.lastPrint) > ProgressInterval {
+		counter.lastPrint = time.Now()
+		fmt.Printf("\r%v %v/%v", counter.label, counter.count, counter.total)
+	}
+}
+
+/*
+ * Finish the progress line
+ */
+func (counter *ProgressCounter) Done() {
+	if !counter.quiet {
+		fmt.Println()
+	}
+}
+
+// Statistics about media copied so far, compared against the library's facts
+type ProgressStats struct {
+	facts       *Facts
+	start       time.Time
+	copiedSize  int64
+	copiedCount int
+	photoCount  int
+	rawCount    int
+	videoCount  int
+}
+
+// A machine-readable progress line, emitted in quiet mode
+type ProgressLine struct {
+	Percentage float64 `json:"percentage"`
+	CopiedMB   float64 `json:"copiedMB"`
+	TotalMB    float64 `json:"totalMB"`
+	RateMB     float64 `json:"rateMB"`
+	Eta        float64 `json:"eta"`
+}
+
+/*
+ * Start tracking copy progress
+ */
+func NewProgressStats(facts *Facts) *ProgressStats {
+	return &ProgressStats{
+		facts: facts,
+		start: time.Now(),
+	}
+}
+
+/*
+ * Record a copied media item
+ */
+func (stats *ProgressStats) Add(media *Media) {
+	size, _ := media.Size()
+
+	stats.copiedSize += size
+	stats.copiedCount += 1
+
+	switch media.GetType() {
+	case PHOTO:
+		stats.photoCount += 1
+	case RAW:
+		stats.rawCount += 1
+	case VIDEO:
+		stats.videoCount += 1
+	}
+}
+
+/*
+ * Compute the current copy progress
+ */
+func (stats *ProgressStats) Progress() ProgressLine {
+	elapsed := time.Since(stats.start).Seconds()
+	copiedMB := float64(stats.copiedSize) / 1e6
+	totalMB := float64(stats.facts.Size) / 1e6
+
+	line := ProgressLine{
+		CopiedMB: copiedMB,
+		TotalMB:  totalMB,
+	}
+
+	if totalMB > 0 {
+		line.Percentage = 100 * copiedMB / totalMB
+	}
+
+	if elapsed > 0 {
+		line.RateMB = copiedMB / elapsed
+	}
+
+	if line.RateMB > 0 {
+		line.Eta = (totalMB - copiedMB) / line.RateMB
+	}
+
+	return line
+}
+
+/*
+ * Summarise progress on a single line
+ */
+func (stats *ProgressStats) Summary() string {
+	progress := stats.Progress()
+
+	return fmt.Sprintf("Copying %.1f%% (%v/%v) %v/s, %.0fs remaining | %v/%v photos, %v/%v raw images, %v/%v videos",
+		progress.Percentage, HumanizeBytes(uint64(stats.copiedSize)), HumanizeBytes(uint64(stats.facts.Size)),
+		HumanizeBytes(uint64(progress.RateMB*1e6)), progress.Eta,
+		stats.photoCount, stats.facts.PhotoCount,
+		stats.rawCount, stats.facts.RawCount,
+		stats.videoCount, stats.facts.VideoCount)
+}
+
+// A plain-text progress-bar; quiet progress-bars print JSON lines instead, tagged as --json lines
+// when `json` is set
+type ProgressBar struct {
+	stats     *ProgressStats
+	quiet     bool
+	json      bool
+	lastPrint time.Time
+	done      bool
+}
+
+/*
+ * Create a progress-bar
+ */
+func NewProgressBar(facts *Facts, quiet bool, json bool) *ProgressBar {
+	return &ProgressBar{
+		stats: NewProgressStats(facts),
+		quiet: quiet,
+		json:  json,
+	}
+}
+
+/*
+ * Receive a media item, and update the progress bar
+ */
+func (bar *ProgressBar) Update(media *Media) {
+	bar.stats.Add(media)
+
+	count := bar.stats.copiedCount
+
+	if bar.quiet {
+		if count%QuietProgressEvery == 0 || count == bar.stats.facts.Count {
+			bar.PrintProgressLine()
+		}
+
+		return
+	}
+
+	if count == bar.stats.facts.Count || time.Since(bar.lastPrint) > ProgressInterval {
+		bar.lastPrint = time.Now()
+		fmt.Printf("\r%v", bar.stats.Summary())
+	}
+}
+
+/*
+ * Print the current progress as a single JSON line
+ */
+func (bar *ProgressBar) PrintProgressLine() {
+	if bar.json {
+		PrintJsonLine(PROGRESS_LINE, bar.stats.Progress())
+		return
+	}
+
+	line, err := json.Marshal(bar.stats.Progress())
+	if err != nil {
+		return
+	}
+
+	fmt.Println(string(line))
+}
+
+/*
+ * Finish the progress-bar
+ */
+func (bar *ProgressBar) Done() {
+	if bar.done {
+		return
+	}
+
+	bar.done = true
+
+	if !bar.quiet {
+		fmt.Println()
+	}
+}
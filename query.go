@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Queries for common questions about a library, selected by flag and limited to --limit rows
+var CannedQueries = map[string]string{
+	// the blurriest graded photos that were copied, or indexed
+	"--blurriest": `
+	SELECT src, dst, blur, mediaType, IFNULL(mtime, '') AS captureTime
+	FROM mediaData
+	WHERE (skipped = 0 OR indexed = 1) AND gradeEdge IS NOT NULL
+	ORDER BY blur ASC
+	LIMIT ?`,
+	// the clusters with the most media, per run; the noise cluster isn't a cluster
+	"--largest-clusters": fmt.Sprintf(`
+	SELECT IFNULL(runId, '') AS runId, clusterId, COUNT(*) AS media, IFNULL(SUM(size), 0) AS bytes,
+		IFNULL(MIN(mtime), '') AS first, IFNULL(MAX(mtime), '') AS last
+	FROM mediaData
+	WHERE skipped = 0 AND clusterId != %d
+	GROUP BY runId, clusterId
+	ORDER BY media DESC
+	LIMIT ?`, NoiseClusterId),
+	// photos & raw images that couldn't be decoded, so were copied as-is without a blur-score
+	"--errors": fmt.Sprintf(`
+	SELECT src, dst, mediaType, IFNULL(runId, '') AS runId
+	FROM mediaData
+	WHERE skipped = 0 AND mediaType IN ('%s', '%s') AND gradeEdge IS NULL
+	ORDER BY src
+	LIMIT ?`, PHOTO, RAW),
+}
+
+// The result of a query; its column names, and each row's values
+type QueryResult struct {
+	columns []string
+	rows    [][]any
+}
+
+/*
+ * Run a query against the metadata database, without allowing it to change the database
+ */
+func (conn *BadgerDb) Query(text string, args ...any) (*QueryResult, error) {
+	// the pragma only applies to the connection it's run on
+	conn.db.SetMaxOpenConns(1)
+
+	if _, err := conn.db.Exec(`PRAGMA query_only = ON`); err != nil {
+		return nil, err
+	}
+
+	rows, err := conn.db.Query(text, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	result := QueryResult{columns: columns, rows: [][]any{}}
+
+	for rows.Next() {
+		values := make([]any, len(columns))
+		pointers := make([]any, len(columns))
+
+		for idx := range values {
+			pointers[idx] = &values[idx]
+		}
+
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+
+		// text is sometimes scanned as bytes
+		for idx, value := range values {
+			if bytes, ok := value.([]byte); ok {
+				values[idx] = string(bytes)
+			}
+		}
+
+		result.rows = append(result.rows, values)
+	}
+
+	return &result, rows.Err()
+}
+
+/*
+ * Print a query's rows as tab-separated values, after a header of column names. Nulls are printed
+ * as NULL, like the sqlite3 CLI
+ */
+func PrintQueryResult(result *QueryResult) {
+	fmt.Println(strings.Join(result.columns, "\t"))
+
+	for _, row := range result.rows {
+		fields := make([]string, len(row))
+
+		for idx, value := range row {
+			if value == nil {
+				fields[idx] = "NULL"
+			} else {
+				fields[idx] = fmt.Sprint(value)
+			}
+		}
+
+		fmt.Println(strings.Join(fields, "\t"))
+	}
+}
+
+/*
+ * Get each of a query's rows as an object keyed by column name
+ */
+func (result *QueryResult) Objects() []map[string]any {
+	objects := make([]map[string]any, len(result.rows))
+
+	for rowIdx, row := range result.rows {
+		objects[rowIdx] = map[string]any{}
+
+		for idx, column := range result.columns {
+			objects[rowIdx][column] = row[idx]
+		}
+	}
+
+	return objects
+}
+
+/*
+ * Print a query's rows as JSON lines, one object per row keyed by column name
+ */
+func PrintQueryJson(result *QueryResult) error {
+	for _, object := range result.Objects() {
+		line, err := json.Marshal(object)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(string(line))
+	}
+
+	return nil
+}
+
+/*
+ * Explore a destination library's metadata database, with SQL or a canned query, without the sqlite3 CLI.
+ * The database isn't changed
+ */
+func Query(dbDir string, text string, canned string, limit int, asJson bool) int {
+	if len(text) == 0 && len(canned) == 0 {
+		bail(errors.New("badger: a query is needed; give SQL, or one of --blurriest, --largest-clusters or --errors"))
+	}
+
+	if limit <= 0 {
+		bail(fmt.Errorf("badger: --limit must be greater than zero, but was %v", limit))
+	}
+
+	// the database is read as badger left it, rather than migrated to the latest schema
+	db, err := OpenReadOnlyDb(dbDir)
+	bail(err)
+	defer db.Close()
+
+	var result *QueryResult
+	if len(canned) > 0 {
+		result, err = db.Query(CannedQueries[canned], limit)
+	} else {
+		result, err = db.Query(text)
+	}
+
+	if err != nil {
+		bail(fmt.Errorf("badger: query failed: %v", err))
+	}
+
+	if asJson {
+		bail(PrintQueryJson(result))
+	} else {
+		PrintQueryResult(result)
+	}
+
+	return 0
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenReadOnlyDbRequiresDatabase(t *testing.T) {
+	dir := t.TempDir()
+
+	if _, err := OpenReadOnlyDb(dir); err == nil {
+		t.Error("expected opening a directory without a database to fail")
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, ".badger_metadata.sqlite")); !os.IsNotExist(err) {
+		t.Error("expected no database to be created")
+	}
+}
+
+func TestQueryCantChangeDatabase(t *testing.T) {
+	dir := t.TempDir()
+
+	db := NewTestRunDb(t, dir, "run", dir)
+	InsertTestRow(t, db, "/media/card/a.jpg", filepath.Join(dir, "a.jpg"), "aaaa")
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	readonly, err := OpenReadOnlyDb(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer readonly.Close()
+
+	if _, err := readonly.Query(`PRAGMA query_only = OFF; DELETE FROM mediaData`); err == nil {
+		t.Error("expected writing to the database to fail")
+	}
+
+	result, err := readonly.Query(`SELECT src FROM mediaData`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.rows) != 1 {
+		t.Errorf("expected the media to be kept, got %v rows", len(result.rows))
+	}
+}
+
+func TestQueryDoesntMigrate(t *testing.T) {
+	dir := t.TempDir()
+
+	db := OpenTestDb(t, dir)
+	if _, err := db.db.Exec(`CREATE TABLE mediaData (src TEXT NOT NULL)`); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	readonly, err := OpenReadOnlyDb(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer readonly.Close()
+
+	result, err := readonly.Query(`SELECT name FROM sqlite_master WHERE type = 'table'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.rows) != 1 {
+		t.Errorf("expected only the original table, got %v", result.rows)
+	}
+}
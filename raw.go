@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"os"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// Give up looking for embedded previews after this many candidates
+const MaxRawPreviewCandidates = 32
+
+/*
+ * Most RAW formats embed one or more JPEG previews. Find the largest decodable
+ * preview in a RAW file, and decode it
+ */
+func ReadRawPreview(fpath string) (image.Image, error) {
+	data, err := os.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	// the start-of-image marker for a JPEG stream
+	soi := []byte{0xFF, 0xD8, 0xFF}
+
+	best := -1
+	bestPixels := 0
+	offset := 0
+
+	for candidates := 0; candidates < MaxRawPreviewCandidates; candidates++ {
+		idx := bytes.Index(data[offset:], soi)
+		if idx < 0 {
+			break
+		}
+
+		start := offset + idx
+		offset = start + len(soi)
+
+		config, err := jpeg.DecodeConfig(bytes.NewReader(data[start:]))
+		if err != nil {
+			continue
+		}
+
+		if pixels := config.Width * config.Height; pixels > bestPixels {
+			best = start
+			bestPixels = pixels
+		}
+	}
+
+	if best < 0 {
+		return nil, errors.New("badger: no embedded jpeg preview found in " + fpath)
+	}
+
+	return jpeg.Decode(bytes.NewReader(data[best:]))
+}
+
+/*
+ * Read a RAW file's largest embedded preview as a grayscale image
+ */
+func ReadRawPreviewGray(fpath string) (*image.Gray, error) {
+	img, err := ReadRawPreview(fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	gray := image.NewGray(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(gray, gray.Bounds(), img, bounds.Min, draw.Src)
+
+	return gray, nil
+}
+
+/*
+ * Read a RAW file's largest embedded preview as a colour image
+ */
+func ReadRawPreviewRGBA(fpath string) (*image.RGBA, error) {
+	img, err := ReadRawPreview(fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Src)
+
+	return rgba, nil
+}
+
+/*
+ * Find the exif Canon's CR3 format stores in its CMT boxes; CMT2 holds the exif sub-directory,
+ * including the capture time, and CMT1 the main directory
+ */
+func FindCr3Exif(data []byte) ([]byte, error) {
+	for _, name := range []string{"CMT2", "CMT1"} {
+		idx := bytes.Index(data, []byte(name))
+		if idx < 4 {
+			continue
+		}
+
+		// the box's size, including its eight-byte header, precedes its name
+		size := int(binary.BigEndian.Uint32(data[idx-4 : idx]))
+		end := idx - 4 + size
+
+		if size > 8 && end <= len(data) {
+			return data[idx+4 : end], nil
+		}
+	}
+
+	return nil, errors.New("badger: no exif found in cr3 file")
+}
+
+/*
+ * Decode a RAW image's exif. Most RAW formats are TIFF files, and decode directly. Panasonic
+ * and Olympus RAWs are TIFFs with their own magic number, and Canon's CR3 stores exif as
+ * TIFFs inside ISO media boxes
+ */
+func LoadRawExif(fpath string) (*exif.Exif, error) {
+	data, err := os.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < 12 {
+		return nil, errors.New("badger: raw file too short to contain exif: " + fpath)
+	}
+
+	switch string(data[:4]) {
+	case "IIU\x00", "IIRO", "IIRS":
+		data[2], data[3] = 42, 0
+	case "MMOR":
+		data[2], data[3] = 0, 42
+	}
+
+	if string(data[4:8]) == "ftyp" {
+		data, err = FindCr3Exif(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return exif.Decode(bytes.NewReader(data))
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+/*
+ * Clone a file's content into a new file, sharing its blocks until either is modified
+ */
+func Reflink(source string, fpath string) error {
+	src, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dest, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+
+	err = unix.IoctlFileClone(int(dest.Fd()), int(src.Fd()))
+	if err != nil {
+		dest.Close()
+		os.Remove(fpath)
+
+		return fmt.Errorf("%w %v with a reflink; is --to on the same copy-on-write filesystem, like btrfs or XFS? %v", ErrCantLink, source, err)
+	}
+
+	return dest.Close()
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package main
+
+import "fmt"
+
+/*
+ * Reflinks are cloned with a linux ioctl, so can't be made on other platforms
+ */
+func Reflink(source string, fpath string) error {
+	return fmt.Errorf("%w %v with a reflink; reflinks are only supported on linux", ErrCantLink, source)
+}
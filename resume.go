@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+/*
+ * Get the command-line arguments the latest run into a destination was started with, so it
+ * can be run again. Adds --yes when `yes` is set, to skip the prompt
+ */
+func ResumeArgs(to string, yes bool) ([]string, error) {
+	dbDir, err := DatabaseDir(to)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Stat(filepath.Join(dbDir, ".badger_metadata.sqlite")); errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("badger: no badger database found in %v; nothing to resume", dbDir)
+	}
+
+	conn, err := NewSqliteDB(dbDir)
+	if err != nil {
+		return nil, err
+	}
+
+	db := BadgerDb{conn}
+	defer db.Close()
+
+	// databases written by older versions of badger need an args column
+	if err := db.CreateTables(); err != nil {
+		return nil, err
+	}
+
+	runId, args, err := db.LatestRunArgs()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(runId) == 0 {
+		return nil, fmt.Errorf("badger: no resumable run is recorded in %v; re-run runs started by older versions of badger with --incremental", dbDir)
+	}
+
+	if yes && !FlagGiven(args, "--yes") {
+		args = append(args, "--yes")
+	}
+
+	fmt.Printf("badger: resuming run %v\n", runId)
+
+	return args, nil
+}
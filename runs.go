@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+)
+
+/*
+ * List the runs recorded in a destination library's metadata database
+ */
+func Runs(dbDir string) int {
+	conn, err := NewSqliteDB(dbDir)
+	bail(err)
+
+	db := BadgerDb{conn}
+	defer db.Close()
+
+	// databases written by older versions of badger need a runId column
+	err = db.CreateTables()
+	bail(err)
+
+	runs, err := db.ListRuns()
+	bail(err)
+
+	if len(runs) == 0 {
+		fmt.Println("badger: no runs are recorded in this database")
+		return 0
+	}
+
+	for _, run := range runs {
+		fmt.Printf("%v\t%v files (%v skipped)\t%v\n", run.runId, run.files, run.skipped, run.sources)
+	}
+
+	return 0
+}
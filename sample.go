@@ -0,0 +1,51 @@
+package main
+
+import (
+	"math/rand"
+	"path"
+	"sort"
+	"strings"
+)
+
+/*
+ * Randomly choose `count` shots from a list of files, keeping every file of a chosen shot; a RAW
+ * image and its JPEG share a prefix, so they're sampled together. The same seed always chooses
+ * the same shots. Files keep their original order
+ */
+func SampleByPrefix(files []string, count int, seed int64) []string {
+	prefixes := []string{}
+	members := make(map[string][]int)
+
+	for idx, fpath := range files {
+		prefix := strings.TrimSuffix(fpath, path.Ext(fpath))
+
+		if _, ok := members[prefix]; !ok {
+			prefixes = append(prefixes, prefix)
+		}
+
+		members[prefix] = append(members[prefix], idx)
+	}
+
+	if count >= len(prefixes) {
+		return files
+	}
+
+	random := rand.New(rand.NewSource(seed))
+	random.Shuffle(len(prefixes), func(i, j int) {
+		prefixes[i], prefixes[j] = prefixes[j], prefixes[i]
+	})
+
+	chosen := []int{}
+	for _, prefix := range prefixes[:count] {
+		chosen = append(chosen, members[prefix]...)
+	}
+
+	sort.Ints(chosen)
+
+	sampled := make([]string, len(chosen))
+	for idx, fileIdx := range chosen {
+		sampled[idx] = files[fileIdx]
+	}
+
+	return sampled
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/url"
+	"os"
+	"os/user"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// A remote host, written to over SFTP
+type SFTPDestination struct {
+	conn   *ssh.Client
+	client *sftp.Client
+}
+
+/*
+ * Connect to an sftp://user@host[:port]/path destination. Keys are read from ssh-agent, and the
+ * host is checked against ~/.ssh/known_hosts
+ */
+func OpenSFTPDestination(to string) (Destination, string, error) {
+	target, err := url.Parse(to)
+	if err != nil {
+		return nil, "", fmt.Errorf("badger: could not parse --to %v as an sftp://user@host/path URL: %v", to, err)
+	}
+
+	username := target.User.Username()
+	if len(username) == 0 {
+		current, err := user.Current()
+		if err != nil {
+			return nil, "", err
+		}
+		username = current.Username
+	}
+
+	host := target.Host
+	if len(target.Port()) == 0 {
+		host = net.JoinHostPort(target.Hostname(), "22")
+	}
+
+	socket, err := net.Dial("unix", os.Getenv("SSH_AUTH_SOCK"))
+	if err != nil {
+		return nil, "", fmt.Errorf("badger: sftp destinations authenticate with ssh-agent, which isn't reachable: %v", err)
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, "", err
+	}
+
+	hostKeys, err := knownhosts.New(filepath.Join(home, ".ssh", "known_hosts"))
+	if err != nil {
+		return nil, "", err
+	}
+
+	config := &ssh.ClientConfig{
+		User:            username,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeysCallback(agent.NewClient(socket).Signers)},
+		HostKeyCallback: hostKeys,
+	}
+
+	conn, err := ssh.Dial("tcp", host, config)
+	if err != nil {
+		return nil, "", fmt.Errorf("badger: failed to connect to %v: %v", host, err)
+	}
+
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, "", err
+	}
+
+	return &SFTPDestination{conn, client}, target.Path, nil
+}
+
+func (dest *SFTPDestination) MkdirAll(dir string) error {
+	return dest.client.MkdirAll(dir)
+}
+
+func (dest *SFTPDestination) Create(fpath string) (io.WriteCloser, error) {
+	return dest.client.Create(fpath)
+}
+
+func (dest *SFTPDestination) Open(fpath string) (io.ReadCloser, error) {
+	return dest.client.Open(fpath)
+}
+
+func (dest *SFTPDestination) Stat(fpath string) (os.FileInfo, error) {
+	return dest.client.Stat(fpath)
+}
+
+func (dest *SFTPDestination) Remove(fpath string) error {
+	return dest.client.Remove(fpath)
+}
+
+func (dest *SFTPDestination) Chtimes(fpath string, atime time.Time, mtime time.Time) error {
+	return dest.client.Chtimes(fpath, atime, mtime)
+}
+
+func (dest *SFTPDestination) Chmod(fpath string, mode os.FileMode) error {
+	return dest.client.Chmod(fpath, mode)
+}
+
+func (dest *SFTPDestination) Symlink(target string, fpath string) error {
+	return dest.client.Symlink(target, fpath)
+}
+
+/*
+ * Get the free-space on the remote drive, where the server supports it. Free-space checks are
+ * best-effort over SFTP; when the server can't say, the space is treated as unlimited
+ */
+func (dest *SFTPDestination) FreeSpace(dir string) (uint64, error) {
+	for {
+		stat, err := dest.client.StatVFS(dir)
+		if err == nil {
+			return stat.Frsize * stat.Bavail, nil
+		}
+
+		// the destination may not exist yet, so try its parent
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return math.MaxUint64, nil
+		}
+
+		dir = parent
+	}
+}
+
+func (dest *SFTPDestination) Close() error {
+	dest.client.Close()
+	return dest.conn.Close()
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+// Photos are shrunk to this long-edge before grading. It's much faster than grading every pixel of
+// a large photo, and it keeps scores comparable between cameras of different resolutions, since
+// the laplacian of a high-resolution photo spreads each edge across more pixels
+const GradeMaxEdge = 1024
+
+// Metrics that photos can be graded for sharpness by
+type SharpnessMetric string
+
+const (
+	LAPLACIAN          SharpnessMetric = "laplacian"
+	TENENGRAD          SharpnessMetric = "tenengrad"
+	SOBEL              SharpnessMetric = "sobel"
+	MODIFIED_LAPLACIAN SharpnessMetric = "modified-laplacian"
+)
+
+// Scores how sharp a grayscale image is; higher scores are sharper. Scores from different
+// scorers aren't comparable
+type Scorer interface {
+	Score(img *image.Gray) (float64, error)
+}
+
+// The variance of the image's laplacian
+type LaplacianScorer struct{}
+
+// The mean squared sobel gradient-magnitude
+type TenengradScorer struct{}
+
+// The variance of the sobel gradient-magnitude
+type SobelScorer struct{}
+
+// The mean of the absolute second derivatives along each axis, which unlike the laplacian
+// don't cancel each other out
+type ModifiedLaplacianScorer struct{}
+
+/*
+ * Parse a --sharpness-metric name
+ */
+func ParseSharpnessMetric(name string) (SharpnessMetric, error) {
+	switch metric := SharpnessMetric(name); metric {
+	case LAPLACIAN, TENENGRAD, SOBEL, MODIFIED_LAPLACIAN:
+		return metric, nil
+	}
+
+	return "", fmt.Errorf("badger: unsupported --sharpness-metric '%v'; expected one of laplacian, tenengrad, sobel or modified-laplacian", name)
+}
+
+/*
+ * Construct the scorer for a metric. Media graded before metrics were configurable used the laplacian
+ */
+func NewScorer(metric SharpnessMetric) Scorer {
+	switch metric {
+	case TENENGRAD:
+		return TenengradScorer{}
+	case SOBEL:
+		return SobelScorer{}
+	case MODIFIED_LAPLACIAN:
+		return ModifiedLaplacianScorer{}
+	}
+
+	return LaplacianScorer{}
+}
+
+func (LaplacianScorer) Score(img *image.Gray) (float64, error) {
+	return GrayBlur(img)
+}
+
+/*
+ * Visit the squared sobel gradient-magnitude of each interior pixel. Returns how many were visited
+ */
+func VisitSobelMagnitudes(img *image.Gray, visit func(magnitude float64)) int {
+	bounds := img.Bounds()
+	count := 0
+
+	at := func(x, y int) float64 {
+		return float64(img.GrayAt(x, y).Y)
+	}
+
+	for y := bounds.Min.Y + 1; y < bounds.Max.Y-1; y++ {
+		for x := bounds.Min.X + 1; x < bounds.Max.X-1; x++ {
+			gx := (at(x+1, y-1) + 2*at(x+1, y) + at(x+1, y+1)) - (at(x-1, y-1) + 2*at(x-1, y) + at(x-1, y+1))
+			gy := (at(x-1, y+1) + 2*at(x, y+1) + at(x+1, y+1)) - (at(x-1, y-1) + 2*at(x, y-1) + at(x+1, y-1))
+
+			visit(gx*gx + gy*gy)
+			count += 1
+		}
+	}
+
+	return count
+}
+
+func (TenengradScorer) Score(img *image.Gray) (float64, error) {
+	sum := 0.0
+
+	count := VisitSobelMagnitudes(img, func(magnitude float64) {
+		sum += magnitude
+	})
+
+	if count == 0 {
+		return 0, nil
+	}
+
+	return math.Ceil(sum / float64(count)), nil
+}
+
+func (SobelScorer) Score(img *image.Gray) (float64, error) {
+	sum := 0.0
+	squares := 0.0
+
+	// the squared magnitude is the square of the gradient, so its sum gives the variance directly
+	count := VisitSobelMagnitudes(img, func(magnitude float64) {
+		sum += math.Sqrt(magnitude)
+		squares += magnitude
+	})
+
+	if count == 0 {
+		return 0, nil
+	}
+
+	mean := sum / float64(count)
+
+	return math.Ceil(squares/float64(count) - mean*mean), nil
+}
+
+func (ModifiedLaplacianScorer) Score(img *image.Gray) (float64, error) {
+	bounds := img.Bounds()
+
+	at := func(x, y int) float64 {
+		return float64(img.GrayAt(x, y).Y)
+	}
+
+	sum := 0.0
+	count := 0
+
+	for y := bounds.Min.Y + 1; y < bounds.Max.Y-1; y++ {
+		for x := bounds.Min.X + 1; x < bounds.Max.X-1; x++ {
+			centre := 2 * at(x, y)
+			sum += math.Abs(centre-at(x-1, y)-at(x+1, y)) + math.Abs(centre-at(x, y-1)-at(x, y+1))
+			count += 1
+		}
+	}
+
+	if count == 0 {
+		return 0, nil
+	}
+
+	// scaled like the laplacian's score, so small differences aren't lost when rounded
+	return math.Ceil(10 * sum / float64(count)), nil
+}
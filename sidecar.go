@@ -0,0 +1,178 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Extensions of sidecar files, which describe the media file they're named after; develop-settings
+// (.xmp), iPhone edits (.aae), and video thumbnails (.thm)
+var SidecarExtensions = []string{".xmp", ".aae", ".thm"}
+
+/*
+ * Is this file a sidecar, describing a media file?
+ */
+func IsSidecar(fpath string) bool {
+	ext := strings.ToLower(path.Ext(fpath))
+
+	for _, sidecarExt := range SidecarExtensions {
+		if ext == sidecarExt {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+ * Find a media's sidecars; either <name>.<ext>.xmp (darktable) or <prefix>.<sidecar-ext> (Lightroom,
+ * iPhones, and video cameras). At most one sidecar of each kind is found
+ */
+func FindSidecars(fpath string) []string {
+	return FindDestinationSidecars(LocalDestination{}, fpath)
+}
+
+/*
+ * Find the sidecars copied alongside a media on a destination
+ */
+func FindDestinationSidecars(destination Destination, fpath string) []string {
+	prefix := strings.TrimSuffix(fpath, path.Ext(fpath))
+	sidecars := []string{}
+
+	for _, ext := range SidecarExtensions {
+		upper := strings.ToUpper(ext)
+		candidates := []string{fpath + ext, fpath + upper, prefix + ext, prefix + upper}
+
+		for _, candidate := range candidates {
+			if stat, err := destination.Stat(candidate); err == nil && stat.Mode().IsRegular() {
+				sidecars = append(sidecars, candidate)
+				break
+			}
+		}
+	}
+
+	return sidecars
+}
+
+/*
+ * Remove a sidecar from a media's sidecars
+ */
+func (media *Media) DetachSidecar(sidecar string) {
+	kept := []string{}
+
+	for _, candidate := range media.sidecars {
+		if candidate != sidecar {
+			kept = append(kept, candidate)
+		}
+	}
+
+	media.sidecars = kept
+}
+
+/*
+ * Attach each media's sidecars to it. A <prefix>.<sidecar-ext> sidecar is shared by every media
+ * with that prefix, so it's attached once; to the RAW image if there is one, as that's what
+ * develop-settings describe
+ */
+func (library *MediaList) AttachSidecars() {
+	owners := make(map[string]*Media)
+
+	for _, media := range library.Values() {
+		kind := media.GetType()
+
+		for _, sidecar := range FindSidecars(media.source) {
+			owner, claimed := owners[sidecar]
+			if claimed && !(kind == RAW && owner.GetType() != RAW) {
+				continue
+			}
+
+			if claimed {
+				owner.DetachSidecar(sidecar)
+			}
+
+			media.sidecars = append(media.sidecars, sidecar)
+			owners[sidecar] = media
+		}
+	}
+}
+
+/*
+ * Get the path a sidecar is copied to, matching its media's destination name
+ */
+func (media *Media) GetSidecarDestination(sidecar string, dest string) string {
+	ext := path.Ext(sidecar)
+
+	// darktable-style sidecars keep the image's extension in their name
+	if strings.TrimSuffix(sidecar, ext) == media.source {
+		return dest + ext
+	}
+
+	return strings.TrimSuffix(dest, path.Ext(dest)) + ext
+}
+
+/*
+ * Copy (or link) a sidecar next to its media's destination
+ */
+func CopySidecar(media *Media, sidecar string, dest string, link LinkMode) error {
+	sidecarDest := media.GetSidecarDestination(sidecar, dest)
+	destination := media.GetDestination()
+
+	if link == HARD_LINK || link == REFLINK {
+		err := LinkFile(link, sidecar, sidecarDest)
+		if errors.Is(err, os.ErrExist) {
+			return nil
+		}
+
+		return err
+	}
+
+	if link == SYMLINK {
+		target, err := filepath.Abs(sidecar)
+		if err != nil {
+			return err
+		}
+
+		err = destination.Symlink(target, sidecarDest)
+		if errors.Is(err, os.ErrExist) {
+			return nil
+		}
+
+		return err
+	}
+
+	source, err := os.Open(sidecar)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	target, err := destination.Create(sidecarDest)
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(target, source); err != nil {
+		target.Close()
+		destination.Remove(sidecarDest)
+		return err
+	}
+
+	return target.Close()
+}
+
+/*
+ * Copy (or link) each of a media's sidecars next to the media's destination
+ */
+func CopySidecars(media *Media, dest string, link LinkMode) error {
+	for _, sidecar := range media.sidecars {
+		if err := CopySidecar(media, sidecar, dest, link); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
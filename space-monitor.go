@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// How often free-space is re-checked while copying
+const SpaceCheckInterval = 30 * time.Second
+
+// Free-space kept back for the database and thumbnails, which aren't counted in the library size
+const SpaceMargin = 64 * 1024 * 1024
+
+// Returned when the destination has (or is about to have) too little free-space to continue
+var ErrOutOfSpace = errors.New("not enough free-space left on the destination")
+
+/*
+ * Did copying fail because the destination ran out of space?
+ */
+func IsOutOfSpace(err error) bool {
+	return errors.Is(err, syscall.ENOSPC) || errors.Is(err, ErrOutOfSpace)
+}
+
+// Tracks the bytes left to copy during a run, and periodically checks they still fit on the destination
+type SpaceMonitor struct {
+	destination Destination
+	dir         string
+	remaining   int64
+	lastCheck   time.Time
+	lock        sync.Mutex
+}
+
+/*
+ * Start monitoring free-space for a run copying `size` bytes
+ */
+func NewSpaceMonitor(destination Destination, dir string, size int64) *SpaceMonitor {
+	return &SpaceMonitor{
+		destination: destination,
+		dir:         dir,
+		remaining:   size,
+		lastCheck:   time.Now(),
+	}
+}
+
+/*
+ * Mark a media as done, whether it was copied or not
+ */
+func (monitor *SpaceMonitor) Done(media *Media) {
+	if monitor == nil {
+		return
+	}
+
+	monitor.lock.Lock()
+	defer monitor.lock.Unlock()
+
+	monitor.remaining -= media.size
+}
+
+/*
+ * Check the remaining media still fit on the destination, at most once per check interval. Failing
+ * to read the free-space isn't fatal; the copy itself will fail if the drive fills
+ */
+func (monitor *SpaceMonitor) Check() error {
+	if monitor == nil {
+		return nil
+	}
+
+	monitor.lock.Lock()
+	defer monitor.lock.Unlock()
+
+	if time.Since(monitor.lastCheck) < SpaceCheckInterval {
+		return nil
+	}
+
+	monitor.lastCheck = time.Now()
+
+	free, err := monitor.destination.FreeSpace(monitor.dir)
+	if err != nil {
+		return nil
+	}
+
+	if monitor.remaining > 0 && free < uint64(monitor.remaining)+SpaceMargin {
+		return ErrOutOfSpace
+	}
+
+	return nil
+}
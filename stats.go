@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+)
+
+// Counts of the media in a library sharing a value, like an ISO
+type Histogram map[string]int
+
+// The media recorded in one cluster-folder
+type ClusterStats struct {
+	Folder       string `json:"folder"`
+	Files        int    `json:"files"`
+	Skipped      int    `json:"skipped"`
+	Bytes        int64  `json:"bytes"`
+	FirstCapture string `json:"firstCapture"`
+	LastCapture  string `json:"lastCapture"`
+}
+
+// The spread of blur-scores across graded photos
+type BlurStats struct {
+	Graded int `json:"graded"`
+	Min    int `json:"min"`
+	P25    int `json:"p25"`
+	Median int `json:"median"`
+	P75    int `json:"p75"`
+	Max    int `json:"max"`
+}
+
+// A summary of a destination library, from its metadata database
+type LibraryStats struct {
+	Files        int            `json:"files"`
+	Skipped      int            `json:"skipped"`
+	Bytes        int64          `json:"bytes"`
+	FirstCapture string         `json:"firstCapture"`
+	LastCapture  string         `json:"lastCapture"`
+	Clusters     []ClusterStats `json:"clusters"`
+	Blur         BlurStats      `json:"blur"`
+	Iso          Histogram      `json:"iso"`
+	ShutterSpeed Histogram      `json:"shutterSpeed"`
+}
+
+/*
+ * Widen a capture-time range to include a time. Capture times are RFC3339 UTC timestamps,
+ * so they compare as text; rows written by older versions of badger have none
+ */
+func WidenRange(first *string, last *string, captureTime string) {
+	if len(captureTime) == 0 {
+		return
+	}
+
+	if len(*first) == 0 || captureTime < *first {
+		*first = captureTime
+	}
+
+	if len(*last) == 0 || captureTime > *last {
+		*last = captureTime
+	}
+}
+
+/*
+ * Get the spread of a set of blur-scores
+ */
+func NewBlurStats(blurs []int) BlurStats {
+	if len(blurs) == 0 {
+		return BlurStats{}
+	}
+
+	sort.Ints(blurs)
+
+	quantile := func(q float64) int {
+		return blurs[int(q*float64(len(blurs)-1))]
+	}
+
+	return BlurStats{
+		Graded: len(blurs),
+		Min:    blurs[0],
+		P25:    quantile(0.25),
+		Median: quantile(0.5),
+		P75:    quantile(0.75),
+		Max:    blurs[len(blurs)-1],
+	}
+}
+
+/*
+ * Summarise the media recorded in a library, grouped by the cluster-folder they were copied into
+ */
+func NewLibraryStats(dbDir string, rows []StatsRow) *LibraryStats {
+	stats := &LibraryStats{
+		Clusters:     []ClusterStats{},
+		Iso:          Histogram{},
+		ShutterSpeed: Histogram{},
+	}
+
+	byFolder := make(map[string]*ClusterStats)
+	folders := []string{}
+	blurs := []int{}
+
+	for _, row := range rows {
+		folder, err := filepath.Rel(dbDir, filepath.Dir(row.dst))
+		if err != nil {
+			folder = filepath.Dir(row.dst)
+		}
+
+		cluster, ok := byFolder[folder]
+		if !ok {
+			cluster = &ClusterStats{Folder: folder}
+			byFolder[folder] = cluster
+			folders = append(folders, folder)
+		}
+
+		cluster.Files += 1
+		stats.Files += 1
+
+		if row.skipped {
+			cluster.Skipped += 1
+			stats.Skipped += 1
+		} else {
+			cluster.Bytes += row.size
+			stats.Bytes += row.size
+		}
+
+		WidenRange(&cluster.FirstCapture, &cluster.LastCapture, row.captureTime)
+		WidenRange(&stats.FirstCapture, &stats.LastCapture, row.captureTime)
+
+		if row.mediaType != PHOTO && row.mediaType != RAW {
+			continue
+		}
+
+		blurs = append(blurs, row.blur)
+
+		if len(row.iso) > 0 {
+			stats.Iso[row.iso] += 1
+		}
+
+		if len(row.shutterSpeed) > 0 {
+			stats.ShutterSpeed[row.shutterSpeed] += 1
+		}
+	}
+
+	sort.Strings(folders)
+
+	for _, folder := range folders {
+		stats.Clusters = append(stats.Clusters, *byFolder[folder])
+	}
+
+	stats.Blur = NewBlurStats(blurs)
+
+	return stats
+}
+
+/*
+ * Get a histogram's values, most common first
+ */
+func (histogram Histogram) Keys() []string {
+	keys := make([]string, 0, len(histogram))
+	for key := range histogram {
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if histogram[keys[i]] != histogram[keys[j]] {
+			return histogram[keys[i]] > histogram[keys[j]]
+		}
+
+		return keys[i] < keys[j]
+	})
+
+	return keys
+}
+
+/*
+ * Print a library summary for people to read
+ */
+func PrintStats(stats *LibraryStats) {
+	fmt.Printf("badger: %v files (%v skipped), %v, captured %v to %v\n",
+		stats.Files, stats.Skipped, HumanizeBytes(uint64(stats.Bytes)), stats.FirstCapture, stats.LastCapture)
+
+	fmt.Println("\nclusters:")
+	for _, cluster := range stats.Clusters {
+		fmt.Printf("\t%v\t%v files (%v skipped)\t%v\t%v to %v\n",
+			cluster.Folder, cluster.Files, cluster.Skipped, HumanizeBytes(uint64(cluster.Bytes)), cluster.FirstCapture, cluster.LastCapture)
+	}
+
+	blur := stats.Blur
+	fmt.Printf("\nblur: min %v, p25 %v, median %v, p75 %v, max %v (%v graded)\n",
+		blur.Min, blur.P25, blur.Median, blur.P75, blur.Max, blur.Graded)
+
+	fmt.Println("\niso:")
+	for _, iso := range stats.Iso.Keys() {
+		fmt.Printf("\t%v\t%v\n", iso, stats.Iso[iso])
+	}
+
+	fmt.Println("\nshutter-speed:")
+	for _, speed := range stats.ShutterSpeed.Keys() {
+		fmt.Printf("\t%v\t%v\n", speed, stats.ShutterSpeed[speed])
+	}
+}
+
+/*
+ * Summarise a destination library from its metadata database, without reading the source media
+ */
+func Stats(dbDir string, asJson bool) int {
+	conn, err := NewSqliteDB(dbDir)
+	bail(err)
+
+	db := BadgerDb{conn}
+	defer db.Close()
+
+	// databases written by older versions of badger need size and capture-time columns
+	err = db.CreateTables()
+	bail(err)
+
+	rows, err := db.ListStatsRows()
+	bail(err)
+
+	stats := NewLibraryStats(dbDir, rows)
+
+	if !asJson {
+		PrintStats(stats)
+		return 0
+	}
+
+	content, err := json.MarshalIndent(stats, "", "  ")
+	bail(err)
+
+	fmt.Println(string(content))
+
+	return 0
+}
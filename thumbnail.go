@@ -0,0 +1,105 @@
+package main
+
+import (
+	"image"
+	"image/jpeg"
+	"math"
+	"path/filepath"
+	"strings"
+
+	"github.com/Ernyoke/Imger/resize"
+)
+
+// Thumbnails are written under this folder in the destination, mirroring the cluster-folders
+const ThumbnailDir = ".thumbs"
+
+// Scale thumbnails so their longest edge is at most this many pixels
+const ThumbnailMaxEdge = 512
+
+const ThumbnailQuality = 80
+
+/*
+ * Get the path of a media's thumbnail; its destination path under the thumbnail folder, as a jpeg
+ */
+func (media *Media) GetThumbnailPath() string {
+	dest := media.GetDestinationPath()
+
+	rel, err := filepath.Rel(media.dstDir, dest)
+	if err != nil {
+		rel = filepath.Base(dest)
+	}
+
+	return filepath.Join(media.dstDir, ThumbnailDir, strings.TrimSuffix(rel, filepath.Ext(rel))+".jpg")
+}
+
+/*
+ * Scale an image down so its longest edge is at most `maxEdge` pixels
+ */
+func ScaleToFit(img *image.RGBA, maxEdge int) (*image.RGBA, error) {
+	bounds := img.Bounds()
+	longest := math.Max(float64(bounds.Dx()), float64(bounds.Dy()))
+
+	if longest <= float64(maxEdge) {
+		return img, nil
+	}
+
+	scale := float64(maxEdge) / longest
+
+	return resize.ResizeRGBA(img, scale, scale, resize.InterLinear)
+}
+
+/*
+ * Scale a grayscale image down so its longest edge is at most `maxEdge` pixels
+ */
+func ScaleGrayToFit(img *image.Gray, maxEdge int) (*image.Gray, error) {
+	bounds := img.Bounds()
+	longest := math.Max(float64(bounds.Dx()), float64(bounds.Dy()))
+
+	if longest <= float64(maxEdge) {
+		return img, nil
+	}
+
+	scale := float64(maxEdge) / longest
+
+	return resize.ResizeGray(img, scale, scale, resize.InterLinear)
+}
+
+/*
+ * Write a small jpeg preview of a photo or RAW image, unless one already exists. Returns the thumbnail path
+ */
+func MakeThumbnail(media *Media) (string, error) {
+	thumbPath := media.GetThumbnailPath()
+	destination := media.GetDestination()
+
+	if _, err := destination.Stat(thumbPath); err == nil {
+		return thumbPath, nil
+	}
+
+	img, err := media.ReadRGBA()
+	if err != nil {
+		return "", err
+	}
+
+	thumb, err := ScaleToFit(img, ThumbnailMaxEdge)
+	if err != nil {
+		return "", err
+	}
+
+	err = destination.MkdirAll(filepath.Dir(thumbPath))
+	if err != nil {
+		return "", err
+	}
+
+	file, err := destination.Create(thumbPath)
+	if err != nil {
+		return "", err
+	}
+
+	if err = jpeg.Encode(file, thumb, &jpeg.Options{Quality: ThumbnailQuality}); err != nil {
+		file.Close()
+		destination.Remove(thumbPath)
+		return "", err
+	}
+
+	return thumbPath, file.Close()
+}
@@ -2,41 +2,89 @@ package main
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/rivo/tview"
 )
 
 type TUI struct {
-	app        *tview.Application
-	facts      *Facts
-	photoCount int
-	rawCount   int
-	videoCount int
+	app      *tview.Application
+	summary  *tview.TextView
+	stats    *ProgressStats
+	lastDraw time.Time
+	running  bool
+	crashed  chan error
 }
 
 /*
- * Create a progress-bar
+ * Create a terminal UI showing copy progress
  */
-func NewProgressBar(count int64, facts *Facts) *TUI {
-	tui := TUI{}
-
+func NewTUI(facts *Facts) *TUI {
 	app := tview.NewApplication()
 	app.EnableMouse(false)
 
-	tui.app = app
+	summary := tview.NewTextView()
+	summary.SetBorder(true).SetTitle(" Badger 🦡 ")
 
-	return &tui
+	return &TUI{
+		app:     app,
+		summary: summary,
+		stats:   NewProgressStats(facts),
+		crashed: make(chan error, 1),
+	}
 }
 
 /*
  * Receive a media item,and update the progress bar
  */
 func (tui *TUI) Update(media *Media) {
+	tui.stats.Add(media)
 
+	if !tui.running {
+		return
+	}
+
+	if tui.stats.copiedCount < tui.stats.facts.Count && time.Since(tui.lastDraw) < ProgressInterval {
+		return
+	}
+
+	tui.lastDraw = time.Now()
+	text := tui.SummaryText()
+
+	// updates block until the application draws them, so stop drawing if it crashed
+	select {
+	case err := <-tui.crashed:
+		tui.running = false
+		fmt.Printf("Badger: Application crashed! %v", err)
+	default:
+		tui.app.QueueUpdateDraw(func() {
+			tui.summary.SetText(text)
+		})
+	}
 }
 
-func (tui *TUI) SummaryText() *tview.TextView {
-	return tview.NewTextView()
+/*
+ * Describe copy progress, against the facts gathered about the library
+ */
+func (tui *TUI) SummaryText() string {
+	stats := tui.stats
+	progress := stats.Progress()
+
+	return fmt.Sprintf(
+		"Copied %.1f%%\n\n"+
+			"%v of %v\n"+
+			"%v per second\n"+
+			"%.0f seconds remaining\n\n"+
+			"%v of %v photos\n"+
+			"%v of %v raw images\n"+
+			"%v of %v videos\n",
+		progress.Percentage,
+		HumanizeBytes(uint64(stats.copiedSize)), HumanizeBytes(uint64(stats.facts.Size)),
+		HumanizeBytes(uint64(progress.RateMB*1e6)),
+		progress.Eta,
+		stats.photoCount, stats.facts.PhotoCount,
+		stats.rawCount, stats.facts.RawCount,
+		stats.videoCount, stats.facts.VideoCount)
 }
 
 /*
@@ -44,19 +92,32 @@ func (tui *TUI) SummaryText() *tview.TextView {
  */
 func (tui *TUI) Grid() *tview.Grid {
 	return tview.NewGrid().
-		SetRows(1).SetColumns(1, 1).AddItem(tui.SummaryText(), 1, 1, 2, 1, 1, 1, true)
+		SetRows(0).SetColumns(0).AddItem(tui.summary, 0, 0, 1, 1, 0, 0, false)
 }
 
 /*
- * Stat the tcell progress-bar
+ * Start the terminal UI in the background
  */
-func (tui *TUI) Start() int {
+func (tui *TUI) Start() {
 	grid := tui.Grid()
+	tui.summary.SetText(tui.SummaryText())
+	tui.running = true
 
-	if err := tui.app.SetRoot(grid, true).SetFocus(grid).Run(); err != nil {
-		fmt.Printf("Badger: Application crashed! %v", err)
-		return 1
+	go func() {
+		if err := tui.app.SetRoot(grid, true).Run(); err != nil {
+			tui.crashed <- err
+		}
+	}()
+}
+
+/*
+ * Stop the terminal UI, and restore the terminal
+ */
+func (tui *TUI) Done() {
+	if !tui.running {
+		return
 	}
 
-	return 0
+	tui.running = false
+	tui.app.Stop()
 }
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/manifoldco/promptui"
+)
+
+/*
+ * Parse a --since value, either a date like 2021-07-04 or a time like 2021-07-04T15:04:05Z,
+ * into a run id that can be compared against stored run ids
+ */
+func ParseSince(text string) (string, error) {
+	since, _, err := ParseDate(text)
+	if err != nil {
+		return "", err
+	}
+
+	return NewRunId(since), nil
+}
+
+/*
+ * Ask whether the user wants to remove copied media
+ */
+func PromptUndo(count int, filter RunFilter, yes bool) (bool, error) {
+	fmt.Printf("Badger 🦡\n\nBadger will remove %v files copied %v\n", count, filter)
+
+	if yes {
+		return true, nil
+	}
+
+	prompt := promptui.Select{
+		Label: "Would you like to proceed?",
+		Items: []string{"yes", "no"},
+	}
+
+	_, result, err := prompt.Run()
+	if err != nil {
+		if err.Error() == "^C" {
+			return false, nil
+		} else {
+			return false, fmt.Errorf("badger: failed to read user prompt: %v", err)
+		}
+	}
+
+	return result == "yes", nil
+}
+
+/*
+ * Remove media copied by the filtered runs (or by the latest run, if the filter is empty), and
+ * forget them. When `unchangedOnly` is set, files edited since they were copied are kept
+ */
+func Undo(dbDir string, filter RunFilter, unchangedOnly bool, yes bool) int {
+	// a mistyped --db mustn't create an empty database, so it's only opened to write once confirmed
+	db, err := OpenReadOnlyDb(dbDir)
+	bail(err)
+	defer db.Close()
+
+	if filter == (RunFilter{}) {
+		filter.runId, err = db.LatestRunId()
+		bail(err)
+
+		if len(filter.runId) == 0 {
+			fmt.Println("badger: no runs are recorded in this database; nothing to undo")
+			return 0
+		}
+	}
+
+	// copies into remote destinations are removed over SFTP
+	destination, dstDir, err := OpenRunDestination(db, filter, dbDir)
+	bail(err)
+	defer destination.Close()
+
+	rows, err := db.ListRunMedia(filter)
+	bail(err)
+
+	for idx := range rows {
+		rows[idx].dst = ResolveStoredPath(rows[idx].dst, rows[idx].to, dstDir)
+		rows[idx].thumbnail = ResolveStoredPath(rows[idx].thumbnail, rows[idx].to, dstDir)
+	}
+
+	copied := make(map[string]bool)
+	for _, row := range rows {
+		if !row.skipped {
+			copied[row.dst] = true
+		}
+	}
+
+	proceed, err := PromptUndo(len(copied), filter, yes)
+	bail(err)
+
+	if !proceed {
+		return 0
+	}
+
+	writable, err := OpenWritableDb(dbDir)
+	bail(err)
+	defer writable.Close()
+
+	removed := 0
+	kept := 0
+	dirs := make(map[string]bool)
+	deleted := make(map[string]bool)
+
+	for _, row := range rows {
+		// several rows can share a destination, e.g a raw image and its jpeg
+		if !row.skipped && !deleted[row.dst] {
+			// the source of moved media is gone, so removing the destination would lose it
+			if row.moved {
+				fmt.Printf("kept: %v (moved from %v; it's the only copy)\n", row.dst, row.src)
+				kept += 1
+				continue
+			}
+
+			if unchangedOnly {
+				result := VerifyRow(destination, row.StoredMediaRow)
+
+				if result.status == CHANGED || result.status == UNREADABLE {
+					fmt.Printf("kept: %v (%v since it was copied)\n", row.dst, result.status)
+					kept += 1
+					continue
+				}
+			}
+
+			err := destination.Remove(row.dst)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				fmt.Printf("kept: %v (%v)\n", row.dst, err)
+				kept += 1
+				continue
+			}
+
+			deleted[row.dst] = true
+			dirs[filepath.Dir(row.dst)] = true
+			removed += 1
+
+			// sidecars and thumbnails were only made for the copy, so would be left orphaned
+			leftovers := FindDestinationSidecars(destination, row.dst)
+			if len(row.thumbnail) > 0 {
+				leftovers = append(leftovers, row.thumbnail)
+				dirs[filepath.Join(dstDir, ThumbnailDir)] = true
+			}
+
+			for _, leftover := range leftovers {
+				if err := destination.Remove(leftover); err == nil {
+					dirs[filepath.Dir(leftover)] = true
+				}
+			}
+		}
+
+		err = writable.DeleteMedia(row.src, row.hash)
+		bail(err)
+	}
+
+	// remove cluster-folders the undo emptied; removing a folder that isn't empty fails, and is ignored.
+	// Thumbnail folders are removed before the cluster-folders that contain them, and --layout date-folders after
+	emptied := make(map[string]bool)
+	for dir := range dirs {
+		emptied[dir] = true
+
+		for parent := filepath.Dir(dir); IsWithin(dstDir, parent); parent = filepath.Dir(parent) {
+			emptied[parent] = true
+		}
+	}
+
+	dirList := []string{}
+	for dir := range emptied {
+		dirList = append(dirList, dir)
+	}
+
+	sort.Slice(dirList, func(idx, jdx int) bool {
+		return len(dirList[idx]) > len(dirList[jdx])
+	})
+
+	for _, dir := range dirList {
+		if filepath.Clean(dir) != filepath.Clean(dstDir) {
+			destination.Remove(dir)
+		}
+	}
+
+	fmt.Printf("badger: removed %v files copied %v; kept %v\n", removed, filter, kept)
+
+	if kept > 0 {
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+/*
+ * Undoing a run that skipped existing destinations leaves them be; they're removed by undoing the
+ * run that copied them
+ */
+func TestUndoKeepsMediaSkippedAsExisting(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+
+	for idx, name := range []string{"a.png", "b.png", "c.png"} {
+		WriteTestImage(t, filepath.Join(src, name), true, idx)
+	}
+
+	first := NewTestCopyOpts(t, []string{filepath.Join(src, "*.png")}, dst)
+	if code := Copy(first, MediaFilter{kind: "all"}); code != 0 {
+		t.Fatalf("expected the first copy to succeed, got exit code %v", code)
+	}
+
+	copied, err := filepath.Glob(filepath.Join(dst, "*.png"))
+	if err != nil || len(copied) != 3 {
+		t.Fatalf("expected three copies, got %v (%v)", copied, err)
+	}
+
+	second := NewTestCopyOpts(t, []string{filepath.Join(src, "*.png")}, dst)
+	second.onExists = SKIP_EXISTING
+
+	if code := Copy(second, MediaFilter{kind: "all"}); code != 0 {
+		t.Fatalf("expected the second copy to succeed, got exit code %v", code)
+	}
+
+	if code := Undo(dst, RunFilter{runId: second.runId}, false, true); code != 0 {
+		t.Fatalf("expected undo to succeed, got exit code %v", code)
+	}
+
+	for _, fpath := range copied {
+		if _, err := os.Stat(fpath); err != nil {
+			t.Errorf("expected %v to survive undoing a run that skipped it: %v", fpath, err)
+		}
+	}
+
+	if code := Undo(dst, RunFilter{runId: first.runId}, false, true); code != 0 {
+		t.Fatalf("expected undo to succeed, got exit code %v", code)
+	}
+
+	for _, fpath := range copied {
+		if _, err := os.Stat(fpath); !os.IsNotExist(err) {
+			t.Errorf("expected %v to be removed by undoing the run that copied it", fpath)
+		}
+	}
+}
+
+/*
+ * Copies made into a relative --to are still undone from another working directory
+ */
+func TestUndoFromAnotherDirectory(t *testing.T) {
+	src := t.TempDir()
+	root := t.TempDir()
+
+	for idx, name := range []string{"a.png", "b.png"} {
+		WriteTestImage(t, filepath.Join(src, name), true, idx)
+	}
+
+	ChdirTest(t, root)
+
+	opts := NewTestCopyOpts(t, []string{filepath.Join(src, "*.png")}, "library")
+	if code := Copy(opts, MediaFilter{kind: "all"}); code != 0 {
+		t.Fatalf("expected the copy to succeed, got exit code %v", code)
+	}
+
+	copied, err := filepath.Glob(filepath.Join(root, "library", "*.png"))
+	if err != nil || len(copied) != 2 {
+		t.Fatalf("expected two copies, got %v (%v)", copied, err)
+	}
+
+	ChdirTest(t, t.TempDir())
+
+	if code := Undo(filepath.Join(root, "library"), RunFilter{}, false, true); code != 0 {
+		t.Fatalf("expected undo to succeed, got exit code %v", code)
+	}
+
+	for _, fpath := range copied {
+		if _, err := os.Stat(fpath); !os.IsNotExist(err) {
+			t.Errorf("expected %v to be removed", fpath)
+		}
+	}
+}
+
+/*
+ * Undoing with a mistyped --db fails, rather than creating a database there
+ */
+func TestUndoRequiresDatabase(t *testing.T) {
+	dir := t.TempDir()
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected undo to fail without a database")
+			}
+		}()
+
+		Undo(dir, RunFilter{}, false, true)
+	}()
+
+	if _, err := os.Stat(filepath.Join(dir, ".badger_metadata.sqlite")); !os.IsNotExist(err) {
+		t.Error("expected undo not to create a database")
+	}
+}
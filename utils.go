@@ -2,11 +2,21 @@ package main
 
 import (
 	"crypto/md5"
+	"crypto/sha256"
 	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
 	"io"
+	"math"
 	"os"
+	"strconv"
+	"time"
 
+	"github.com/cespare/xxhash/v2"
+	"github.com/zeebo/xxh3"
 	"golang.org/x/sys/unix"
+	"lukechampine.com/blake3"
 )
 
 // Bundles a value error pair
@@ -27,23 +37,152 @@ func GetFreeSpace(fpath string) (uint64, error) {
 	return stat.Bavail * uint64(stat.Bsize), nil
 }
 
+/*
+ * Format a byte-count for people to read, in bytes, KB, MB, GB or TB (powers of 1000). Two
+ * decimals are shown for values under ten, and one otherwise; e.g 1.25 GB, or 700.0 MB
+ */
+func HumanizeBytes(bytes uint64) string {
+	if bytes < 1000 {
+		return fmt.Sprintf("%v bytes", bytes)
+	}
+
+	units := []string{"KB", "MB", "GB", "TB"}
+	value := float64(bytes) / 1000
+	unit := 0
+
+	// round first, so 999.99 MB is shown as 1.00 GB rather than 1000.0 MB
+	for unit < len(units)-1 && math.Round(value*10)/10 >= 1000 {
+		value /= 1000
+		unit += 1
+	}
+
+	if value < 10 {
+		return fmt.Sprintf("%.2f %v", value, units[unit])
+	}
+
+	return fmt.Sprintf("%.1f %v", value, units[unit])
+}
+
+/*
+ * Parse a number of seconds, or a Go duration-string like 30m or 2h, into seconds
+ */
+func ParseSeconds(text string) (float64, error) {
+	if seconds, err := strconv.ParseFloat(text, 64); err == nil {
+		return seconds, nil
+	}
+
+	duration, err := time.ParseDuration(text)
+	if err != nil {
+		return 0, fmt.Errorf("badger: could not parse '%v' as seconds or a duration like 90s, 30m or 2h", text)
+	}
+
+	return duration.Seconds(), nil
+}
+
+// Algorithms files can be hashed with
+type HashAlgorithm string
+
+const (
+	MD5    HashAlgorithm = "md5"
+	SHA256 HashAlgorithm = "sha256"
+	XXH64  HashAlgorithm = "xxh64"
+	XXH3   HashAlgorithm = "xxh3"
+	BLAKE3 HashAlgorithm = "blake3"
+)
+
+/*
+ * Parse a --hash algorithm name
+ */
+func ParseHashAlgorithm(name string) (HashAlgorithm, error) {
+	switch algorithm := HashAlgorithm(name); algorithm {
+	case MD5, SHA256, XXH64, XXH3, BLAKE3:
+		return algorithm, nil
+	}
+
+	return "", fmt.Errorf("badger: unsupported --hash '%v'; expected one of md5, sha256, xxh64, xxh3 or blake3", name)
+}
+
+/*
+ * Construct a hasher for an algorithm
+ */
+func NewHasher(algorithm HashAlgorithm) (hash.Hash, error) {
+	switch algorithm {
+	case MD5:
+		return md5.New(), nil
+	case SHA256:
+		return sha256.New(), nil
+	case XXH64:
+		return xxhash.New(), nil
+	case XXH3:
+		return xxh3.New(), nil
+	case BLAKE3:
+		return blake3.New(32, nil), nil
+	}
+
+	return nil, fmt.Errorf("badger: unsupported hash algorithm '%v'", algorithm)
+}
+
 /*
  * Hash a file
  *
  */
-func GetHash(fpath string) (string, error) {
+func GetHash(fpath string, algorithm HashAlgorithm) (string, error) {
 	file, err := os.Open(fpath)
 	if err != nil {
 		return "", err
 	}
 	defer file.Close()
 
-	hash := md5.New()
-	if _, err := io.Copy(hash, file); err != nil {
+	return HashReader(file, algorithm)
+}
+
+/*
+ * Hash everything read from a reader
+ */
+func HashReader(reader io.Reader, algorithm HashAlgorithm) (string, error) {
+	hasher, err := NewHasher(algorithm)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := io.Copy(hasher, reader); err != nil {
 		return "", err
 	}
 
-	hashSum := hex.EncodeToString(hash.Sum(nil))
+	hashSum := hex.EncodeToString(hasher.Sum(nil))
 
 	return hashSum, nil
 }
+
+// The first delay between retries; each later retry waits twice as long
+const RetryBaseDelay = 250 * time.Millisecond
+
+// Returned when badger is asked to copy something that isn't a plain file
+var ErrNotRegularFile = errors.New("not a regular file")
+
+/*
+ * Is an error one that retrying won't fix, like a missing file, an impossible link or a full drive?
+ */
+func IsPermanentError(err error) bool {
+	return errors.Is(err, os.ErrNotExist) || errors.Is(err, ErrNotRegularFile) || errors.Is(err, ErrCantLink) || IsOutOfSpace(err)
+}
+
+/*
+ * Call fn, retrying up to `retries` times with exponential backoff while it fails
+ * transiently. Returns the number of attempts made, and the last error
+ */
+func Retry(retries int, fn func() error) (int, error) {
+	delay := RetryBaseDelay
+	attempt := 1
+
+	for {
+		err := fn()
+		if err == nil || attempt > retries || IsPermanentError(err) {
+			return attempt, err
+		}
+
+		time.Sleep(delay)
+		delay *= 2
+		attempt += 1
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHumanizeBytes(t *testing.T) {
+	// sizes are shown in decimal units, so a KiB is slightly over a KB
+	cases := []struct {
+		bytes    uint64
+		expected string
+	}{
+		{0, "0 bytes"},
+		{999, "999 bytes"},
+		{1000, "1.00 KB"},
+		{1023, "1.02 KB"},
+		{1024, "1.02 KB"},
+		{99_949, "99.9 KB"},
+		{999_949, "999.9 KB"},
+		{999_950, "1.00 MB"},
+		{1024*1024 - 1, "1.05 MB"},
+		{1024*1024*1024 - 1, "1.07 GB"},
+		{1024 * 1024 * 1024, "1.07 GB"},
+		{1_000_000_000_000_000, "1000.0 TB"},
+	}
+
+	for _, tc := range cases {
+		if actual := HumanizeBytes(tc.bytes); actual != tc.expected {
+			t.Errorf("expected HumanizeBytes(%v) to be %v, but was %v", tc.bytes, tc.expected, actual)
+		}
+	}
+}
+
+// The size of the file hashed by benchmarks; roughly a high-resolution jpeg
+const BenchmarkFileSize = 16 * 1024 * 1024
+
+func BenchmarkGetHash(b *testing.B) {
+	content := make([]byte, BenchmarkFileSize)
+	rand.New(rand.NewSource(1)).Read(content)
+
+	fpath := filepath.Join(b.TempDir(), "IMG_0001.jpg")
+	if err := os.WriteFile(fpath, content, 0644); err != nil {
+		b.Fatal(err)
+	}
+
+	for _, algorithm := range []HashAlgorithm{MD5, SHA256, XXH64, XXH3, BLAKE3} {
+		b.Run(string(algorithm), func(b *testing.B) {
+			b.SetBytes(BenchmarkFileSize)
+
+			for idx := 0; idx < b.N; idx++ {
+				if _, err := GetHash(fpath, algorithm); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
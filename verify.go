@@ -0,0 +1,247 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+type VerifyStatus string
+
+const (
+	VERIFIED   VerifyStatus = "verified"
+	MISSING                 = "missing"
+	CHANGED                 = "changed"
+	UNREADABLE              = "unreadable"
+)
+
+// Returned when a copy, re-read with --verify, doesn't match its source
+var ErrCopyMismatch = errors.New("the copy doesn't match its source")
+
+// The outcome of checking a copied file against its stored hash
+type VerifyResult struct {
+	row    StoredMediaRow
+	status VerifyStatus
+	err    error
+}
+
+/*
+ * Re-read a media's copy and compare it to the source's hash, removing the copy if it differs
+ */
+func (media *Media) VerifyCopy() error {
+	same, err := media.SameAsDestination()
+	if err != nil {
+		return err
+	}
+
+	if !same {
+		media.GetDestination().Remove(media.GetDestinationPath())
+		return fmt.Errorf("%w: %v", ErrCopyMismatch, media.GetDestinationPath())
+	}
+
+	return nil
+}
+
+/*
+ * Re-hash a copied file on its destination, and compare it to the hash stored when it was copied
+ */
+func VerifyRow(destination Destination, row StoredMediaRow) VerifyResult {
+	algorithm := row.hashAlgorithm
+
+	// rows written before --hash was selectable were hashed with md5
+	if len(algorithm) == 0 {
+		algorithm = MD5
+	}
+
+	file, err := destination.Open(row.dst)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return VerifyResult{row, MISSING, err}
+	}
+
+	if err != nil {
+		return VerifyResult{row, UNREADABLE, err}
+	}
+	defer file.Close()
+
+	hash, err := HashReader(file, algorithm)
+
+	if err != nil {
+		return VerifyResult{row, UNREADABLE, err}
+	}
+
+	if hash != row.hash {
+		return VerifyResult{row, CHANGED, nil}
+	}
+
+	return VerifyResult{row, VERIFIED, nil}
+}
+
+/*
+ * Verify each stored row with a pool of workers, and emit results to the output channel
+ */
+func VerifyRows(procCount int, destination Destination, rows []StoredMediaRow) chan VerifyResult {
+	results := make(chan VerifyResult, procCount)
+	jobs := make(chan StoredMediaRow, len(rows))
+	var wg sync.WaitGroup
+
+	for pid := 0; pid < procCount; pid++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for row := range jobs {
+				results <- VerifyRow(destination, row)
+			}
+		}()
+	}
+
+	for _, row := range rows {
+		jobs <- row
+	}
+	close(jobs)
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	return results
+}
+
+/*
+ * Find files in a destination library that no run recorded copying; the database itself,
+ * thumbnails, and sidecars copied next to recorded media aren't counted
+ */
+func FindExtraFiles(dbDir string, rows []StoredMediaRow) ([]string, error) {
+	known := make(map[string]bool)
+	prefixes := make(map[string]bool)
+
+	root, err := filepath.Abs(dbDir)
+	if err != nil {
+		return nil, err
+	}
+
+	// copies recorded relative to where badger ran are found relative to the database instead
+	for _, row := range rows {
+		dst := ResolveStoredPath(row.dst, row.to, root)
+
+		known[dst] = true
+		prefixes[strings.TrimSuffix(dst, filepath.Ext(dst))] = true
+	}
+
+	extra := []string{}
+
+	err = filepath.WalkDir(root, func(fpath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			if entry.Name() == ThumbnailDir {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if known[fpath] || strings.HasPrefix(entry.Name(), ".badger_metadata.sqlite") {
+			return nil
+		}
+
+		// sidecars are named after their image, with or without its extension
+		if IsSidecar(fpath) {
+			stem := strings.TrimSuffix(fpath, filepath.Ext(fpath))
+			if known[stem] || prefixes[stem] {
+				return nil
+			}
+		}
+
+		extra = append(extra, fpath)
+		return nil
+	})
+
+	return extra, err
+}
+
+/*
+ * Check a destination library against the hashes in its metadata database, and report files
+ * in the library that no run recorded copying. Extra files are reported, but don't fail verification
+ */
+func Verify(dbDir string, filter RunFilter, procCount int) int {
+	// the database is checked as it is; a mistyped --db mustn't pass as an empty library
+	db, err := OpenReadOnlyDb(dbDir)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	defer db.Close()
+
+	recordsMedia, err := db.HasTable("mediaData")
+	bail(err)
+
+	if !recordsMedia {
+		fmt.Printf("badger: the database in %v hasn't recorded any media\n", dbDir)
+		return 1
+	}
+
+	destination, dstDir, err := OpenRunDestination(db, filter, dbDir)
+	bail(err)
+	defer destination.Close()
+
+	rows, err := db.ListCopiedMedia(filter)
+	bail(err)
+
+	for idx := range rows {
+		rows[idx].dst = ResolveStoredPath(rows[idx].dst, rows[idx].to, dstDir)
+	}
+
+	counts := make(map[VerifyStatus]int)
+
+	for result := range VerifyRows(procCount, destination, rows) {
+		counts[result.status] += 1
+
+		switch result.status {
+		case CHANGED:
+			fmt.Printf("changed: %v (copied from %v)\n", result.row.dst, result.row.src)
+		case MISSING, UNREADABLE:
+			fmt.Printf("%v: %v (%v)\n", result.status, result.row.dst, result.err)
+		}
+	}
+
+	// every recorded copy is known, even when only some runs are verified. Remote destinations
+	// aren't walked, so their extra files aren't found
+	extra := []string{}
+
+	if _, local := destination.(LocalDestination); local {
+		recorded, err := db.ListCopiedMedia(RunFilter{})
+		bail(err)
+
+		extra, err = FindExtraFiles(dbDir, recorded)
+		bail(err)
+	} else {
+		fmt.Printf("badger: not looking for extra files in %v, as it's a remote destination\n", dstDir)
+	}
+
+	for _, fpath := range extra {
+		fmt.Printf("extra: %v\n", fpath)
+	}
+
+	failures := counts[MISSING] + counts[CHANGED] + counts[UNREADABLE]
+
+	fmt.Printf("badger: verified %v of %v files; %v missing, %v changed, %v unreadable, %v extra\n",
+		counts[VERIFIED], len(rows), counts[MISSING], counts[CHANGED], counts[UNREADABLE], len(extra))
+
+	if failures > 0 {
+		fmt.Println("badger: verification failed")
+		return 1
+	}
+
+	fmt.Println("badger: verification passed")
+	return 0
+}
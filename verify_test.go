@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+/*
+ * Verifying with a mistyped --db fails, rather than passing an empty database it created
+ */
+func TestVerifyRequiresDatabase(t *testing.T) {
+	dir := t.TempDir()
+
+	if code := Verify(dir, RunFilter{}, 2); code == 0 {
+		t.Error("expected verifying without a database to fail")
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, ".badger_metadata.sqlite")); !os.IsNotExist(err) {
+		t.Error("expected verify not to create a database")
+	}
+}
+
+/*
+ * Copies made into a relative --to are verified from another working directory
+ */
+func TestVerifyFromAnotherDirectory(t *testing.T) {
+	src := t.TempDir()
+	root := t.TempDir()
+
+	for idx, name := range []string{"a.png", "b.png"} {
+		WriteTestImage(t, filepath.Join(src, name), true, idx)
+	}
+
+	ChdirTest(t, root)
+
+	opts := NewTestCopyOpts(t, []string{filepath.Join(src, "*.png")}, "library")
+	if code := Copy(opts, MediaFilter{kind: "all"}); code != 0 {
+		t.Fatalf("expected the copy to succeed, got exit code %v", code)
+	}
+
+	ChdirTest(t, t.TempDir())
+
+	code := 0
+	output := CaptureStdout(t, func() {
+		code = Verify(filepath.Join(root, "library"), RunFilter{}, 2)
+	})
+
+	if code != 0 || !strings.Contains(output, "verified 2 of 2 files; 0 missing, 0 changed, 0 unreadable, 0 extra") {
+		t.Errorf("expected both copies to be verified, got exit code %v:\n%v", code, output)
+	}
+}
+
+/*
+ * Copies recorded relative to where an older badger ran are found relative to the database
+ */
+func TestFindExtraFilesResolvesRelativeCopies(t *testing.T) {
+	dir := t.TempDir()
+
+	db := NewTestRunDb(t, dir, "run", "library")
+	InsertTestRow(t, db, "/media/card/a.jpg", "library/a.jpg", "aaaa")
+
+	WriteTestFile(t, filepath.Join(dir, "a.jpg"), "photo")
+	WriteTestFile(t, filepath.Join(dir, "b.jpg"), "photo")
+
+	rows, err := db.ListCopiedMedia(RunFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	extra, err := FindExtraFiles(dir, rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(extra) != 1 || extra[0] != filepath.Join(dir, "b.jpg") {
+		t.Errorf("expected only b.jpg to be extra, got %v", extra)
+	}
+}
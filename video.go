@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+)
+
+// Seconds from the QuickTime epoch, 1904-01-01, to the unix epoch
+const QuickTimeEpochOffset = 2082844800
+
+/*
+ * Find a box in an ISO media file (MP4, MOV) between `start` and `end`, returning the offset
+ * and end of its content
+ */
+func FindBox(file io.ReadSeeker, start int64, end int64, name string) (int64, int64, error) {
+	header := make([]byte, 16)
+	offset := start
+
+	for offset+8 <= end {
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			return 0, 0, err
+		}
+
+		if _, err := io.ReadFull(file, header[:8]); err != nil {
+			return 0, 0, err
+		}
+
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		headerSize := int64(8)
+
+		switch size {
+		case 0:
+			// the box runs to the end of its parent
+			size = end - offset
+		case 1:
+			// the box has a 64-bit size after its name
+			if _, err := io.ReadFull(file, header[8:16]); err != nil {
+				return 0, 0, err
+			}
+
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+			headerSize = 16
+		}
+
+		if size < headerSize {
+			return 0, 0, errors.New("badger: malformed box in video file")
+		}
+
+		if string(header[4:8]) == name {
+			return offset + headerSize, offset + size, nil
+		}
+
+		offset += size
+	}
+
+	return 0, 0, errors.New("badger: no " + name + " box found in video file")
+}
+
+/*
+ * Read the creation time from an MP4 or MOV file's movie header (moov/mvhd), as a unix time
+ */
+func ReadVideoCreationTime(fpath string) (int, error) {
+	file, err := os.Open(fpath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	moovStart, moovEnd, err := FindBox(file, 0, stat.Size(), "moov")
+	if err != nil {
+		return 0, err
+	}
+
+	mvhdStart, _, err := FindBox(file, moovStart, moovEnd, "mvhd")
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := file.Seek(mvhdStart, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	// a version byte and three flag bytes, then a 32-bit creation time (version 0) or a 64-bit one
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(file, header); err != nil {
+		return 0, err
+	}
+
+	var created uint64
+	if header[0] == 1 {
+		created = binary.BigEndian.Uint64(header[4:12])
+	} else {
+		created = uint64(binary.BigEndian.Uint32(header[4:8]))
+	}
+
+	// cameras without a clock leave the creation time unset
+	if created <= QuickTimeEpochOffset {
+		return 0, errors.New("badger: no creation time recorded in " + fpath)
+	}
+
+	return int(created - QuickTimeEpochOffset), nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+)
+
+/*
+ * Get the arguments for clustering a watched folder into a destination. Only media earlier passes didn't
+ * import are copied, and cluster options come from the config file, or a profile in it
+ */
+func WatchClusterArgs(dir string, to string, configPath string, profile string) []string {
+	args := []string{"cluster", "--from-dir=" + dir, "--to=" + to, "--incremental", "--yes", "--quiet"}
+
+	if len(configPath) > 0 {
+		args = append(args, "--config="+configPath)
+	}
+
+	if len(profile) > 0 {
+		args = append(args, "--profile="+profile)
+	}
+
+	return args
+}
+
+/*
+ * Run badger again as its own process, so a clustering pass that fails doesn't stop the caller
+ */
+func RunBadgerProcess(args []string) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(executable, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	return cmd.Run()
+}
+
+/*
+ * Watch a folder for newly arriving media, like a tethered camera's or an auto-import folder, and
+ * cluster & copy it into the destination once no more media has arrived for `debounce`. Media
+ * already in the folder are imported when watching starts
+ */
+func Watch(dir string, to string, debounce time.Duration, configPath string, profile string) int {
+	if stat, err := os.Stat(dir); err != nil || !stat.IsDir() {
+		bail(fmt.Errorf("badger: --from-dir %v isn't a folder; is your device connected?", dir))
+	}
+
+	watcher, err := NewFolderWatcher(dir)
+	bail(err)
+	defer watcher.Close()
+
+	args := WatchClusterArgs(dir, to, configPath, profile)
+
+	arrived := make(chan string, 1024)
+	failed := make(chan error, 1)
+
+	go func() {
+		failed <- watcher.Watch(arrived)
+	}()
+
+	fmt.Printf("badger: watching %v for new media, copying into %v\n", dir, to)
+
+	if err := RunBadgerProcess(args); err != nil {
+		fmt.Printf("badger: failed to import media already in %v: %v\n", dir, err)
+	}
+
+	err = DebounceArrivals(arrived, failed, debounce, func(pending int) {
+		fmt.Printf("badger: %v new media arrived; importing\n", pending)
+
+		if err := RunBadgerProcess(args); err != nil {
+			fmt.Printf("badger: failed to import new media; retrying when more arrives: %v\n", err)
+		}
+	})
+
+	bail(fmt.Errorf("badger: stopped watching %v: %v", dir, err))
+	return 1
+}
+
+/*
+ * Call `onQuiet` with the number of media that arrived once no more have arrived for `debounce`, so a
+ * burst of shots is imported together. Returns the error that stopped the watch
+ */
+func DebounceArrivals(arrived chan string, failed chan error, debounce time.Duration, onQuiet func(pending int)) error {
+	pending := 0
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+
+	for {
+		select {
+		case <-arrived:
+			// wait for a quiet period, so a burst of shots is clustered together
+			pending += 1
+			timer.Reset(debounce)
+		case <-timer.C:
+			onQuiet(pending)
+			pending = 0
+		case err := <-failed:
+			return err
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// The filesystem events that mean media may have arrived; a file finished writing or moved in,
+// or a folder was made that media may be written into
+const WatchEvents = unix.IN_CLOSE_WRITE | unix.IN_MOVED_TO | unix.IN_CREATE
+
+// Watches a folder and its sub-folders, reporting the paths of files that arrive in them
+type FolderWatcher struct {
+	fd      int
+	folders map[int]string
+}
+
+/*
+ * Start watching a folder, and each sub-folder beneath it. Hidden folders aren't watched, as they
+ * aren't searched by --from-dir
+ */
+func NewFolderWatcher(dir string) (*FolderWatcher, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("badger: failed to watch %v: %v", dir, err)
+	}
+
+	watcher := FolderWatcher{fd: fd, folders: map[int]string{}}
+
+	return &watcher, watcher.AddTree(dir)
+}
+
+/*
+ * Watch a folder and its sub-folders
+ */
+func (watcher *FolderWatcher) AddTree(dir string) error {
+	return filepath.WalkDir(dir, func(fpath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !entry.IsDir() {
+			return nil
+		}
+
+		if fpath != dir && strings.HasPrefix(entry.Name(), ".") {
+			return filepath.SkipDir
+		}
+
+		wd, err := unix.InotifyAddWatch(watcher.fd, fpath, WatchEvents)
+		if err != nil {
+			return fmt.Errorf("badger: failed to watch %v: %v", fpath, err)
+		}
+
+		watcher.folders[wd] = fpath
+		return nil
+	})
+}
+
+/*
+ * Send the path of each media file that arrives in a watched folder. New sub-folders are watched too,
+ * and their contents sent, since files can be written into them before they're watched
+ */
+func (watcher *FolderWatcher) Watch(arrived chan string) error {
+	buffer := make([]byte, 64*(unix.SizeofInotifyEvent+unix.PathMax))
+
+	for {
+		count, err := unix.Read(watcher.fd, buffer)
+		if err == unix.EINTR {
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		for offset := 0; offset+unix.SizeofInotifyEvent <= count; {
+			event := (*unix.InotifyEvent)(unsafe.Pointer(&buffer[offset]))
+			nameBytes := buffer[offset+unix.SizeofInotifyEvent : offset+unix.SizeofInotifyEvent+int(event.Len)]
+			offset += unix.SizeofInotifyEvent + int(event.Len)
+
+			name := strings.TrimRight(string(nameBytes), "\x00")
+			folder, ok := watcher.folders[int(event.Wd)]
+			if !ok || len(name) == 0 || strings.HasPrefix(name, ".") {
+				continue
+			}
+
+			fpath := filepath.Join(folder, name)
+
+			if event.Mask&unix.IN_ISDIR != 0 {
+				if err := watcher.AddTree(fpath); err != nil {
+					return err
+				}
+
+				files, _ := WalkSourceDir(fpath)
+				for _, file := range files {
+					arrived <- file
+				}
+
+				continue
+			}
+
+			// files are reported once they're fully written, not when they're created
+			if event.Mask&unix.IN_CREATE != 0 {
+				continue
+			}
+
+			if _, known := ExtensionTypes[strings.ToLower(filepath.Ext(fpath))]; known || IsSidecar(fpath) {
+				arrived <- fpath
+			}
+		}
+	}
+}
+
+func (watcher *FolderWatcher) Close() error {
+	return unix.Close(watcher.fd)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+/*
+ * Media written into a watched folder, or a folder made inside it, are reported; other files aren't
+ */
+func TestFolderWatcherReportsArrivals(t *testing.T) {
+	dir := t.TempDir()
+
+	watcher, err := NewFolderWatcher(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Close()
+
+	arrived := make(chan string, 16)
+	go watcher.Watch(arrived)
+
+	WriteTestFile(t, filepath.Join(dir, "notes.txt"), "not media")
+	WriteTestFile(t, filepath.Join(dir, "IMG_0001.jpg"), "a photo")
+
+	if err := os.Mkdir(filepath.Join(dir, "DCIM"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	// give the watcher a moment to watch the new folder
+	time.Sleep(100 * time.Millisecond)
+	WriteTestFile(t, filepath.Join(dir, "DCIM", "IMG_0002.jpg"), "another photo")
+
+	expected := map[string]bool{
+		filepath.Join(dir, "IMG_0001.jpg"):         true,
+		filepath.Join(dir, "DCIM", "IMG_0002.jpg"): true,
+	}
+
+	for len(expected) > 0 {
+		select {
+		case fpath := <-arrived:
+			if _, ok := expected[fpath]; !ok {
+				t.Errorf("expected %v not to be reported", fpath)
+			}
+
+			delete(expected, fpath)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected %v to be reported", expected)
+		}
+	}
+}
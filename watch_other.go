@@ -0,0 +1,26 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// Watching relies on inotify, so other platforms can't watch folders
+var ErrWatchUnsupported = errors.New("badger: watch is only supported on linux")
+
+// Watches a folder and its sub-folders; unavailable on this platform
+type FolderWatcher struct{}
+
+/*
+ * Fail to watch a folder, as there's no inotify to watch it with
+ */
+func NewFolderWatcher(dir string) (*FolderWatcher, error) {
+	return nil, ErrWatchUnsupported
+}
+
+func (watcher *FolderWatcher) Watch(arrived chan string) error {
+	return ErrWatchUnsupported
+}
+
+func (watcher *FolderWatcher) Close() error {
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+/*
+ * A burst of arrivals is imported once, after it goes quiet, and the watch stops when watching fails
+ */
+func TestDebounceArrivals(t *testing.T) {
+	arrived := make(chan string, 16)
+	failed := make(chan error, 1)
+	imports := make(chan int, 16)
+
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- DebounceArrivals(arrived, failed, 50*time.Millisecond, func(pending int) {
+			imports <- pending
+		})
+	}()
+
+	for _, fpath := range []string{"a.jpg", "b.jpg", "c.jpg"} {
+		arrived <- fpath
+	}
+
+	select {
+	case pending := <-imports:
+		if pending != 3 {
+			t.Errorf("expected the burst to be imported together, got %v media", pending)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected media to be imported once the burst went quiet")
+	}
+
+	select {
+	case pending := <-imports:
+		t.Errorf("expected nothing more to import, but imported %v media", pending)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	failure := errors.New("device removed")
+	failed <- failure
+
+	if err := <-stopped; err != failure {
+		t.Errorf("expected the watch to stop with %v, got %v", failure, err)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// How often adaptive copy-workers measure throughput
+const AdaptInterval = 5 * time.Second
+
+// The relative change in throughput treated as a real rise or fall, rather than noise
+const AdaptThreshold = 0.05
+
+// The fewest and most workers allowed to copy at once
+type WorkerBounds struct {
+	min int
+	max int
+}
+
+// Limits how many workers copy at once. Each copying worker holds a slot; the slots above the
+// current worker-count are held back by the limiter itself, and released or reclaimed as throughput changes
+type WorkerLimiter struct {
+	bounds WorkerBounds
+	slots  chan struct{}
+	held   int
+	copied int64
+	stop   chan struct{}
+}
+
+/*
+ * Construct a limiter, starting at the fewest workers. Workers are tuned between the bounds
+ * until the limiter is stopped
+ */
+func NewWorkerLimiter(bounds WorkerBounds) *WorkerLimiter {
+	limiter := &WorkerLimiter{
+		bounds: bounds,
+		slots:  make(chan struct{}, bounds.max),
+		stop:   make(chan struct{}),
+	}
+
+	for idx := bounds.min; idx < bounds.max; idx++ {
+		limiter.slots <- struct{}{}
+		limiter.held += 1
+	}
+
+	if bounds.min < bounds.max {
+		go limiter.Adapt()
+	}
+
+	return limiter
+}
+
+/*
+ * Wait for a free slot before copying
+ */
+func (limiter *WorkerLimiter) Acquire() {
+	limiter.slots <- struct{}{}
+}
+
+/*
+ * Free a slot after copying
+ */
+func (limiter *WorkerLimiter) Release() {
+	<-limiter.slots
+}
+
+/*
+ * Count bytes copied, to measure throughput
+ */
+func (limiter *WorkerLimiter) Copied(size int64) {
+	atomic.AddInt64(&limiter.copied, size)
+}
+
+/*
+ * Stop tuning; called once every worker has finished
+ */
+func (limiter *WorkerLimiter) Stop() {
+	close(limiter.stop)
+}
+
+/*
+ * Let one more worker copy at once, if below the most allowed
+ */
+func (limiter *WorkerLimiter) Grow() bool {
+	if limiter.held == 0 {
+		return false
+	}
+
+	<-limiter.slots
+	limiter.held -= 1
+
+	return true
+}
+
+/*
+ * Let one fewer worker copy at once, if above the fewest allowed. Waits for a copying worker to
+ * finish its current file, unless the limiter is stopped first
+ */
+func (limiter *WorkerLimiter) Shrink() {
+	if limiter.held == limiter.bounds.max-limiter.bounds.min {
+		return
+	}
+
+	select {
+	case limiter.slots <- struct{}{}:
+		limiter.held += 1
+	case <-limiter.stop:
+	}
+}
+
+/*
+ * Measure throughput periodically; add a worker while throughput rises, and remove one when it
+ * falls, or doesn't rise after a worker was added
+ */
+func (limiter *WorkerLimiter) Adapt() {
+	ticker := time.NewTicker(AdaptInterval)
+	defer ticker.Stop()
+
+	previous := 0.0
+	grew := false
+	last := time.Now()
+
+	for {
+		select {
+		case <-limiter.stop:
+			return
+		case <-ticker.C:
+		}
+
+		copied := atomic.SwapInt64(&limiter.copied, 0)
+		elapsed := time.Since(last).Seconds()
+		last = time.Now()
+
+		// large files can take longer than an interval to copy, so an empty interval says nothing
+		if copied == 0 {
+			continue
+		}
+
+		rate := float64(copied) / elapsed
+
+		switch {
+		case rate > previous*(1+AdaptThreshold):
+			grew = limiter.Grow()
+		case rate < previous*(1-AdaptThreshold) || grew:
+			limiter.Shrink()
+			grew = false
+		}
+
+		previous = rate
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+/*
+ * Count the slots workers can acquire without waiting
+ */
+func FreeSlots(limiter *WorkerLimiter) int {
+	return cap(limiter.slots) - len(limiter.slots)
+}
+
+/*
+ * Run a function in the background, reporting when it returns
+ */
+func Background(fn func()) chan struct{} {
+	done := make(chan struct{})
+
+	go func() {
+		fn()
+		close(done)
+	}()
+
+	return done
+}
+
+func TestWorkerLimiterStartsAtFewestWorkers(t *testing.T) {
+	limiter := NewWorkerLimiter(WorkerBounds{min: 2, max: 4})
+	defer limiter.Stop()
+
+	if free := FreeSlots(limiter); free != 2 {
+		t.Errorf("expected 2 workers to copy at first, got %v", free)
+	}
+}
+
+func TestWorkerLimiterGrowsToMostWorkers(t *testing.T) {
+	limiter := NewWorkerLimiter(WorkerBounds{min: 1, max: 3})
+	defer limiter.Stop()
+
+	for idx := 0; idx < 2; idx++ {
+		if !limiter.Grow() {
+			t.Fatalf("expected growing to %v workers to succeed", idx+2)
+		}
+	}
+
+	if limiter.Grow() {
+		t.Error("expected growing past the most workers to fail")
+	}
+
+	if free := FreeSlots(limiter); free != 3 {
+		t.Errorf("expected 3 workers to copy, got %v", free)
+	}
+}
+
+/*
+ * A worker can't be interrupted mid-copy, so shrinking waits for one to finish its file
+ */
+func TestWorkerLimiterShrinkWaitsForRelease(t *testing.T) {
+	limiter := NewWorkerLimiter(WorkerBounds{min: 1, max: 2})
+	defer limiter.Stop()
+
+	limiter.Grow()
+	limiter.Acquire()
+	limiter.Acquire()
+
+	shrunk := Background(limiter.Shrink)
+
+	select {
+	case <-shrunk:
+		t.Fatal("expected shrinking to wait while every worker is copying")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	limiter.Release()
+
+	select {
+	case <-shrunk:
+	case <-time.After(time.Second):
+		t.Fatal("expected shrinking to finish once a worker released its slot")
+	}
+
+	limiter.Release()
+
+	if free := FreeSlots(limiter); free != 1 {
+		t.Errorf("expected 1 worker to copy after shrinking, got %v", free)
+	}
+
+	// already at the fewest workers, so shrinking does nothing
+	select {
+	case <-Background(limiter.Shrink):
+	case <-time.After(time.Second):
+		t.Fatal("expected shrinking at the fewest workers to return at once")
+	}
+}
+
+func TestWorkerLimiterStopReleasesShrink(t *testing.T) {
+	limiter := NewWorkerLimiter(WorkerBounds{min: 1, max: 2})
+
+	limiter.Grow()
+	limiter.Acquire()
+	limiter.Acquire()
+
+	shrunk := Background(limiter.Shrink)
+	limiter.Stop()
+
+	select {
+	case <-shrunk:
+	case <-time.After(time.Second):
+		t.Fatal("expected stopping to release a waiting shrink")
+	}
+}